@@ -1,56 +1,285 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-xray-sdk-go/v2/xray"
 	"github.com/ockendenjo/handler"
-	"github.com/ockendenjo/strava"
+	"github.com/ockendenjo/strava-shoes/pkg/apikey"
+	"github.com/ockendenjo/strava-shoes/pkg/athletes"
+	"github.com/ockendenjo/strava-shoes/pkg/oauthstate"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
 )
 
+// stateTTL is how long the athlete has to authorize the app on the Strava page
+const stateTTL = 15 * time.Minute
+
+// stateCookie holds the nonce from the state, so that the callback only accepts an authorization in the browser which
+// started it
+const stateCookie = "strava_auth_state"
+
+// Access levels which can be requested from GET /connect. The level is carried through the authorization in the state
+const (
+	accessRead  = "read"
+	accessWrite = "write"
+)
+
+var requestedScopes = map[string]stravaapi.Scopes{
+	accessRead:  {stravaapi.ScopeActivityRead, stravaapi.ScopeProfileReadAll},
+	accessWrite: {stravaapi.ScopeActivityRead, stravaapi.ScopeActivityReadAll, stravaapi.ScopeActivityWrite, stravaapi.ScopeProfileReadAll},
+}
+
+// scopeFeatures describes what does not work if a requested scope is not granted
+var scopeFeatures = map[string]string{
+	stravaapi.ScopeActivityReadAll: "Activities which are only visible to you will not be checked.",
+	stravaapi.ScopeActivityWrite:   "Gear will not be fixed and bagged hills will not be added to activity descriptions.",
+	stravaapi.ScopeProfileReadAll:  "Your shoes and bikes cannot be read, so gear rules will not be set up from them.",
+}
+
 type apiHandler = handler.Handler[events.APIGatewayV2HTTPRequest, events.APIGatewayV2HTTPResponse]
 
 func main() {
-	handler.BuildAndStart(func(awsConfig aws.Config) apiHandler {
-		ssmClient := ssm.NewFromConfig(awsConfig)
+	scheduleRule := handler.MustGetEnv("SCHEDULE_RULE")
+	athletesDb := handler.MustGetEnv("ATHLETES_DB")
+	callbackURL := handler.MustGetEnv("CALLBACK_URL")
+	topicArn := handler.MustGetEnv("TOPIC_ARN")
 
+	handler.BuildAndStart(func(awsConfig aws.Config) apiHandler {
 		httpClient := &http.Client{
 			Timeout:   3 * time.Second,
 			Transport: xray.RoundTripper(http.DefaultTransport),
 		}
-		stravaClient := strava.NewClient(ssmClient, httpClient)
 
-		return getHandler(stravaClient)
+		ssmStore := stravaapi.NewSSMStore(ssm.NewFromConfig(awsConfig))
+		athletesClient := athletes.NewClient(dynamodb.NewFromConfig(awsConfig), athletesDb)
+
+		h := &lambdaHandler{
+			httpClient:     httpClient,
+			credentials:    ssmStore,
+			athletesClient: athletesClient,
+			ebClient:       eventbridge.NewFromConfig(awsConfig),
+			snsClient:      sns.NewFromConfig(awsConfig),
+			newStravaAPI: func(athleteID int64) stravaapi.Client {
+				return stravaapi.NewClient(httpClient, ssmStore, athletes.NewTokenStore(athletesClient, athleteID))
+			},
+			scheduleRule: scheduleRule,
+			callbackURL:  callbackURL,
+			topicArn:     topicArn,
+		}
+		return h.handle
 	})
 }
 
-func getHandler(client strava.Client) apiHandler {
-	return func(ctx *handler.Context, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-		logger := ctx.GetLogger()
+type lambdaHandler struct {
+	httpClient     *http.Client
+	credentials    stravaapi.CredentialsGetter
+	athletesClient athletes.Client
+	ebClient       *eventbridge.Client
+	snsClient      *sns.Client
+	newStravaAPI   func(athleteID int64) stravaapi.Client
+	scheduleRule   string
+	callbackURL    string
+	topicArn       string
+}
+
+func (h *lambdaHandler) handle(ctx *handler.Context, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	if event.RouteKey == "GET /connect" {
+		return h.connect(ctx, event)
+	}
+	res, err := h.authorize(ctx, event)
+	//The state can only be used once, so the cookie is no longer needed
+	res.Cookies = append(res.Cookies, (&http.Cookie{Name: stateCookie, Path: "/", MaxAge: -1, Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode}).String())
+	return res, err
+}
+
+// connect redirects to the Strava authorization page with a signed state. The access query parameter may be read or
+// write
+func (h *lambdaHandler) connect(ctx *handler.Context, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	logger := ctx.GetLogger()
+	correlationID := event.RequestContext.RequestID
+	logger.AddParam("correlationId", correlationID)
+
+	access := event.QueryStringParameters["access"]
+	if access == "" {
+		access = accessRead
+	}
+	scopes, found := requestedScopes[access]
+	if !found {
+		return renderPage(http.StatusBadRequest, pageRetry, page{
+			Title:    "Invalid link",
+			Message:  "The link asked for an unknown level of access.",
+			RetryURL: retryURL(accessRead),
+		}), nil
+	}
+
+	creds, signer, err := h.getSigner(ctx)
+	if err != nil {
+		logger.AddParam("error", err).Error("Failed to get app credentials")
+		return serverError(access, correlationID), nil
+	}
+	state, nonce, err := signer.Sign(access)
+	if err != nil {
+		logger.AddParam("error", err).Error("Failed to sign state")
+		return serverError(access, correlationID), nil
+	}
+
+	//SameSite=Lax sends the cookie when Strava redirects back to the callback
+	cookie := &http.Cookie{
+		Name:     stateCookie,
+		Value:    nonce,
+		Path:     "/",
+		MaxAge:   int(stateTTL.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusFound,
+		Headers:    map[string]string{"Location": stravaapi.AuthorizeURL(creds.ClientID, h.callbackURL, scopes, state)},
+		Cookies:    []string{cookie.String()},
+	}, nil
+}
 
-		code, found := event.QueryStringParameters["code"]
-		if !found {
-			return getResponse(http.StatusUnauthorized, "No 'code' parameter in query string parameters"), nil
+// authorize handles the callback from Strava. It checks the state and the granted scopes, then exchanges the code for
+// the athlete's tokens and stores them. An athlete who authorizes for the first time is onboarded
+func (h *lambdaHandler) authorize(ctx *handler.Context, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	logger := ctx.GetLogger()
+	correlationID := event.RequestContext.RequestID
+	logger.AddParam("correlationId", correlationID)
+	query := event.QueryStringParameters
+
+	_, signer, err := h.getSigner(ctx)
+	if err != nil {
+		logger.AddParam("error", err).Error("Failed to get app credentials")
+		return serverError("", correlationID), nil
+	}
+	access, nonce, stateErr := signer.Verify(query["state"])
+
+	//Nothing is stored when the athlete denies access, so the state does not need to be valid
+	if errorCode, found := query["error"]; found {
+		logger.AddParam("errorCode", errorCode).Info("Athlete did not authorize the app")
+		return renderPage(http.StatusForbidden, pageDenied, page{Title: "Access denied", RetryURL: retryURL(access)}), nil
+	}
+
+	if stateErr != nil {
+		logger.AddParam("error", stateErr).Warn("Rejected authorization with an invalid state")
+		msg := "The authorization was not started from this app."
+		if errors.Is(stateErr, oauthstate.ErrExpired) {
+			msg = "The authorization took too long to complete."
 		}
+		return renderPage(http.StatusBadRequest, pageRetry, page{Title: "Authorization failed", Message: msg, RetryURL: retryURL("")}), nil
+	}
+	if !hasStateCookie(event.Cookies, nonce) {
+		logger.Warn("Rejected authorization without the state cookie")
+		return renderPage(http.StatusBadRequest, pageRetry, page{
+			Title:    "Authorization failed",
+			Message:  "The authorization was not started in this browser.",
+			RetryURL: retryURL(access),
+		}), nil
+	}
+
+	code, found := query["code"]
+	if !found {
+		return renderPage(http.StatusUnauthorized, pageRetry, page{
+			Title:    "Authorization failed",
+			Message:  "Strava did not send an authorization code.",
+			RetryURL: retryURL(access),
+		}), nil
+	}
+
+	granted := stravaapi.ParseScopes(query["scope"])
+	logger.AddParam("scopes", granted.String())
+	if !granted.CanReadActivities() {
+		logger.Warn("Rejected authorization without access to activities")
+		return renderPage(http.StatusForbidden, pageRetry, page{
+			Title:    "Access to activities is needed",
+			Message:  "Your activities can only be checked if you allow access to them. Authorize again and leave the activities box ticked.",
+			RetryURL: retryURL(access),
+		}), nil
+	}
+
+	authorization, err := stravaapi.ExchangeCode(ctx, h.httpClient, h.credentials, code)
+	if err != nil {
+		logger.AddParam("error", err).Error("Authorization error")
+		return serverError(access, correlationID), nil
+	}
+	logger.AddParam("athleteId", authorization.Athlete.ID)
 
-		err := client.Authorize(ctx, code)
-		if err != nil {
-			logger.AddParam("error", err).Error("Authorization error")
-			return getResponse(http.StatusInternalServerError, "Something went wrong"), nil
+	first, err := h.athletesClient.Connect(ctx, authorization.Athlete.ID, authorization.Athlete.Name(), granted, &authorization.Tokens)
+	if err != nil {
+		logger.AddParam("error", err).Error("Error storing athlete")
+		return serverError(access, correlationID), nil
+	}
+
+	var gearList []string
+	if first || h.needsRules(ctx, authorization.Athlete.ID) {
+		gearList = h.onboard(ctx, authorization.Athlete, first)
+	}
+	h.ensureSubscription(ctx, authorization.Athlete.ID)
+
+	//The authorization still succeeds without a key, as authorizing again issues a new one
+	apiKey, hash := apikey.NewAthleteKey(authorization.Athlete.ID)
+	err = h.athletesClient.PutAPIKeyHash(ctx, authorization.Athlete.ID, hash)
+	if err != nil {
+		logger.AddParam("error", err).Warn("Failed to store API key")
+		apiKey = ""
+	}
+
+	//The scheduled check is disabled if every athlete revoked access
+	_, err = h.ebClient.EnableRule(ctx, &eventbridge.EnableRuleInput{Name: aws.String(h.scheduleRule)})
+	if err != nil {
+		logger.AddParam("error", err).Warn("Failed to enable scheduled check")
+	}
+
+	var missing []string
+	for _, scope := range requestedScopes[access] {
+		feature, found := scopeFeatures[scope]
+		if found && !granted.Has(scope) {
+			logger.Warn("Requested scope was not granted", "scope", scope)
+			missing = append(missing, feature)
 		}
+	}
+
+	logger.Info("Authorized")
+	return renderPage(http.StatusOK, pageSuccess, page{
+		Title:       "Strava account connected",
+		AthleteName: authorization.Athlete.Name(),
+		Scopes:      granted,
+		Missing:     missing,
+		Gear:        gearList,
+		APIKey:      apiKey,
+		RetryURL:    retryURL(access),
+	}), nil
+}
 
-		logger.Info("Authorized")
-		return getResponse(http.StatusOK, "Authorized"), nil
+// hasStateCookie reports whether the request has the cookie set by connect for the state's nonce. API Gateway sends
+// each cookie as name=value
+func hasStateCookie(cookies []string, nonce string) bool {
+	for _, c := range cookies {
+		name, value, found := strings.Cut(c, "=")
+		if found && name == stateCookie {
+			return subtle.ConstantTimeCompare([]byte(value), []byte(nonce)) == 1
+		}
 	}
+	return false
 }
 
-func getResponse(code int, message string) events.APIGatewayV2HTTPResponse {
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: code,
-		Body:       message,
+// getSigner returns a signer for the state. The app's client secret is the signing key, so no other secret is needed
+func (h *lambdaHandler) getSigner(ctx context.Context) (*stravaapi.AppCredentials, *oauthstate.Signer, error) {
+	creds, err := h.credentials.GetAppCredentials(ctx)
+	if err != nil {
+		return nil, nil, err
 	}
+	return creds, oauthstate.NewSigner([]byte(creds.ClientSecret), stateTTL), nil
 }
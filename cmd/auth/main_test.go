@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/apikey"
+	"github.com/ockendenjo/strava-shoes/pkg/athletes"
+	"github.com/ockendenjo/strava-shoes/pkg/gear"
+	"github.com/ockendenjo/strava-shoes/pkg/localaws"
+	"github.com/ockendenjo/strava-shoes/pkg/oauthstate"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+	"github.com/ockendenjo/strava-shoes/pkg/stravafake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testScheduleRule = "strava-check-schedule"
+const testTopicArn = "arn:aws:sns:eu-west-1:123456789012:strava"
+
+func newTestHandler(t *testing.T, stravaServer *stravafake.Server) (*lambdaHandler, *localaws.Server) {
+	awsServer := localaws.NewServer()
+	awsServer.PutParameter("/strava/clientId", stravafake.DefaultClientID)
+	awsServer.PutParameter("/strava/clientSecret", stravafake.DefaultClientSecret)
+	awsServer.CreateTable("strava-athletes", "AthleteID", "")
+	awsHTTPServer := httptest.NewServer(awsServer)
+	t.Cleanup(awsHTTPServer.Close)
+	awsConfig := localaws.Config(awsHTTPServer.URL)
+
+	ssmStore := stravaapi.NewSSMStore(ssm.NewFromConfig(awsConfig))
+	athletesClient := athletes.NewClient(dynamodb.NewFromConfig(awsConfig), "strava-athletes")
+	h := &lambdaHandler{
+		httpClient:     stravaServer.Client(),
+		credentials:    ssmStore,
+		athletesClient: athletesClient,
+		ebClient:       eventbridge.NewFromConfig(awsConfig),
+		snsClient:      sns.NewFromConfig(awsConfig),
+		newStravaAPI: func(athleteID int64) stravaapi.Client {
+			return stravaapi.NewClient(stravaServer.Client(), ssmStore, athletes.NewTokenStore(athletesClient, athleteID))
+		},
+		scheduleRule: testScheduleRule,
+		callbackURL:  "https://api.example.com/auth",
+		topicArn:     testTopicArn,
+	}
+
+	//The scheduled check is disabled when every athlete revokes access
+	_, err := h.ebClient.DisableRule(context.Background(), &eventbridge.DisableRuleInput{Name: aws.String(testScheduleRule)})
+	require.NoError(t, err)
+	return h, awsServer
+}
+
+// connect starts an authorization and returns the state from the redirect to Strava, and the cookies which the browser
+// sends to the callback
+func connect(t *testing.T, h *lambdaHandler, access string) (string, []string) {
+	ctx := handler.GetWithSuppressedLogging(context.Background())
+	res, err := h.handle(ctx, events.APIGatewayV2HTTPRequest{RouteKey: "GET /connect", QueryStringParameters: map[string]string{"access": access}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusFound, res.StatusCode)
+
+	location, err := url.Parse(res.Headers["Location"])
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.example.com/auth", location.Query().Get("redirect_uri"))
+	assert.Equal(t, stravafake.DefaultClientID, location.Query().Get("client_id"))
+
+	require.Len(t, res.Cookies, 1)
+	cookie, err := http.ParseSetCookie(res.Cookies[0])
+	require.NoError(t, err)
+	assert.Equal(t, stateCookie, cookie.Name)
+	assert.True(t, cookie.Secure)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	return location.Query().Get("state"), []string{cookie.Name + "=" + cookie.Value}
+}
+
+func Test_handle(t *testing.T) {
+	expiredState, _, err := oauthstate.NewSigner([]byte(stravafake.DefaultClientSecret), -time.Minute).Sign(accessRead)
+	require.NoError(t, err)
+	otherState, _, err := oauthstate.NewSigner([]byte("other secret"), time.Minute).Sign(accessRead)
+	require.NoError(t, err)
+
+	testcases := []struct {
+		name       string
+		access     string
+		query      map[string]string
+		cookies    func() []string
+		expStatus  int
+		expPage    []string
+		expStored  bool
+		expEnabled bool
+	}{
+		{
+			name:       "valid code",
+			access:     accessRead,
+			query:      map[string]string{"code": "valid", "scope": "read,activity:read"},
+			expStatus:  http.StatusOK,
+			expPage:    []string{"Thanks, Hamish Brown.", "<code>activity:read</code>"},
+			expStored:  true,
+			expEnabled: true,
+		},
+		{
+			name:       "write access granted",
+			access:     accessWrite,
+			query:      map[string]string{"code": "valid", "scope": "read,activity:read,activity:read_all,activity:write"},
+			expStatus:  http.StatusOK,
+			expPage:    []string{"<code>activity:write</code>"},
+			expStored:  true,
+			expEnabled: true,
+		},
+		{
+			name:      "write access not granted",
+			access:    accessWrite,
+			query:     map[string]string{"code": "valid", "scope": "read,activity:read"},
+			expStatus: http.StatusOK,
+			expPage: []string{
+				scopeFeatures[stravaapi.ScopeActivityReadAll],
+				scopeFeatures[stravaapi.ScopeActivityWrite],
+				`href="connect?access=write"`,
+			},
+			expStored:  true,
+			expEnabled: true,
+		},
+		{
+			name:      "no activity access",
+			access:    accessRead,
+			query:     map[string]string{"code": "valid", "scope": "read"},
+			expStatus: http.StatusForbidden,
+			expPage:   []string{"Access to activities is needed", `href="connect"`},
+		},
+		{
+			name:      "access denied",
+			access:    accessWrite,
+			query:     map[string]string{"error": "access_denied"},
+			expStatus: http.StatusForbidden,
+			expPage:   []string{"Access denied", `href="connect?access=write"`},
+		},
+		{
+			name:      "unknown code",
+			access:    accessRead,
+			query:     map[string]string{"code": "unknown", "scope": "read,activity:read"},
+			expStatus: http.StatusInternalServerError,
+			expPage:   []string{"<code>test-request</code>"},
+		},
+		{
+			name:      "missing code",
+			access:    accessRead,
+			query:     map[string]string{},
+			expStatus: http.StatusUnauthorized,
+		},
+		{
+			name:      "missing state",
+			query:     map[string]string{"code": "valid", "scope": "read,activity:read"},
+			expStatus: http.StatusBadRequest,
+		},
+		{
+			name:      "expired state",
+			query:     map[string]string{"code": "valid", "scope": "read,activity:read", "state": expiredState},
+			expStatus: http.StatusBadRequest,
+			expPage:   []string{"The authorization took too long to complete."},
+		},
+		{
+			name:   "missing state cookie",
+			access: accessRead,
+			query:  map[string]string{"code": "valid", "scope": "read,activity:read"},
+			cookies: func() []string {
+				return nil
+			},
+			expStatus: http.StatusBadRequest,
+			expPage:   []string{"The authorization was not started in this browser."},
+		},
+		{
+			name:   "state cookie from another authorization",
+			access: accessRead,
+			query:  map[string]string{"code": "valid", "scope": "read,activity:read"},
+			cookies: func() []string {
+				return []string{stateCookie + "=" + rand.Text()}
+			},
+			expStatus: http.StatusBadRequest,
+			expPage:   []string{"The authorization was not started in this browser."},
+		},
+		{
+			name:      "state signed with another key",
+			query:     map[string]string{"code": "valid", "scope": "read,activity:read", "state": otherState},
+			expStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			stravaServer := stravafake.NewServer(stravafake.Athlete{ID: 1001, Firstname: "Hamish", Lastname: "Brown"})
+			defer stravaServer.Close()
+			stravaServer.AddAuthCode("valid", "read", "activity:read_all")
+			h, awsServer := newTestHandler(t, stravaServer)
+
+			query := maps.Clone(tc.query)
+			var cookies []string
+			if tc.access != "" {
+				query["state"], cookies = connect(t, h, tc.access)
+			}
+			if tc.cookies != nil {
+				cookies = tc.cookies()
+			}
+
+			ctx := handler.GetWithSuppressedLogging(context.Background())
+			res, err := h.handle(ctx, events.APIGatewayV2HTTPRequest{
+				RouteKey:              "GET /auth",
+				QueryStringParameters: query,
+				Cookies:               cookies,
+				RequestContext:        events.APIGatewayV2HTTPRequestContext{RequestID: "test-request"},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expStatus, res.StatusCode)
+			assert.Equal(t, "text/html; charset=utf-8", res.Headers["Content-Type"])
+			for _, text := range tc.expPage {
+				assert.Contains(t, res.Body, text)
+			}
+			assert.Equal(t, tc.expEnabled, awsServer.RuleEnabled(testScheduleRule))
+
+			athlete, err := h.athletesClient.GetAthlete(ctx, 1001)
+			if !tc.expStored {
+				assert.ErrorIs(t, err, athletes.ErrNotFound)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "Hamish Brown", athlete.Name)
+			assert.Equal(t, stravaapi.ParseScopes(tc.query["scope"]), athlete.Scopes)
+			assert.NotEmpty(t, athlete.Tokens.AccessToken)
+			assert.NotEmpty(t, athlete.Tokens.RefreshToken)
+		})
+	}
+}
+
+func Test_handle_connectInvalidAccess(t *testing.T) {
+	stravaServer := stravafake.NewServer(stravafake.Athlete{ID: 1001})
+	defer stravaServer.Close()
+	h, _ := newTestHandler(t, stravaServer)
+
+	ctx := handler.GetWithSuppressedLogging(context.Background())
+	res, err := h.handle(ctx, events.APIGatewayV2HTTPRequest{RouteKey: "GET /connect", QueryStringParameters: map[string]string{"access": "admin"}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func Test_handle_keepsOptions(t *testing.T) {
+	stravaServer := stravafake.NewServer(stravafake.Athlete{ID: 1001, Firstname: "Hamish"})
+	defer stravaServer.Close()
+	stravaServer.AddAuthCode("first", "activity:read_all")
+	stravaServer.AddAuthCode("second", "activity:read_all")
+	h, _ := newTestHandler(t, stravaServer)
+
+	ctx := handler.GetWithSuppressedLogging(context.Background())
+	state, cookies := connect(t, h, accessRead)
+	query := map[string]string{"code": "first", "scope": "activity:read_all", "state": state}
+	res, err := h.handle(ctx, events.APIGatewayV2HTTPRequest{RouteKey: "GET /auth", QueryStringParameters: query, Cookies: cookies})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NoError(t, h.athletesClient.PutOptions(ctx, 1001, nil, "arn:aws:sns:eu-west-1:123456789012:strava-hamish"))
+	first, err := h.athletesClient.GetAthlete(ctx, 1001)
+	require.NoError(t, err)
+
+	state, cookies = connect(t, h, accessRead)
+	query = map[string]string{"code": "second", "scope": "activity:read_all", "state": state}
+	res, err = h.handle(ctx, events.APIGatewayV2HTTPRequest{RouteKey: "GET /auth", QueryStringParameters: query, Cookies: cookies})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	athlete, err := h.athletesClient.GetAthlete(ctx, 1001)
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:sns:eu-west-1:123456789012:strava-hamish", athlete.TopicArn)
+	assert.NotEqual(t, first.Tokens, athlete.Tokens)
+}
+
+// authorize completes an authorization in which the athlete grants the scopes, and returns the page
+func authorize(t *testing.T, h *lambdaHandler, stravaServer *stravafake.Server, scopes ...string) events.APIGatewayV2HTTPResponse {
+	code := rand.Text()
+	stravaServer.AddAuthCode(code, scopes...)
+	ctx := handler.GetWithSuppressedLogging(context.Background())
+	state, cookies := connect(t, h, accessWrite)
+	query := map[string]string{"code": code, "scope": strings.Join(scopes, ","), "state": state}
+	res, err := h.handle(ctx, events.APIGatewayV2HTTPRequest{RouteKey: "GET /auth", QueryStringParameters: query, Cookies: cookies})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	return res
+}
+
+var apiKeyPattern = regexp.MustCompile(`<code>(1001\.[A-Z2-7]+)</code>`)
+
+var allScopes = []string{"read", "activity:read_all", "activity:write", "profile:read_all"}
+
+func newOnboardingServer() *stravafake.Server {
+	return stravafake.NewServer(stravafake.Athlete{
+		ID:        1001,
+		Firstname: "Hamish",
+		Lastname:  "Brown",
+		Shoes: []stravafake.Gear{
+			{ID: "g1", Name: "Trail shoes", Primary: true},
+			{ID: "g2", Name: "Road shoes"},
+			{ID: "g3", Name: "Old shoes", Retired: true},
+		},
+		Bikes: []stravafake.Gear{{ID: "b1", Name: "Gravel bike"}},
+	})
+}
+
+var shoeRule = gear.Rule{Allowed: []string{"g1", "g2"}, Use: "g1"}
+var bikeRule = gear.Rule{Allowed: []string{"b1"}}
+var seededRules = gear.Rules{
+	"Run":              shoeRule,
+	"TrailRun":         shoeRule,
+	"Walk":             shoeRule,
+	"Hike":             shoeRule,
+	"Ride":             bikeRule,
+	"GravelRide":       bikeRule,
+	"MountainBikeRide": bikeRule,
+}
+
+func Test_handle_onboarding(t *testing.T) {
+	stravaServer := newOnboardingServer()
+	defer stravaServer.Close()
+	h, awsServer := newTestHandler(t, stravaServer)
+
+	res := authorize(t, h, stravaServer, allScopes...)
+	assert.Contains(t, res.Body, "Shoes: Trail shoes (g1), primary")
+	assert.Contains(t, res.Body, "Bike: Gravel bike (b1)")
+
+	ctx := handler.GetWithSuppressedLogging(context.Background())
+	athlete, err := h.athletesClient.GetAthlete(ctx, 1001)
+	require.NoError(t, err)
+	assert.Equal(t, seededRules, athlete.GearRules)
+	firstKey := apiKeyPattern.FindStringSubmatch(res.Body)
+	require.NotNil(t, firstKey, "API key is shown")
+	assert.True(t, apikey.MatchesHash(firstKey[1], athlete.APIKeyHash))
+
+	messages := awsServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, testTopicArn, messages[0].TopicArn)
+	assert.Contains(t, messages[0].Message, "Welcome Hamish Brown.")
+	assert.Contains(t, messages[0].Message, "- Shoes: Old shoes (g3), retired\n")
+	assert.Contains(t, messages[0].Message, "- Bike: Gravel bike (b1)\n")
+
+	events := awsServer.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, subscriptionRequested, events[0].DetailType)
+
+	//Authorizing again keeps the athlete's rules and does not send another welcome
+	require.NoError(t, h.athletesClient.PutGearRules(ctx, 1001, gear.Rules{"Run": {}}))
+	res = authorize(t, h, stravaServer, allScopes...)
+	assert.NotContains(t, res.Body, "Trail shoes")
+	athlete, err = h.athletesClient.GetAthlete(ctx, 1001)
+	require.NoError(t, err)
+	assert.Equal(t, gear.Rules{"Run": {}}, athlete.GearRules)
+	assert.Len(t, awsServer.Messages(), 1)
+
+	//Authorizing again replaces the API key
+	secondKey := apiKeyPattern.FindStringSubmatch(res.Body)
+	require.NotNil(t, secondKey)
+	assert.True(t, apikey.MatchesHash(secondKey[1], athlete.APIKeyHash))
+	assert.False(t, apikey.MatchesHash(firstKey[1], athlete.APIKeyHash))
+}
+
+func Test_handle_onboardingRetry(t *testing.T) {
+	stravaServer := newOnboardingServer()
+	defer stravaServer.Close()
+	h, awsServer := newTestHandler(t, stravaServer)
+
+	//Strava leaves out the gear without profile:read_all
+	res := authorize(t, h, stravaServer, "read", "activity:read_all", "activity:write")
+	assert.Contains(t, res.Body, scopeFeatures[stravaapi.ScopeProfileReadAll])
+	assert.NotContains(t, res.Body, "Trail shoes")
+
+	ctx := handler.GetWithSuppressedLogging(context.Background())
+	athlete, err := h.athletesClient.GetAthlete(ctx, 1001)
+	require.NoError(t, err)
+	assert.Nil(t, athlete.GearRules)
+	messages := awsServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Message, "No shoes or bikes were found")
+
+	//The rules are seeded when the athlete authorizes again, without another welcome
+	res = authorize(t, h, stravaServer, allScopes...)
+	assert.Contains(t, res.Body, "Shoes: Trail shoes (g1), primary")
+	athlete, err = h.athletesClient.GetAthlete(ctx, 1001)
+	require.NoError(t, err)
+	assert.Equal(t, seededRules, athlete.GearRules)
+	assert.Len(t, awsServer.Messages(), 1)
+}
+
+func Test_handle_existingSubscription(t *testing.T) {
+	stravaServer := stravafake.NewServer(stravafake.Athlete{ID: 1001})
+	defer stravaServer.Close()
+	stravaServer.AddSubscription("https://api.example.com/event")
+	h, awsServer := newTestHandler(t, stravaServer)
+
+	res := authorize(t, h, stravaServer, allScopes...)
+	assert.NotContains(t, res.Body, "This gear was found")
+	assert.Empty(t, awsServer.Events())
+
+	//A new athlete without gear is still welcomed
+	messages := awsServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Message, "No shoes or bikes were found")
+}
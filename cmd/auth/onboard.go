@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/gear"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+	"github.com/ockendenjo/strava-shoes/pkg/webhook"
+	"github.com/ockendenjo/strava/sports"
+)
+
+// subscriptionRequested is the EventBridge detail type of the event which starts the subscribe lambda
+const subscriptionRequested = "StravaSubscriptionRequested"
+
+// The gear rules seeded for a new athlete check shoes for foot sports and bikes for ride sports
+var shoeSports = []sports.Sport{"Run", "TrailRun", "Walk", "Hike"}
+var bikeSports = []sports.Sport{"Ride", "GravelRide", "MountainBikeRide"}
+
+// onboard seeds the gear rules of an athlete from the gear on their Strava account. It runs on the first authorization
+// and again on later authorizations while the athlete has no rules, so that a failure is retried. A welcome
+// notification which lists the gear is sent on the first authorization. Failures are logged and the authorization
+// still succeeds, as the rules can be set with the gear rules API. It returns a description of each item of gear
+func (h *lambdaHandler) onboard(ctx *handler.Context, profile stravaapi.AthleteProfile, first bool) []string {
+	logger := ctx.GetLogger()
+
+	var gearList []string
+	athlete, err := h.newStravaAPI(profile.ID).GetAthlete(ctx)
+	if err != nil {
+		logger.AddParam("error", err).Warn("Failed to get athlete's gear")
+	}
+
+	seeded := false
+	if athlete != nil {
+		rules := seedRules(athlete)
+		if len(rules) > 0 {
+			err = h.athletesClient.PutGearRules(ctx, profile.ID, rules)
+			if err != nil {
+				logger.AddParam("error", err).Warn("Failed to store seeded gear rules")
+			}
+			seeded = err == nil
+		}
+		for _, g := range athlete.Shoes {
+			gearList = append(gearList, describeGear("Shoes", g))
+		}
+		for _, g := range athlete.Bikes {
+			gearList = append(gearList, describeGear("Bike", g))
+		}
+		logger.Info("Seeded gear rules", "shoes", len(athlete.Shoes), "bikes", len(athlete.Bikes), "rules", len(rules))
+	}
+
+	if first {
+		_, err = h.snsClient.Publish(ctx, &sns.PublishInput{
+			TopicArn: aws.String(h.topicArn),
+			Message:  aws.String(welcomeMessage(profile.Name(), athlete != nil, gearList, seeded)),
+			Subject:  aws.String("Welcome to Strava gear checks"),
+		})
+		if err != nil {
+			logger.AddParam("error", err).Warn("Failed to send welcome notification")
+		}
+	}
+	return gearList
+}
+
+// needsRules reports whether onboarding should be retried for an athlete who connected before
+func (h *lambdaHandler) needsRules(ctx *handler.Context, athleteID int64) bool {
+	athlete, err := h.athletesClient.GetAthlete(ctx, athleteID)
+	if err != nil {
+		ctx.GetLogger().AddParam("error", err).Warn("Failed to get stored athlete")
+		return false
+	}
+	return athlete.GearRules == nil
+}
+
+// seedRules allows the athlete's active shoes for foot sports and active bikes for ride sports. Activities which fail
+// a rule are given the primary gear. Sports are left unchecked if the athlete has no active gear for them
+func seedRules(athlete *stravaapi.DetailedAthlete) gear.Rules {
+	rules := gear.Rules{}
+	addRules(rules, shoeSports, athlete.Shoes)
+	addRules(rules, bikeSports, athlete.Bikes)
+	return rules
+}
+
+func addRules(rules gear.Rules, sportTypes []sports.Sport, items []stravaapi.Gear) {
+	var rule gear.Rule
+	for _, g := range items {
+		if g.Retired {
+			continue
+		}
+		rule.Allowed = append(rule.Allowed, g.ID)
+		if g.Primary {
+			rule.Use = g.ID
+		}
+	}
+	if len(rule.Allowed) == 0 {
+		return
+	}
+	for _, sport := range sportTypes {
+		rules[sport] = rule
+	}
+}
+
+func describeGear(kind string, g stravaapi.Gear) string {
+	s := fmt.Sprintf("%s: %s (%s)", kind, g.Name, g.ID)
+	if g.Primary {
+		s += ", primary"
+	}
+	if g.Retired {
+		s += ", retired"
+	}
+	return s
+}
+
+func welcomeMessage(athleteName string, gearRead bool, gearList []string, seeded bool) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Welcome %s. Your Strava activities will now be checked for the correct gear.\n\n", athleteName))
+	if !gearRead {
+		sb.WriteString("Your gear could not be read from Strava, so your gear rules have not been set up. Authorize again to retry, or set them with the gear rules API.")
+		return sb.String()
+	}
+	if len(gearList) == 0 {
+		sb.WriteString("No shoes or bikes were found on your Strava account. Add your gear on Strava and authorize again, or set your gear rules with the gear rules API.")
+		return sb.String()
+	}
+
+	sb.WriteString("Gear found on your Strava account:\n")
+	for _, g := range gearList {
+		sb.WriteString("- " + g + "\n")
+	}
+	if seeded {
+		sb.WriteString("\nYour gear rules allow your active shoes for runs, walks and hikes and your active bikes for rides. Activities with other gear are given your primary gear. Change the rules with the gear rules API.")
+	} else {
+		sb.WriteString("\nYour gear rules were not set up. Authorize again to retry, or set them with the gear rules API.")
+	}
+	return sb.String()
+}
+
+// ensureSubscription requests a webhook subscription if the app does not have one, so that new activities are
+// checked. Strava allows one subscription for each app, which is created by the subscribe lambda
+func (h *lambdaHandler) ensureSubscription(ctx *handler.Context, athleteID int64) {
+	logger := ctx.GetLogger()
+
+	//Listing subscriptions uses the app credentials, not the athlete's tokens
+	subscriptions, err := h.newStravaAPI(athleteID).ListSubscriptions(ctx)
+	if err != nil {
+		logger.AddParam("error", err).Warn("Failed to list webhook subscriptions")
+		return
+	}
+	if len(subscriptions) > 0 {
+		return
+	}
+
+	res, err := h.ebClient.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{{
+			Detail:     aws.String("{}"),
+			DetailType: aws.String(subscriptionRequested),
+			Source:     aws.String(webhook.Source),
+		}},
+	})
+	if err == nil && res.FailedEntryCount > 0 {
+		err = fmt.Errorf("EventBridge rejected event: %s", aws.ToString(res.Entries[0].ErrorCode))
+	}
+	if err != nil {
+		logger.AddParam("error", err).Warn("Failed to request webhook subscription")
+		return
+	}
+	logger.Info("Requested webhook subscription")
+}
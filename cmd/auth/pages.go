@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+// Each page is a template in the templates directory. layout.html holds the header and footer shared by the pages
+var pages = template.Must(template.ParseFS(templateFiles, "templates/*.html"))
+
+const (
+	pageSuccess = "success.html"
+	pageDenied  = "denied.html"
+	pageRetry   = "retry.html"
+	pageError   = "error.html"
+)
+
+// page holds the values shown on a page. Gear is only set when a new athlete is onboarded. APIKey is only shown once,
+// as just its hash is stored. RetryURL is relative to the callback URL, so it works for any API stage
+type page struct {
+	Title         string
+	Message       string
+	AthleteName   string
+	Scopes        []string
+	Missing       []string
+	Gear          []string
+	APIKey        string
+	RetryURL      string
+	CorrelationID string
+}
+
+func renderPage(status int, name string, p page) events.APIGatewayV2HTTPResponse {
+	var buf bytes.Buffer
+	err := pages.ExecuteTemplate(&buf, name, p)
+	if err != nil {
+		//The templates are fixed, so this only happens if a template refers to a missing field
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: http.StatusInternalServerError,
+			Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+			Body:       "Something went wrong",
+		}
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: status,
+		Headers: map[string]string{
+			"Content-Type":            "text/html; charset=utf-8",
+			"Content-Security-Policy": "default-src 'none'; style-src 'unsafe-inline'",
+		},
+		Body: buf.String(),
+	}
+}
+
+// serverError shows the correlation ID, which is logged with the error
+func serverError(access string, correlationID string) events.APIGatewayV2HTTPResponse {
+	return renderPage(http.StatusInternalServerError, pageError, page{Title: "Something went wrong", RetryURL: retryURL(access), CorrelationID: correlationID})
+}
+
+// retryURL returns the link which starts the authorization again with the same access level
+func retryURL(access string) string {
+	if access == "" || access == accessRead {
+		return "connect"
+	}
+	return "connect?access=" + access
+}
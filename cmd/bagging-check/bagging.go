@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/ockendenjo/strava-shoes/pkg/geo"
+	"github.com/ockendenjo/strava-shoes/pkg/hills"
+)
+
+// hillFinder finds the hills bagged on a route using a spatial index of the summits
+type hillFinder struct {
+	hills []hills.Hill
+	index *geo.Index
+}
+
+func newHillFinder(hillList []hills.Hill) *hillFinder {
+	summits := make([]geo.Point, 0, len(hillList))
+	for _, hill := range hillList {
+		summits = append(summits, hill.Point())
+	}
+	return &hillFinder{hills: hillList, index: geo.NewIndex(summits, geo.DefaultCellSize)}
+}
+
+// find returns the hills with a summit within radius metres of the route
+func (f *hillFinder) find(route []geo.Point, radius float64) []hills.Hill {
+	var bagged []hills.Hill
+	for _, i := range f.index.WithinRoute(route, radius) {
+		bagged = append(bagged, f.hills[i])
+	}
+	return bagged
+}
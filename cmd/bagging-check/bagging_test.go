@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ockendenjo/strava-shoes/pkg/geo"
+	"github.com/ockendenjo/strava-shoes/pkg/hills"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_hillFinder(t *testing.T) {
+	finder := newHillFinder([]hills.Hill{
+		{ID: 1, Name: "Arthur's Seat", Lat: 55.94411, Lon: -3.16184},
+		{ID: 2, Name: "Ben Nevis", Lat: 56.79685, Lon: -5.0036},
+	})
+
+	testcases := []struct {
+		name   string
+		route  []geo.Point
+		radius float64
+		expIDs []int
+	}{
+		{
+			name:  "no route",
+			route: nil,
+		},
+		{
+			name:   "route over summit",
+			route:  []geo.Point{{Lat: 55.9450, Lon: -3.1650}, {Lat: 55.94415, Lon: -3.16190}, {Lat: 55.9430, Lon: -3.1600}},
+			radius: 50,
+			expIDs: []int{1},
+		},
+		{
+			name:   "route passes outside radius",
+			route:  []geo.Point{{Lat: 55.9480, Lon: -3.1650}, {Lat: 55.9460, Lon: -3.1600}},
+			radius: 50,
+		},
+		{
+			name:   "larger radius",
+			route:  []geo.Point{{Lat: 55.9480, Lon: -3.1650}, {Lat: 55.9460, Lon: -3.1600}},
+			radius: 400,
+			expIDs: []int{1},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			bagged := finder.find(tc.route, tc.radius)
+			var ids []int
+			for _, h := range bagged {
+				ids = append(ids, h.ID)
+			}
+			assert.Equal(t, tc.expIDs, ids)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/ockendenjo/strava-shoes/pkg/hills"
+)
+
+const baggedPrefix = "⛰ Bagged:"
+
+// describeBags returns the activity description with a line listing the bagged hills. Any previous line is replaced
+// so that checking an activity again does not repeat it
+func describeBags(description string, bagged []hills.Hill) string {
+	var lines []string
+	if description != "" {
+		for line := range strings.SplitSeq(description, "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), baggedPrefix) {
+				lines = append(lines, line)
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(bagged) > 0 {
+		names := make([]string, 0, len(bagged))
+		for _, hill := range bagged {
+			names = append(names, hill.Name)
+		}
+		lines = append(lines, baggedPrefix+" "+strings.Join(names, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
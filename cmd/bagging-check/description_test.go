@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ockendenjo/strava-shoes/pkg/hills"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_describeBags(t *testing.T) {
+	bagged := []hills.Hill{{ID: 2, Name: "Ben Lomond"}, {ID: 3, Name: "Ben Vorlich"}}
+
+	testcases := []struct {
+		name        string
+		description string
+		bagged      []hills.Hill
+		exp         string
+	}{
+		{
+			name:   "empty description",
+			bagged: bagged,
+			exp:    "⛰ Bagged: Ben Lomond, Ben Vorlich",
+		},
+		{
+			name:        "appended to description",
+			description: "Windy on top\n",
+			bagged:      bagged,
+			exp:         "Windy on top\n⛰ Bagged: Ben Lomond, Ben Vorlich",
+		},
+		{
+			name:        "previous line replaced",
+			description: "Windy on top\n⛰ Bagged: Ben Lomond\n\n",
+			bagged:      bagged,
+			exp:         "Windy on top\n⛰ Bagged: Ben Lomond, Ben Vorlich",
+		},
+		{
+			name:        "line moved to end after edit",
+			description: "⛰ Bagged: Ben Lomond, Ben Vorlich\nWindy on top",
+			bagged:      bagged,
+			exp:         "Windy on top\n⛰ Bagged: Ben Lomond, Ben Vorlich",
+		},
+		{
+			name:        "re-run is unchanged",
+			description: "Windy on top\n⛰ Bagged: Ben Lomond, Ben Vorlich",
+			bagged:      bagged,
+			exp:         "Windy on top\n⛰ Bagged: Ben Lomond, Ben Vorlich",
+		},
+		{
+			name:        "no hills",
+			description: "Windy on top",
+			exp:         "Windy on top",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp, describeBags(tc.description, tc.bagged))
+		})
+	}
+}
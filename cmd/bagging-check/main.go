@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-xray-sdk-go/v2/xray"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/athletes"
+	"github.com/ockendenjo/strava-shoes/pkg/bagging"
+	"github.com/ockendenjo/strava-shoes/pkg/bags"
+	"github.com/ockendenjo/strava-shoes/pkg/hills"
+	"github.com/ockendenjo/strava-shoes/pkg/settings"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+)
+
+type H = handler.Handler[events.CloudWatchEvent, any]
+
+func main() {
+	athletesDb := handler.MustGetEnv("ATHLETES_DB")
+	bagsDb := handler.MustGetEnv("BAGS_DB")
+	settingsDb := handler.MustGetEnv("SETTINGS_DB")
+	baggingDb := handler.MustGetEnv("BAGGING_DB")
+	baggingTTL := time.Duration(handler.MustGetEnvInt("BAGGING_TTL_DAYS")) * 24 * time.Hour
+	radius := handler.MustGetEnvFloat("BAG_RADIUS_METRES")
+	datasetBucket := handler.GetEnv("HILLS_DATASET_BUCKET")
+	datasetKey := handler.GetEnv("HILLS_DATASET_KEY")
+
+	handler.BuildAndStart(func(awsConfig aws.Config) H {
+		dataset, err := hills.Load(context.Background(), s3.NewFromConfig(awsConfig), datasetBucket, datasetKey)
+		if err != nil {
+			panic(err)
+		}
+
+		ssmStore := stravaapi.NewSSMStore(ssm.NewFromConfig(awsConfig))
+		httpClient := &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: xray.RoundTripper(http.DefaultTransport),
+		}
+
+		dbClient := dynamodb.NewFromConfig(awsConfig)
+		athletesClient := athletes.NewClient(dbClient, athletesDb)
+		h := &lambdaHandler{
+			athletesClient: athletesClient,
+			newStravaAPI: func(athleteID int64) stravaapi.Client {
+				return stravaapi.NewClient(httpClient, ssmStore, athletes.NewTokenStore(athletesClient, athleteID))
+			},
+			bagsClient:     bags.NewClient(dbClient, bagsDb),
+			baggingClient:  bagging.NewClient(dbClient, baggingDb, baggingTTL),
+			settingsClient: settings.NewClient(dbClient, settingsDb),
+			dataset:        dataset,
+			finder:         newHillFinder(dataset.Hills),
+			radius:         radius,
+		}
+		return h.handle
+	})
+}
+
+type lambdaHandler struct {
+	athletesClient athletes.Client
+	newStravaAPI   func(athleteID int64) stravaapi.Client
+	bagsClient     bags.Client
+	baggingClient  bagging.Client
+	settingsClient settings.Client
+	dataset        *hills.Dataset
+	finder         *hillFinder
+	radius         float64
+}
+
+func (h *lambdaHandler) handle(ctx *handler.Context, event events.CloudWatchEvent) (any, error) {
+	logger := ctx.GetLogger()
+
+	var detail bagging.CheckEvent
+	err := json.Unmarshal(event.Detail, &detail)
+	if err != nil || detail.ID < 1 || detail.AthleteID < 1 {
+		//Retrying will not help
+		logger.AddParam("detail", string(event.Detail)).Error("Invalid bagging check event")
+		return nil, nil
+	}
+	logger.AddParam("activityId", detail.ID).AddParam("athleteId", detail.AthleteID).AddParam("datasetVersion", h.dataset.Version)
+
+	stravaAPI := h.newStravaAPI(detail.AthleteID)
+	activity, err := stravaAPI.GetActivitySummary(ctx, detail.ID)
+	if errors.Is(err, athletes.ErrNotFound) {
+		logger.Info("Ignoring check for athlete who is not connected")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting activity %d: %w", detail.ID, err)
+	}
+
+	route, err := stravaAPI.GetLatLngStream(ctx, detail.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting stream for activity %d: %w", detail.ID, err)
+	}
+
+	bagged := h.finder.find(route, h.radius)
+	for _, hill := range bagged {
+		err = h.bagsClient.PutBag(ctx, bags.Bag{
+			AthleteID:  activity.Athlete.ID,
+			HillID:     hill.ID,
+			HillName:   hill.Name,
+			ActivityID: activity.ID,
+			Date:       activity.StartDate,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error storing bag of %s for activity %d: %w", hill.Name, detail.ID, err)
+		}
+	}
+
+	logger.AddParam("points", len(route)).AddParam("bagged", len(bagged))
+	if len(bagged) > 0 {
+		err = h.updateDescription(ctx, stravaAPI, activity, bagged)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = h.baggingClient.PutRecord(ctx, bagging.Record{
+		ID:             activity.ID,
+		AthleteID:      detail.AthleteID,
+		CheckedAt:      time.Now(),
+		DatasetVersion: h.dataset.Version,
+		BagCount:       len(bagged),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error storing bagging record for activity %d: %w", activity.ID, err)
+	}
+
+	logger.Info("Bagging check complete")
+	return nil, nil
+}
+
+// updateDescription adds the bagged hills to the activity description if the athlete has turned this on
+func (h *lambdaHandler) updateDescription(ctx *handler.Context, stravaAPI stravaapi.Client, activity *stravaapi.ActivitySummary, bagged []hills.Hill) error {
+	logger := ctx.GetLogger()
+
+	athleteSettings, err := h.settingsClient.GetSettings(ctx, activity.Athlete.ID)
+	if err != nil {
+		return fmt.Errorf("error getting settings for athlete %d: %w", activity.Athlete.ID, err)
+	}
+	if !athleteSettings.DescribeBags {
+		return nil
+	}
+
+	athlete, err := h.athletesClient.GetAthlete(ctx, activity.Athlete.ID)
+	if err != nil {
+		return fmt.Errorf("error getting athlete %d: %w", activity.Athlete.ID, err)
+	}
+	if !athlete.HasScope(stravaapi.ScopeActivityWrite) {
+		logger.Warn("Athlete has not granted activity:write so the description cannot be updated")
+		return nil
+	}
+
+	description := describeBags(activity.Description, bagged)
+	if description == activity.Description {
+		logger.Info("Activity description already lists bagged hills")
+		return nil
+	}
+
+	err = stravaAPI.UpdateActivity(ctx, activity.ID, stravaapi.ActivityUpdate{Description: &description})
+	if errors.Is(err, stravaapi.ErrUnauthorized) {
+		//Retrying will not help if the token does not have the activity:write scope
+		logger.AddParam("error", err).Warn("Not authorized to update activity description")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error updating description of activity %d: %w", activity.ID, err)
+	}
+	logger.Info("Activity description updated")
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/apikey"
+	"github.com/ockendenjo/strava-shoes/pkg/bagreport"
+	"github.com/ockendenjo/strava-shoes/pkg/bags"
+	"github.com/ockendenjo/strava-shoes/pkg/hills"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+)
+
+type apiHandler = handler.Handler[events.APIGatewayV2HTTPRequest, events.APIGatewayV2HTTPResponse]
+
+func main() {
+	bagsDb := handler.MustGetEnv("BAGS_DB")
+	datasetBucket := handler.GetEnv("HILLS_DATASET_BUCKET")
+	datasetKey := handler.GetEnv("HILLS_DATASET_KEY")
+
+	handler.BuildAndStart(func(awsConfig aws.Config) apiHandler {
+		dataset, err := hills.Load(context.Background(), s3.NewFromConfig(awsConfig), datasetBucket, datasetKey)
+		if err != nil {
+			panic(err)
+		}
+		bagsClient := bags.NewClient(dynamodb.NewFromConfig(awsConfig), bagsDb)
+		return getHandler(bagsClient, stravaapi.NewSSMStore(ssm.NewFromConfig(awsConfig)), dataset)
+	})
+}
+
+// getHandler serves GET /bagging?athlete=<id>&format=<progress|geojson|kml>&class=<classification>. The report links
+// to the athlete's activities, so the request must have the API key
+func getHandler(bagsClient bags.Client, apiKeyGetter apikey.Getter, dataset *hills.Dataset) apiHandler {
+	return func(ctx *handler.Context, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		logger := ctx.GetLogger()
+
+		authorized, err := apikey.IsAuthorized(ctx, apiKeyGetter, event.Headers)
+		if err != nil {
+			logger.AddParam("error", err).Error("Failed to get API key")
+			return getResponse(http.StatusInternalServerError, "text/plain", "Something went wrong"), nil
+		}
+		if !authorized {
+			logger.AddParam("sourceIp", event.RequestContext.HTTP.SourceIP).Warn("Rejected request without a valid API key")
+			return getResponse(http.StatusUnauthorized, "text/plain", "A valid API key is required"), nil
+		}
+
+		athleteID, err := strconv.ParseInt(event.QueryStringParameters["athlete"], 10, 64)
+		if err != nil {
+			return getResponse(http.StatusBadRequest, "text/plain", "Query string parameter 'athlete' must be a Strava athlete ID"), nil
+		}
+		format := event.QueryStringParameters["format"]
+		class := event.QueryStringParameters["class"]
+		logger.AddParam("athleteId", athleteID).AddParam("format", format)
+
+		bagList, err := bagsClient.GetBags(ctx, athleteID)
+		if err != nil {
+			logger.AddParam("error", err).Error("Failed to load bags")
+			return getResponse(http.StatusInternalServerError, "text/plain", "Something went wrong"), nil
+		}
+		report := bagreport.New(dataset, bagList, class)
+
+		switch strings.ToLower(format) {
+		case "", "progress":
+			b, err := json.Marshal(progressResponse{DatasetVersion: report.DatasetVersion, Progress: report.Progress()})
+			if err != nil {
+				return events.APIGatewayV2HTTPResponse{}, err
+			}
+			return getResponse(http.StatusOK, "application/json", string(b)), nil
+		case "geojson":
+			b, err := report.GeoJSON()
+			if err != nil {
+				return events.APIGatewayV2HTTPResponse{}, err
+			}
+			return getResponse(http.StatusOK, "application/geo+json", string(b)), nil
+		case "kml":
+			b, err := report.KML()
+			if err != nil {
+				return events.APIGatewayV2HTTPResponse{}, err
+			}
+			return getResponse(http.StatusOK, "application/vnd.google-earth.kml+xml", string(b)), nil
+		default:
+			return getResponse(http.StatusBadRequest, "text/plain", "Query string parameter 'format' must be progress, geojson or kml"), nil
+		}
+	}
+}
+
+type progressResponse struct {
+	DatasetVersion string                    `json:"datasetVersion"`
+	Progress       []bagreport.ClassProgress `json:"progress"`
+}
+
+func getResponse(code int, contentType string, body string) events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: code,
+		Headers:    map[string]string{"Content-Type": contentType},
+		Body:       body,
+	}
+}
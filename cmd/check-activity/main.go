@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-xray-sdk-go/v2/xray"
+	"github.com/aws/jsii-runtime-go"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/athletes"
+	"github.com/ockendenjo/strava-shoes/pkg/gear"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+	"github.com/ockendenjo/strava-shoes/pkg/webhook"
+)
+
+type H = handler.Handler[events.CloudWatchEvent, any]
+
+func main() {
+	rules, err := gear.ParseRules([]byte(handler.MustGetEnv("GEAR_RULES")))
+	if err != nil {
+		panic(err)
+	}
+	topicArn := handler.MustGetEnv("TOPIC_ARN")
+	athletesDb := handler.MustGetEnv("ATHLETES_DB")
+
+	handler.BuildAndStart(func(awsConfig aws.Config) H {
+		ssmStore := stravaapi.NewSSMStore(ssm.NewFromConfig(awsConfig))
+		athletesClient := athletes.NewClient(dynamodb.NewFromConfig(awsConfig), athletesDb)
+		httpClient := &http.Client{
+			Timeout:   3 * time.Second,
+			Transport: xray.RoundTripper(http.DefaultTransport),
+		}
+
+		h := &lambdaHandler{
+			athletesClient: athletesClient,
+			newStravaAPI: func(athleteID int64) stravaapi.Client {
+				return stravaapi.NewClient(httpClient, ssmStore, athletes.NewTokenStore(athletesClient, athleteID))
+			},
+			snsClient: sns.NewFromConfig(awsConfig),
+			rules:     rules,
+			topicArn:  topicArn,
+		}
+		return h.handle
+	})
+}
+
+type lambdaHandler struct {
+	athletesClient athletes.Client
+	newStravaAPI   func(athleteID int64) stravaapi.Client
+	snsClient      *sns.Client
+	// rules and topicArn are used for athletes who have not set their own
+	rules    gear.Rules
+	topicArn string
+}
+
+// handle checks the gear of a single activity when Strava sends a webhook event for it
+func (h *lambdaHandler) handle(ctx *handler.Context, event events.CloudWatchEvent) (any, error) {
+	logger := ctx.GetLogger()
+
+	webhookEvent, err := webhook.Parse(event.Detail)
+	if err != nil {
+		//Retrying will not help
+		logger.AddParam("error", err).Error("Invalid webhook event")
+		return nil, nil
+	}
+	logger.AddParam("webhookEvent", webhookEvent)
+
+	if webhookEvent.ObjectType != webhook.ObjectTypeActivity {
+		logger.Info("Ignoring non-activity event")
+		return nil, nil
+	}
+	if webhookEvent.AspectType != webhook.AspectTypeCreate && webhookEvent.AspectType != webhook.AspectTypeUpdate {
+		logger.Info("Ignoring activity event")
+		return nil, nil
+	}
+
+	athlete, err := h.athletesClient.GetAthlete(ctx, webhookEvent.OwnerID)
+	if errors.Is(err, athletes.ErrNotFound) {
+		logger.Info("Ignoring event for athlete who is not connected")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting athlete %d: %w", webhookEvent.OwnerID, err)
+	}
+
+	activity, err := h.newStravaAPI(athlete.ID).GetActivity(ctx, webhookEvent.ObjectID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting activity %d: %w", webhookEvent.ObjectID, err)
+	}
+
+	violation := athlete.RulesOr(h.rules).Check(activity)
+	if violation == nil {
+		logger.Info("Activity gear OK")
+		return nil, nil
+	}
+	logger.Warn("Activity failed gear rule", "activity", activity, "violation", violation)
+
+	msg := fmt.Sprintf("%s (%s) https://www.strava.com/activities/%d - %s", activity.Name, activity.SportType, activity.ID, violation)
+	_, err = h.snsClient.Publish(ctx, &sns.PublishInput{
+		TopicArn: jsii.String(athlete.TopicArnOr(h.topicArn)),
+		Message:  jsii.String(msg),
+		Subject:  jsii.String("Strava activity with incorrect gear"),
+	})
+	return nil, err
+}
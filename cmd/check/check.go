@@ -2,89 +2,78 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"slices"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
-	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
 	"github.com/ockendenjo/strava"
 	"github.com/ockendenjo/strava-shoes/pkg/bagging"
-	"github.com/ockendenjo/strava/sports"
+	"github.com/ockendenjo/strava-shoes/pkg/gear"
 )
 
-func buildCheckActivityFunc(gearIds []string, client bagging.Client, ebClient *eventbridge.Client) checkActivityFn {
-	sportTypes := []sports.Sport{sports.Run, sports.Hike, sports.Walk, sports.Ride}
-	isGearOk := getCheckFn(sportTypes, gearIds)
-
-	return func(ctx context.Context, activity *strava.Activity, ch chan checkActivityResult) {
-		gearOk := isGearOk(activity)
-		result := checkActivityResult{
-			gearOk:   gearOk,
-			activity: activity,
+// checkRules returns the activities which fail a gear rule
+func checkRules(rules gear.Rules, activities []strava.Activity) []activityViolation {
+	var violations []activityViolation
+	for i := range activities {
+		activity := &activities[i]
+		if violation := rules.Check(activity); violation != nil {
+			violations = append(violations, activityViolation{activity: activity, violation: violation})
 		}
+	}
+	return violations
+}
 
-		checked, err := client.HasId(ctx, activity.ID)
-		if err != nil {
-			result.err = fmt.Errorf("error checking ID %d in bagging DB: %w", activity.ID, err)
-			ch <- result
-			return
-		}
+type baggingSender struct {
+	client   bagging.Client
+	ebClient *eventbridge.Client
+}
 
-		if checked {
-			ch <- result
-			return
-		}
+// send emits a StravaActivityBaggingCheck event for each of the athlete's activities which has not been sent before and
+// returns the number of events sent. Activities are claimed before publishing so that overlapping checks do not send an
+// activity twice
+func (s *baggingSender) send(ctx context.Context, athleteID int64, activities []strava.Activity) (int, error) {
+	ids := make([]int64, 0, len(activities))
+	for _, activity := range activities {
+		ids = append(ids, activity.ID)
+	}
 
-		res, err := ebClient.PutEvents(ctx, &eventbridge.PutEventsInput{
-			Entries: []types.PutEventsRequestEntry{{
-				Source:     aws.String("io.ockenden.strava"),
-				DetailType: aws.String("StravaActivityBaggingCheck"),
-				Detail:     aws.String(fmt.Sprintf(`{"id": %d}`, activity.ID)),
-			}},
-		})
-		if err != nil {
-			result.err = fmt.Errorf("error sending EventBridge event for ID %d: %w", activity.ID, err)
-			ch <- result
-			return
-		}
-		if res.FailedEntryCount > 0 {
-			result.err = fmt.Errorf("error sending EventBridge event for ID %d: failed", activity.ID)
-			ch <- result
-			return
-		}
+	sent, err := s.client.HasIds(ctx, ids)
+	if err != nil {
+		return 0, fmt.Errorf("error checking IDs in bagging DB: %w", err)
+	}
 
-		err = client.PutId(ctx, activity.ID)
-		if err != nil {
-			result.err = fmt.Errorf("error putting ID %d in bagging DB: %w", activity.ID, err)
-			ch <- result
-			return
+	var unsent []int64
+	for _, id := range ids {
+		if !sent[id] {
+			unsent = append(unsent, id)
 		}
+	}
+	claimed, err := s.client.Claim(ctx, unsent)
+	if err != nil {
+		return 0, fmt.Errorf("error claiming IDs in bagging DB: %w", err)
+	}
 
-		ch <- result
+	published, failed, err := bagging.SendChecks(ctx, s.ebClient, athleteID, claimed)
+	errs := []error{err}
+	if len(failed) > 0 {
+		//Release the claims so that the next check retries the activities
+		errs = append(errs, s.release(ctx, failed))
 	}
-}
 
-type checkActivityResult struct {
-	gearOk   bool
-	err      error
-	activity *strava.Activity
+	err = s.client.PutIds(ctx, published)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error confirming IDs in bagging DB: %w", err))
+	}
+	return len(published), errors.Join(errs...)
 }
 
-type checkActivityFn func(ctx context.Context, activity *strava.Activity, ch chan checkActivityResult)
-
-func getCheckFn(sportTypes []sports.Sport, gearIds []string) func(a *strava.Activity) bool {
-
-	return func(a *strava.Activity) bool {
-		if !slices.Contains(sportTypes, sports.Sport(a.SportType)) {
-			//Sport type is ignored
-			return true
-		}
-
-		if a.GearID == "" {
-			return false
+func (s *baggingSender) release(ctx context.Context, ids []int64) error {
+	var errs []error
+	for _, id := range ids {
+		err := s.client.Release(ctx, id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error releasing ID %d in bagging DB: %w", id, err))
 		}
-
-		return !slices.Contains(gearIds, a.GearID)
 	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ockendenjo/strava"
+	"github.com/ockendenjo/strava-shoes/pkg/gear"
+	"github.com/ockendenjo/strava-shoes/pkg/gearaudit"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+)
+
+type fixMode string
+
+const (
+	fixModeOff    fixMode = "off"
+	fixModeDryRun fixMode = "dryRun"
+	fixModeApply  fixMode = "apply"
+)
+
+func parseFixMode(s string) (fixMode, error) {
+	switch m := fixMode(s); m {
+	case fixModeOff, fixModeDryRun, fixModeApply:
+		return m, nil
+	case "":
+		return fixModeOff, nil
+	default:
+		return "", fmt.Errorf("invalid fix mode '%s'", s)
+	}
+}
+
+type gearChange struct {
+	ActivityID int64  `json:"activityId"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	DryRun     bool   `json:"dryRun"`
+}
+
+func (c gearChange) String() string {
+	from := c.From
+	if from == "" {
+		from = "no gear"
+	}
+	if c.DryRun {
+		return fmt.Sprintf("would change gear from %s to %s (dry run)", from, c.To)
+	}
+	return fmt.Sprintf("changed gear from %s to %s", from, c.To)
+}
+
+type gearFixer struct {
+	stravaAPI   stravaapi.Client
+	auditClient gearaudit.Client
+}
+
+// fix assigns the gear which the failed rule says to use. It returns nil if the rule does not specify any gear
+func (f *gearFixer) fix(ctx context.Context, activity *strava.Activity, violation *gear.Violation, mode fixMode) (*gearChange, error) {
+	if mode == fixModeOff || violation.Use == "" {
+		return nil, nil
+	}
+
+	change := &gearChange{
+		ActivityID: activity.ID,
+		From:       activity.GearID,
+		To:         violation.Use,
+		DryRun:     mode == fixModeDryRun,
+	}
+	if change.DryRun {
+		return change, nil
+	}
+
+	//Record the change before making it so that every change made on Strava can be reverted
+	err := f.auditClient.PutChange(ctx, gearaudit.Change{
+		ActivityID:     activity.ID,
+		ChangedAt:      time.Now(),
+		PreviousGearID: activity.GearID,
+		NewGearID:      violation.Use,
+		Reason:         violation.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error recording gear change for ID %d: %w", activity.ID, err)
+	}
+
+	err = f.stravaAPI.UpdateActivity(ctx, activity.ID, stravaapi.ActivityUpdate{GearID: &violation.Use})
+	if err != nil {
+		return nil, fmt.Errorf("error updating gear for ID %d: %w", activity.ID, err)
+	}
+	return change, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -16,108 +17,231 @@ import (
 	"github.com/aws/jsii-runtime-go"
 	"github.com/ockendenjo/handler"
 	"github.com/ockendenjo/strava"
+	"github.com/ockendenjo/strava-shoes/pkg/athletes"
 	"github.com/ockendenjo/strava-shoes/pkg/bagging"
+	"github.com/ockendenjo/strava-shoes/pkg/gear"
+	"github.com/ockendenjo/strava-shoes/pkg/gearaudit"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
 )
 
-const maxParallel = 10
-
 type H = handler.Handler[CheckActivitiesEvent, any]
 
 func main() {
-	gearIds := mustGetSliceEnv("GEAR_IDS")
+	rules, err := gear.ParseRules([]byte(handler.MustGetEnv("GEAR_RULES")))
+	if err != nil {
+		panic(err)
+	}
 	topicArn := handler.MustGetEnv("TOPIC_ARN")
+	athletesDb := handler.MustGetEnv("ATHLETES_DB")
 	baggingDb := handler.MustGetEnv("BAGGING_DB")
+	baggingTTL := time.Duration(handler.MustGetEnvInt("BAGGING_TTL_DAYS")) * 24 * time.Hour
+	gearChangesDb := handler.MustGetEnv("GEAR_CHANGES_DB")
+	defaultFixMode, err := parseFixMode(handler.GetEnv("FIX_MODE"))
+	if err != nil {
+		panic(err)
+	}
 
 	handler.BuildAndStart(func(awsConfig aws.Config) H {
-		ssmClient := ssm.NewFromConfig(awsConfig)
-		ebClient := eventbridge.NewFromConfig(awsConfig)
-		baggingClient := bagging.NewClient(dynamodb.NewFromConfig(awsConfig), baggingDb)
-		checkActivity := buildCheckActivityFunc(gearIds, baggingClient, ebClient)
-
+		dbClient := dynamodb.NewFromConfig(awsConfig)
+		ssmStore := stravaapi.NewSSMStore(ssm.NewFromConfig(awsConfig))
+		athletesClient := athletes.NewClient(dbClient, athletesDb)
 		httpClient := &http.Client{
 			Timeout:   3 * time.Second,
 			Transport: xray.RoundTripper(http.DefaultTransport),
 		}
-		stravaClient := strava.NewClient(ssmClient, httpClient)
-
-		snsClient := sns.NewFromConfig(awsConfig)
 
-		return getHandler(stravaClient, snsClient, checkActivity, topicArn)
+		c := &checker{
+			athletesClient: athletesClient,
+			newStravaAPI: func(athleteID int64) stravaapi.Client {
+				return stravaapi.NewClient(httpClient, ssmStore, athletes.NewTokenStore(athletesClient, athleteID))
+			},
+			snsClient: sns.NewFromConfig(awsConfig),
+			sender: &baggingSender{
+				client:   bagging.NewClient(dbClient, baggingDb, baggingTTL),
+				ebClient: eventbridge.NewFromConfig(awsConfig),
+			},
+			auditClient:    gearaudit.NewClient(dbClient, gearChangesDb),
+			rules:          rules,
+			defaultFixMode: defaultFixMode,
+			topicArn:       topicArn,
+		}
+		return c.handle
 	})
 }
 
-func getHandler(stravaClient strava.Client, snsClient *sns.Client, checkActivity checkActivityFn, topicArn string) H {
-	return func(ctx *handler.Context, event CheckActivitiesEvent) (any, error) {
-		logger := ctx.GetLogger()
+type checker struct {
+	athletesClient athletes.Client
+	newStravaAPI   func(athleteID int64) stravaapi.Client
+	snsClient      *sns.Client
+	sender         *baggingSender
+	auditClient    gearaudit.Client
+	// rules and topicArn are used for athletes who have not set their own
+	rules          gear.Rules
+	defaultFixMode fixMode
+	topicArn       string
+}
 
-		page := max(event.Page, 1)
+// handle checks the activities of every connected athlete, or of the athlete in the event. An athlete whose check
+// fails does not stop the others being checked
+func (c *checker) handle(ctx *handler.Context, event CheckActivitiesEvent) (any, error) {
+	logger := ctx.GetLogger()
 
-		//Load activities
-		activities, err := stravaClient.GetActivities(ctx, page)
+	mode := c.defaultFixMode
+	if event.FixMode != "" {
+		m, err := parseFixMode(event.FixMode)
 		if err != nil {
 			return nil, err
 		}
+		mode = m
+	}
+
+	var connected []athletes.Athlete
+	if event.AthleteID > 0 {
+		athlete, err := c.athletesClient.GetAthlete(ctx, event.AthleteID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting athlete %d: %w", event.AthleteID, err)
+		}
+		connected = append(connected, *athlete)
+	} else {
+		var err error
+		connected, err = c.athletesClient.ListAthletes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing athletes: %w", err)
+		}
+	}
 
-		var messages []string
-
-		ch := make(chan checkActivityResult, maxParallel)
-		remaining := 0
-		var parrallelError error
-
-		readChan := func() {
-			res := <-ch
-			remaining--
-			if res.err != nil {
-				parrallelError = res.err
-			}
-			activity := res.activity
-			if !res.gearOk {
-				logger.Warn("Activity with missing gear", "activity", activity)
-				msg := fmt.Sprintf("%s (%s) https://www.strava.com/activities/%d", activity.Name, activity.SportType, activity.ID)
-				messages = append(messages, msg)
-			}
+	result := &checkResult{FixMode: mode, Athletes: []*checkReport{}}
+	var errs []error
+	for _, athlete := range connected {
+		report, err := c.checkAthlete(ctx, &athlete, event, mode)
+		if err != nil {
+			logger.Error("Athlete check failed", "athleteId", athlete.ID, "error", err)
+			report.Error = err.Error()
+			errs = append(errs, fmt.Errorf("athlete %d: %w", athlete.ID, err))
 		}
+		result.Athletes = append(result.Athletes, report)
+	}
+
+	//Fail the invocation only if no athlete could be checked, so that one athlete cannot cause the others to be retried
+	if len(errs) > 0 && len(errs) == len(connected) {
+		return nil, errors.Join(errs...)
+	}
+	return result, nil
+}
 
-		for i, activity := range activities {
-			go checkActivity(ctx, &activity, ch)
-			remaining++
+// checkAthlete checks the athlete's activities against their gear rules and sends a notification listing the
+// activities which fail a rule. The returned report is never nil
+func (c *checker) checkAthlete(ctx *handler.Context, athlete *athletes.Athlete, event CheckActivitiesEvent, mode fixMode) (*checkReport, error) {
+	logger := ctx.GetLogger()
+	report := &checkReport{AthleteID: athlete.ID}
+	if athlete.Err != nil {
+		return report, athlete.Err
+	}
+	rules := athlete.RulesOr(c.rules)
+	stravaAPI := c.newStravaAPI(athlete.ID)
+	fixer := &gearFixer{stravaAPI: stravaAPI, auditClient: c.auditClient}
+	if mode == fixModeApply && !athlete.HasScope(stravaapi.ScopeActivityWrite) {
+		logger.Warn("Athlete has not granted activity:write so gear changes are a dry run", "athleteId", athlete.ID)
+		mode = fixModeDryRun
+	}
 
-			if i > maxParallel {
-				readChan()
-			}
+	for page := max(event.Page, 1); ; page++ {
+		//Load activities
+		activities, err := stravaAPI.GetActivities(ctx, stravaapi.ActivitiesQuery{Page: page, After: event.After, Before: event.Before})
+		if err != nil {
+			return report, err
 		}
-		for remaining > 0 {
-			readChan()
+		if len(activities) < 1 {
+			logger.Info("Empty page of activities", "athleteId", athlete.ID, "page", page)
+			break
 		}
-		if parrallelError != nil {
-			return nil, parrallelError
+		report.Pages++
+		report.Activities += len(activities)
+
+		violations := checkRules(rules, activities)
+		for _, v := range violations {
+			logger.Warn("Activity failed gear rule", "athleteId", athlete.ID, "activity", v.activity, "violation", v.violation)
 		}
+		report.Violations = append(report.Violations, violations...)
 
-		if len(messages) < 1 {
-			logger.Info("No missing gear")
-			return nil, nil
+		sent, err := c.sender.send(ctx, athlete.ID, activities)
+		report.BaggingChecks += sent
+		if err != nil {
+			return report, err
+		}
+
+		if !event.AllPages {
+			break
 		}
-		fullMessage := strings.Join(messages, "\n")
-
-		_, err = snsClient.Publish(ctx, &sns.PublishInput{
-			TopicArn: jsii.String(topicArn),
-			Message:  jsii.String(fullMessage),
-			Subject:  jsii.String("Strava activities with missing gear"),
-		})
-		return nil, err
 	}
-}
 
-func mustGetSliceEnv(key string) []string {
-	v := handler.MustGetEnv(key)
-	var a []string
-	err := json.Unmarshal([]byte(v), &a)
-	if err != nil {
-		panic(err)
+	var messages []string
+	for _, v := range report.Violations {
+		msg := fmt.Sprintf("%s (%s) https://www.strava.com/activities/%d - %s", v.activity.Name, v.activity.SportType, v.activity.ID, v.violation)
+
+		change, err := fixer.fix(ctx, v.activity, v.violation, mode)
+		if err != nil {
+			return report, err
+		}
+		if change != nil {
+			logger.Info("Activity gear fixed", "change", change)
+			report.Changes = append(report.Changes, *change)
+			msg = fmt.Sprintf("%s - %s", msg, change)
+		}
+		messages = append(messages, msg)
 	}
-	return a
+
+	if len(messages) < 1 {
+		logger.Info("No gear rule violations", "athleteId", athlete.ID, "activities", report.Activities)
+		return report, nil
+	}
+	fullMessage := strings.Join(messages, "\n")
+
+	_, err := c.snsClient.Publish(ctx, &sns.PublishInput{
+		TopicArn: jsii.String(athlete.TopicArnOr(c.topicArn)),
+		Message:  jsii.String(fullMessage),
+		Subject:  jsii.String("Strava activities with incorrect gear"),
+	})
+	return report, err
+}
+
+// checkResult is returned from the handler to summarise the check of each athlete
+type checkResult struct {
+	FixMode  fixMode        `json:"fixMode"`
+	Athletes []*checkReport `json:"athletes"`
+}
+
+// checkReport summarises the check of one athlete
+type checkReport struct {
+	AthleteID     int64               `json:"athleteId"`
+	Error         string              `json:"error,omitempty"`
+	Pages         int                 `json:"pages"`
+	Activities    int                 `json:"activities"`
+	BaggingChecks int                 `json:"baggingChecks"`
+	Violations    []activityViolation `json:"violations,omitempty"`
+	Changes       []gearChange        `json:"changes,omitempty"`
+}
+
+type activityViolation struct {
+	activity  *strava.Activity
+	violation *gear.Violation
+}
+
+func (v activityViolation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ActivityID int64 `json:"activityId"`
+		*gear.Violation
+	}{ActivityID: v.activity.ID, Violation: v.violation})
 }
 
+// CheckActivitiesEvent selects the activities to check. By default only the first page of recent activities is checked.
+// After and Before restrict the check to activities in a date range, and AllPages continues until Strava returns an empty page.
+// AthleteID restricts the check to one athlete.
 type CheckActivitiesEvent struct {
-	Page int `json:"page,omitempty"`
+	AthleteID int64     `json:"athleteId,omitempty"`
+	Page      int       `json:"page,omitempty"`
+	After     time.Time `json:"after,omitzero"`
+	Before    time.Time `json:"before,omitzero"`
+	AllPages  bool      `json:"allPages,omitempty"`
+	FixMode   string    `json:"fixMode,omitempty"`
 }
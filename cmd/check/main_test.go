@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/athletes"
+	"github.com/ockendenjo/strava-shoes/pkg/bagging"
+	"github.com/ockendenjo/strava-shoes/pkg/gear"
+	"github.com/ockendenjo/strava-shoes/pkg/gearaudit"
+	"github.com/ockendenjo/strava-shoes/pkg/localaws"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+	"github.com/ockendenjo/strava-shoes/pkg/stravafake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTopicArn = "arn:aws:sns:eu-west-1:123456789012:strava-gear"
+const testAthleteID = 1001
+
+var testStart = time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+
+type testEnv struct {
+	aws      *localaws.Server
+	db       *dynamodb.Client
+	athletes athletes.Client
+	// strava holds a fake Strava API for each athlete, as the fake serves one athlete
+	strava  map[int64]*stravafake.Server
+	checker *checker
+}
+
+// newTestEnv runs the check against fake Strava APIs and in-memory AWS services. By default runs forbid g1 and should
+// use g200
+func newTestEnv(t *testing.T) *testEnv {
+	awsServer := localaws.NewServer()
+	awsServer.PutParameter("/strava/clientId", stravafake.DefaultClientID)
+	awsServer.PutParameter("/strava/clientSecret", stravafake.DefaultClientSecret)
+	awsServer.CreateTable("strava-athletes", "AthleteID", "")
+	awsServer.CreateTable("strava-gear-changes", "ActivityID", "ChangedAt")
+	awsServer.CreateTable("strava-bagging", "ID", "")
+	awsHTTPServer := httptest.NewServer(awsServer)
+	t.Cleanup(awsHTTPServer.Close)
+	awsConfig := localaws.Config(awsHTTPServer.URL)
+
+	rules, err := gear.ParseRules([]byte(`{"Run": {"forbidden": ["g1"], "use": "g200"}, "Ride": {}}`))
+	require.NoError(t, err)
+
+	dbClient := dynamodb.NewFromConfig(awsConfig)
+	ssmStore := stravaapi.NewSSMStore(ssm.NewFromConfig(awsConfig))
+	env := &testEnv{
+		aws:      awsServer,
+		db:       dbClient,
+		athletes: athletes.NewClient(dbClient, "strava-athletes"),
+		strava:   map[int64]*stravafake.Server{},
+	}
+	env.checker = &checker{
+		athletesClient: env.athletes,
+		newStravaAPI: func(athleteID int64) stravaapi.Client {
+			return stravaapi.NewClient(env.strava[athleteID].Client(), ssmStore, athletes.NewTokenStore(env.athletes, athleteID))
+		},
+		snsClient:      sns.NewFromConfig(awsConfig),
+		sender:         &baggingSender{client: bagging.NewClient(dbClient, "strava-bagging", 0), ebClient: eventbridge.NewFromConfig(awsConfig)},
+		auditClient:    gearaudit.NewClient(dbClient, "strava-gear-changes"),
+		rules:          rules,
+		defaultFixMode: fixModeOff,
+		topicArn:       testTopicArn,
+	}
+	return env
+}
+
+// connect adds an athlete with a fake Strava API and returns the fake. The athlete grants read and write access
+// unless scopes are given
+func (e *testEnv) connect(t *testing.T, athleteID int64, scopes ...string) *stravafake.Server {
+	stravaServer := stravafake.NewServer(stravafake.Athlete{ID: athleteID, Shoes: []stravafake.Gear{{ID: "g1"}, {ID: "g200"}}})
+	t.Cleanup(stravaServer.Close)
+	e.strava[athleteID] = stravaServer
+
+	if len(scopes) == 0 {
+		scopes = []string{stravaapi.ScopeActivityReadAll, stravaapi.ScopeActivityWrite}
+	}
+	tokens := stravaServer.IssueTokens(scopes...)
+	_, err := e.athletes.Connect(context.Background(), athleteID, "", scopes, &stravaapi.Tokens{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken})
+	require.NoError(t, err)
+	return stravaServer
+}
+
+func (e *testEnv) check(t *testing.T, event CheckActivitiesEvent) (*checkResult, error) {
+	ctx := handler.GetWithSuppressedLogging(context.Background())
+	res, err := e.checker.handle(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	result, ok := res.(*checkResult)
+	require.True(t, ok)
+	return result, nil
+}
+
+// checkOne checks the only connected athlete
+func (e *testEnv) checkOne(t *testing.T, event CheckActivitiesEvent) (*checkReport, error) {
+	result, err := e.check(t, event)
+	if err != nil {
+		return nil, err
+	}
+	require.Len(t, result.Athletes, 1)
+	return result.Athletes[0], nil
+}
+
+func Test_handler_reportsViolations(t *testing.T) {
+	env := newTestEnv(t)
+	stravaServer := env.connect(t, testAthleteID)
+	stravaServer.AddActivity(stravafake.Activity{ID: 1, Name: "Forbidden shoes", SportType: "Run", GearID: "g1", StartDate: testStart})
+	stravaServer.AddActivity(stravafake.Activity{ID: 2, Name: "Allowed shoes", SportType: "Run", GearID: "g200", StartDate: testStart.Add(time.Hour)})
+	stravaServer.AddActivity(stravafake.Activity{ID: 3, Name: "No bike", SportType: "Ride", StartDate: testStart.Add(2 * time.Hour)})
+
+	report, err := env.checkOne(t, CheckActivitiesEvent{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Pages)
+	assert.Equal(t, 3, report.Activities)
+	assert.Equal(t, 3, report.BaggingChecks)
+	require.Len(t, report.Violations, 2)
+	assert.Equal(t, int64(3), report.Violations[0].activity.ID)
+	assert.Equal(t, int64(1), report.Violations[1].activity.ID)
+	assert.Empty(t, report.Changes)
+
+	assert.Len(t, env.aws.Events(), 3)
+	messages := env.aws.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, testTopicArn, messages[0].TopicArn)
+	assert.Contains(t, messages[0].Message, "https://www.strava.com/activities/1 ")
+	assert.Contains(t, messages[0].Message, "https://www.strava.com/activities/3 ")
+
+	activity, _ := stravaServer.Activity(1)
+	assert.Equal(t, "g1", activity.GearID, "gear is not changed when fixing is off")
+
+	report, err = env.checkOne(t, CheckActivitiesEvent{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.BaggingChecks, "bagging checks are only sent once")
+	assert.Len(t, env.aws.Events(), 3)
+}
+
+func Test_handler_appliesFixes(t *testing.T) {
+	env := newTestEnv(t)
+	stravaServer := env.connect(t, testAthleteID)
+	stravaServer.AddActivity(stravafake.Activity{ID: 1, SportType: "Run", GearID: "g1", StartDate: testStart})
+	stravaServer.AddActivity(stravafake.Activity{ID: 2, SportType: "Run", GearID: "g1", StartDate: testStart.AddDate(0, 1, 0)})
+
+	event := CheckActivitiesEvent{After: testStart.Add(-time.Hour), Before: testStart.Add(time.Hour), AllPages: true, FixMode: "apply"}
+	report, err := env.checkOne(t, event)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Activities)
+	assert.Equal(t, []gearChange{{ActivityID: 1, From: "g1", To: "g200"}}, report.Changes)
+
+	activity, _ := stravaServer.Activity(1)
+	assert.Equal(t, "g200", activity.GearID)
+	activity, _ = stravaServer.Activity(2)
+	assert.Equal(t, "g1", activity.GearID, "activities outside the date range are not checked")
+	assert.Equal(t, 1, env.aws.ItemCount("strava-gear-changes"))
+
+	messages := env.aws.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Message, "changed gear from g1 to g200")
+}
+
+func Test_handler_fixWithoutWriteScope(t *testing.T) {
+	env := newTestEnv(t)
+	stravaServer := env.connect(t, testAthleteID, stravaapi.ScopeActivityReadAll)
+	stravaServer.AddActivity(stravafake.Activity{ID: 1, SportType: "Run", GearID: "g1", StartDate: testStart})
+
+	report, err := env.checkOne(t, CheckActivitiesEvent{After: testStart.Add(-time.Hour), FixMode: "apply"})
+	require.NoError(t, err)
+	assert.Equal(t, []gearChange{{ActivityID: 1, From: "g1", To: "g200", DryRun: true}}, report.Changes)
+
+	activity, _ := stravaServer.Activity(1)
+	assert.Equal(t, "g1", activity.GearID)
+	assert.Equal(t, 0, env.aws.ItemCount("strava-gear-changes"))
+}
+
+func Test_handler_refreshesExpiredTokens(t *testing.T) {
+	env := newTestEnv(t)
+	stravaServer := env.connect(t, testAthleteID)
+	stravaServer.AddActivity(stravafake.Activity{ID: 1, SportType: "Run", GearID: "g200", StartDate: testStart})
+	previous, err := env.athletes.GetAthlete(context.Background(), testAthleteID)
+	require.NoError(t, err)
+
+	stravaServer.ExpireTokens()
+	report, err := env.checkOne(t, CheckActivitiesEvent{After: testStart.Add(-time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Activities)
+
+	athlete, err := env.athletes.GetAthlete(context.Background(), testAthleteID)
+	require.NoError(t, err)
+	assert.NotEqual(t, previous.Tokens.AccessToken, athlete.Tokens.AccessToken)
+}
+
+func Test_handler_rateLimited(t *testing.T) {
+	env := newTestEnv(t)
+	stravaServer := env.connect(t, testAthleteID)
+	stravaServer.AddActivity(stravafake.Activity{ID: 1, SportType: "Run", GearID: "g1", StartDate: testStart})
+
+	stravaServer.RateLimitNext(1)
+	_, err := env.checkOne(t, CheckActivitiesEvent{After: testStart.Add(-time.Hour)})
+	assert.ErrorContains(t, err, "HTTP 429")
+	assert.Empty(t, env.aws.Messages())
+	assert.Empty(t, env.aws.Events())
+}
+
+func Test_handler_multipleAthletes(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	first := env.connect(t, 1001)
+	first.AddActivity(stravafake.Activity{ID: 1, SportType: "Run", GearID: "g1", StartDate: testStart})
+
+	//The second athlete forbids the gear which the default rules use
+	second := env.connect(t, 1002)
+	second.AddActivity(stravafake.Activity{ID: 2, SportType: "Run", GearID: "g200", StartDate: testStart})
+	rules, err := gear.ParseRules([]byte(`{"Run": {"forbidden": ["g200"]}}`))
+	require.NoError(t, err)
+	require.NoError(t, env.athletes.PutOptions(ctx, 1002, rules, "arn:aws:sns:eu-west-1:123456789012:strava-1002"))
+
+	//The third athlete's tokens are no longer valid
+	env.connect(t, 1003)
+	require.NoError(t, env.athletes.PutTokens(ctx, 1003, &stravaapi.Tokens{AccessToken: "revoked", RefreshToken: "revoked"}))
+
+	//The fourth athlete's stored rules cannot be parsed
+	fourth := env.connect(t, 1004)
+	fourth.AddActivity(stravafake.Activity{ID: 4, SportType: "Run", GearID: "g1", StartDate: testStart})
+	_, err = env.db.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("strava-athletes"),
+		Key:                       map[string]dynamoTypes.AttributeValue{"AthleteID": &dynamoTypes.AttributeValueMemberS{Value: "1004"}},
+		UpdateExpression:          aws.String("SET GearRules = :rules"),
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{":rules": &dynamoTypes.AttributeValueMemberS{Value: "{"}},
+	})
+	require.NoError(t, err)
+
+	result, err := env.check(t, CheckActivitiesEvent{})
+	require.NoError(t, err, "one athlete failing does not fail the check")
+
+	reports := map[int64]*checkReport{}
+	for _, report := range result.Athletes {
+		reports[report.AthleteID] = report
+	}
+	require.Len(t, reports, 4)
+	assert.Len(t, reports[1001].Violations, 1)
+	assert.Len(t, reports[1002].Violations, 1)
+	assert.NotEmpty(t, reports[1003].Error)
+	assert.Contains(t, reports[1004].Error, "invalid gear rules")
+
+	topics := map[string]string{}
+	for _, msg := range env.aws.Messages() {
+		topics[msg.TopicArn] = msg.Message
+	}
+	assert.Contains(t, topics[testTopicArn], "https://www.strava.com/activities/1 ")
+	assert.Contains(t, topics["arn:aws:sns:eu-west-1:123456789012:strava-1002"], "https://www.strava.com/activities/2 ")
+
+	var details []string
+	for _, event := range env.aws.Events() {
+		details = append(details, event.Detail)
+	}
+	assert.ElementsMatch(t, []string{`{"id":1,"athleteId":1001}`, `{"id":2,"athleteId":1002}`}, details)
+
+	result, err = env.check(t, CheckActivitiesEvent{AthleteID: 1001})
+	require.NoError(t, err)
+	require.Len(t, result.Athletes, 1)
+	assert.Equal(t, int64(1001), result.Athletes[0].AthleteID)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/jsii-runtime-go"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/athletes"
+	"github.com/ockendenjo/strava-shoes/pkg/bagging"
+	"github.com/ockendenjo/strava-shoes/pkg/bags"
+	"github.com/ockendenjo/strava-shoes/pkg/settings"
+	"github.com/ockendenjo/strava-shoes/pkg/webhook"
+)
+
+type H = handler.Handler[events.CloudWatchEvent, any]
+
+func main() {
+	topicArn := handler.MustGetEnv("TOPIC_ARN")
+	athletesDb := handler.MustGetEnv("ATHLETES_DB")
+	baggingDb := handler.MustGetEnv("BAGGING_DB")
+	bagsDb := handler.MustGetEnv("BAGS_DB")
+	settingsDb := handler.MustGetEnv("SETTINGS_DB")
+	scheduleRule := handler.MustGetEnv("SCHEDULE_RULE")
+
+	handler.BuildAndStart(func(awsConfig aws.Config) H {
+		dbClient := dynamodb.NewFromConfig(awsConfig)
+		//Records are only deleted so the TTL is not used
+		h := &lambdaHandler{
+			athletesClient: athletes.NewClient(dbClient, athletesDb),
+			baggingClient:  bagging.NewClient(dbClient, baggingDb, 0),
+			bagsClient:     bags.NewClient(dbClient, bagsDb),
+			settingsClient: settings.NewClient(dbClient, settingsDb),
+			ebClient:       eventbridge.NewFromConfig(awsConfig),
+			snsClient:      sns.NewFromConfig(awsConfig),
+			scheduleRule:   scheduleRule,
+			topicArn:       topicArn,
+		}
+		return h.handle
+	})
+}
+
+type lambdaHandler struct {
+	athletesClient athletes.Client
+	baggingClient  bagging.Client
+	bagsClient     bags.Client
+	settingsClient settings.Client
+	ebClient       *eventbridge.Client
+	snsClient      *sns.Client
+	scheduleRule   string
+	topicArn       string
+}
+
+// handle removes the athlete's data when they revoke access for the app
+func (h *lambdaHandler) handle(ctx *handler.Context, event events.CloudWatchEvent) (any, error) {
+	logger := ctx.GetLogger()
+
+	webhookEvent, err := webhook.Parse(event.Detail)
+	if err != nil {
+		//Retrying will not help
+		logger.AddParam("error", err).Error("Invalid webhook event")
+		return nil, nil
+	}
+	logger.AddParam("webhookEvent", webhookEvent)
+
+	if !webhookEvent.IsDeauthorization() {
+		logger.Info("Ignoring event which is not a deauthorization")
+		return nil, nil
+	}
+
+	athleteID := webhookEvent.OwnerID
+	athlete, err := h.athletesClient.GetAthlete(ctx, athleteID)
+	if errors.Is(err, athletes.ErrNotFound) {
+		//The athlete may have been deleted by an earlier attempt, in which case the default topic is notified
+		athlete = &athletes.Athlete{ID: athleteID}
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting athlete %d: %w", athleteID, err)
+	}
+
+	deleted, err := h.baggingClient.DeleteAthlete(ctx, athleteID)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting bagging records: %w", err)
+	}
+	logger.AddParam("baggingRecordsDeleted", deleted).AddStage("Bagging records deleted")
+
+	bagsDeleted, err := h.bagsClient.DeleteAthlete(ctx, athleteID)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting bagged hills: %w", err)
+	}
+	logger.AddParam("bagsDeleted", bagsDeleted).AddStage("Bagged hills deleted")
+
+	err = h.settingsClient.DeleteSettings(ctx, athleteID)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting settings: %w", err)
+	}
+	logger.AddStage("Settings deleted")
+
+	//The athlete is deleted last so that a retry can still find their notification topic
+	err = h.athletesClient.DeleteAthlete(ctx, athleteID)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting athlete %d: %w", athleteID, err)
+	}
+	logger.AddStage("Tokens deleted")
+
+	remaining, err := h.athletesClient.ListAthletes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing athletes: %w", err)
+	}
+	scheduleMsg := ""
+	if len(remaining) == 0 {
+		_, err = h.ebClient.DisableRule(ctx, &eventbridge.DisableRuleInput{
+			Name: aws.String(h.scheduleRule),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error disabling scheduled check: %w", err)
+		}
+		logger.AddStage("Scheduled check disabled")
+		scheduleMsg = " No athletes remain so the scheduled gear check has been disabled."
+	}
+
+	msg := fmt.Sprintf("Strava athlete %d revoked access. Stored tokens, settings, %d bagging records and %d bagged hills have been deleted.%s Visit the auth URL to authorize again.", athleteID, deleted, bagsDeleted, scheduleMsg)
+	_, err = h.snsClient.Publish(ctx, &sns.PublishInput{
+		TopicArn: jsii.String(athlete.TopicArnOr(h.topicArn)),
+		Message:  jsii.String(msg),
+		Subject:  jsii.String("Strava access revoked"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Athlete deauthorized")
+	return nil, nil
+}
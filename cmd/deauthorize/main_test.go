@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/athletes"
+	"github.com/ockendenjo/strava-shoes/pkg/bagging"
+	"github.com/ockendenjo/strava-shoes/pkg/bags"
+	"github.com/ockendenjo/strava-shoes/pkg/localaws"
+	"github.com/ockendenjo/strava-shoes/pkg/settings"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+	"github.com/ockendenjo/strava-shoes/pkg/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTopicArn = "arn:aws:sns:eu-west-1:123456789012:strava-gear"
+const testScheduleRule = "strava-check-schedule"
+
+func Test_handle(t *testing.T) {
+	testcases := []struct {
+		name           string
+		otherAthletes  []int64
+		expItems       int
+		expRuleEnabled bool
+	}{
+		{
+			name:           "last athlete",
+			expRuleEnabled: false,
+		},
+		{
+			name:           "other athletes remain",
+			otherAthletes:  []int64{1002},
+			expItems:       1,
+			expRuleEnabled: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := handler.GetWithSuppressedLogging(context.Background())
+			awsServer := localaws.NewServer()
+			awsServer.CreateTable("strava-athletes", "AthleteID", "")
+			awsServer.CreateTable("strava-bagging", "ID", "")
+			awsServer.CreateTable("strava-bags", "AthleteID", "BagID")
+			awsServer.CreateTable("strava-settings", "AthleteID", "")
+			awsHTTPServer := httptest.NewServer(awsServer)
+			t.Cleanup(awsHTTPServer.Close)
+			awsConfig := localaws.Config(awsHTTPServer.URL)
+
+			dbClient := dynamodb.NewFromConfig(awsConfig)
+			h := &lambdaHandler{
+				athletesClient: athletes.NewClient(dbClient, "strava-athletes"),
+				baggingClient:  bagging.NewClient(dbClient, "strava-bagging", 0),
+				bagsClient:     bags.NewClient(dbClient, "strava-bags"),
+				settingsClient: settings.NewClient(dbClient, "strava-settings"),
+				ebClient:       eventbridge.NewFromConfig(awsConfig),
+				snsClient:      sns.NewFromConfig(awsConfig),
+				scheduleRule:   testScheduleRule,
+				topicArn:       testTopicArn,
+			}
+
+			for i, athleteID := range append([]int64{1001}, tc.otherAthletes...) {
+				_, err := h.athletesClient.Connect(ctx, athleteID, "", stravaapi.Scopes{stravaapi.ScopeActivityReadAll}, &stravaapi.Tokens{AccessToken: "access", RefreshToken: "refresh"})
+				require.NoError(t, err)
+				require.NoError(t, h.settingsClient.PutSettings(ctx, settings.Settings{AthleteID: athleteID, DescribeBags: true}))
+				activityID := int64(100 + i)
+				require.NoError(t, h.baggingClient.PutRecord(ctx, bagging.Record{ID: activityID, AthleteID: athleteID, CheckedAt: time.Now(), DatasetVersion: "v1", BagCount: 1}))
+				require.NoError(t, h.bagsClient.PutBag(ctx, bags.Bag{AthleteID: athleteID, HillID: 1, HillName: "Ben Nevis", ActivityID: activityID, Date: time.Now()}))
+			}
+			//A second bag and a record for an activity without bags
+			require.NoError(t, h.bagsClient.PutBag(ctx, bags.Bag{AthleteID: 1001, HillID: 2, HillName: "Carn Mor Dearg", ActivityID: 100, Date: time.Now()}))
+			require.NoError(t, h.baggingClient.PutRecord(ctx, bagging.Record{ID: 200, AthleteID: 1001, CheckedAt: time.Now(), DatasetVersion: "v1"}))
+
+			detail, err := json.Marshal(webhook.Event{
+				ObjectType:     webhook.ObjectTypeAthlete,
+				ObjectID:       1001,
+				AspectType:     webhook.AspectTypeUpdate,
+				Updates:        map[string]string{"authorized": "false"},
+				OwnerID:        1001,
+				SubscriptionID: 1,
+				EventTime:      time.Now().Unix(),
+			})
+			require.NoError(t, err)
+			_, err = h.handle(ctx, events.CloudWatchEvent{Detail: detail})
+			require.NoError(t, err)
+
+			_, err = h.athletesClient.GetAthlete(ctx, 1001)
+			assert.ErrorIs(t, err, athletes.ErrNotFound)
+			for _, table := range []string{"strava-athletes", "strava-bagging", "strava-bags", "strava-settings"} {
+				assert.Equal(t, tc.expItems, awsServer.ItemCount(table), table)
+			}
+			assert.Equal(t, tc.expRuleEnabled, awsServer.RuleEnabled(testScheduleRule))
+
+			messages := awsServer.Messages()
+			require.Len(t, messages, 1)
+			assert.Equal(t, testTopicArn, messages[0].TopicArn)
+			assert.Contains(t, messages[0].Message, "2 bagging records and 2 bagged hills have been deleted")
+			assert.Equal(t, !tc.expRuleEnabled, strings.Contains(messages[0].Message, "the scheduled gear check has been disabled"))
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/apikey"
+	"github.com/ockendenjo/strava-shoes/pkg/athletes"
+	"github.com/ockendenjo/strava-shoes/pkg/gear"
+)
+
+type apiHandler = handler.Handler[events.APIGatewayV2HTTPRequest, events.APIGatewayV2HTTPResponse]
+
+func main() {
+	rules, err := gear.ParseRules([]byte(handler.MustGetEnv("GEAR_RULES")))
+	if err != nil {
+		panic(err)
+	}
+	athletesDb := handler.MustGetEnv("ATHLETES_DB")
+
+	handler.BuildAndStart(func(awsConfig aws.Config) apiHandler {
+		h := &lambdaHandler{
+			athletesClient: athletes.NewClient(dynamodb.NewFromConfig(awsConfig), athletesDb),
+			rules:          rules,
+		}
+		return h.handle
+	})
+}
+
+type lambdaHandler struct {
+	athletesClient athletes.Client
+	// rules are returned for athletes who have not set their own
+	rules gear.Rules
+}
+
+// rulesResponse is the body of a successful GET or PUT. Default is true if the athlete uses the default rules
+type rulesResponse struct {
+	AthleteID int64      `json:"athleteId"`
+	Default   bool       `json:"default"`
+	Rules     gear.Rules `json:"rules"`
+}
+
+type validateResponse struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// handle serves the gear rules of an athlete:
+//
+//	GET /athletes/{athleteId}/gear-rules
+//	PUT /athletes/{athleteId}/gear-rules
+//	POST /athletes/{athleteId}/gear-rules/validate
+func (h *lambdaHandler) handle(ctx *handler.Context, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	logger := ctx.GetLogger().AddParam("routeKey", event.RouteKey)
+
+	athleteID, err := strconv.ParseInt(event.PathParameters["athleteId"], 10, 64)
+	if err != nil || athleteID < 1 {
+		return getResponse(http.StatusBadRequest, errorResponse{Error: "Path parameter 'athleteId' must be a Strava athlete ID"}), nil
+	}
+	logger.AddParam("athleteId", athleteID)
+
+	athlete, res := h.authorize(ctx, event, athleteID)
+	if athlete == nil {
+		return res, nil
+	}
+
+	switch event.RouteKey {
+	case "GET /athletes/{athleteId}/gear-rules":
+		return getResponse(http.StatusOK, rulesResponse{
+			AthleteID: athleteID,
+			Default:   athlete.GearRules == nil,
+			Rules:     athlete.RulesOr(h.rules),
+		}), nil
+	case "PUT /athletes/{athleteId}/gear-rules":
+		return h.putRules(ctx, athleteID, event)
+	case "POST /athletes/{athleteId}/gear-rules/validate":
+		_, err := parseBody(event)
+		if err != nil {
+			return getResponse(http.StatusOK, validateResponse{Valid: false, Error: err.Error()}), nil
+		}
+		return getResponse(http.StatusOK, validateResponse{Valid: true}), nil
+	}
+	return getResponse(http.StatusNotFound, errorResponse{Error: "Not found"}), nil
+}
+
+// authorize returns the athlete if the request has the athlete's own API key. Otherwise it returns the error response.
+// A key for another athlete is rejected before the athlete is read
+func (h *lambdaHandler) authorize(ctx *handler.Context, event events.APIGatewayV2HTTPRequest, athleteID int64) (*athletes.Athlete, events.APIGatewayV2HTTPResponse) {
+	logger := ctx.GetLogger().AddParam("sourceIp", event.RequestContext.HTTP.SourceIP)
+	unauthorized := getResponse(http.StatusUnauthorized, errorResponse{Error: "A valid API key is required"})
+
+	keyAthleteID, key, found := apikey.AthleteKey(event.Headers)
+	if !found {
+		logger.Warn("Rejected request without an athlete API key")
+		return nil, unauthorized
+	}
+	if keyAthleteID != athleteID {
+		logger.Warn("Rejected request with another athlete's API key", "keyAthleteId", keyAthleteID)
+		return nil, getResponse(http.StatusForbidden, errorResponse{Error: "The API key is for another athlete"})
+	}
+
+	athlete, err := h.athletesClient.GetAthlete(ctx, athleteID)
+	if errors.Is(err, athletes.ErrNotFound) {
+		//The key was revoked with the athlete's other data
+		logger.Warn("Rejected request for an athlete who has not authorized the app")
+		return nil, unauthorized
+	}
+	if err != nil {
+		logger.AddParam("error", err).Error("Failed to get athlete")
+		return nil, getResponse(http.StatusInternalServerError, errorResponse{Error: "Something went wrong"})
+	}
+	if !apikey.MatchesHash(key, athlete.APIKeyHash) {
+		logger.Warn("Rejected request with an invalid API key")
+		return nil, unauthorized
+	}
+	return athlete, events.APIGatewayV2HTTPResponse{}
+}
+
+// putRules replaces the athlete's rules. A body of null restores the default rules
+func (h *lambdaHandler) putRules(ctx *handler.Context, athleteID int64, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	logger := ctx.GetLogger()
+	rules, err := parseBody(event)
+	if err != nil {
+		return getResponse(http.StatusBadRequest, errorResponse{Error: err.Error()}), nil
+	}
+
+	err = h.athletesClient.PutGearRules(ctx, athleteID, rules)
+	if errors.Is(err, athletes.ErrNotFound) {
+		return getResponse(http.StatusNotFound, errorResponse{Error: "Athlete has not authorized the app"}), nil
+	}
+	if err != nil {
+		logger.AddParam("error", err).Error("Failed to store gear rules")
+		return getResponse(http.StatusInternalServerError, errorResponse{Error: "Something went wrong"}), nil
+	}
+
+	logger.Info("Gear rules updated")
+	res := rulesResponse{AthleteID: athleteID, Default: rules == nil, Rules: rules}
+	if rules == nil {
+		res.Rules = h.rules
+	}
+	return getResponse(http.StatusOK, res), nil
+}
+
+func parseBody(event events.APIGatewayV2HTTPRequest) (gear.Rules, error) {
+	body := []byte(event.Body)
+	if event.IsBase64Encoded {
+		b, err := base64.StdEncoding.DecodeString(event.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+	return gear.ParseRules(body)
+}
+
+func getResponse(code int, body any) events.APIGatewayV2HTTPResponse {
+	b, _ := json.Marshal(body)
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: code,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(b),
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/apikey"
+	"github.com/ockendenjo/strava-shoes/pkg/athletes"
+	"github.com/ockendenjo/strava-shoes/pkg/gear"
+	"github.com/ockendenjo/strava-shoes/pkg/localaws"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The athletes' API keys. Only their hashes are stored
+const testAPIKey = "1001.ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+const otherAPIKey = "1002.ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+var defaultRules = gear.Rules{"Run": {Forbidden: []string{"g1"}}}
+
+func newTestHandler(t *testing.T) *lambdaHandler {
+	awsServer := localaws.NewServer()
+	awsServer.CreateTable("strava-athletes", "AthleteID", "")
+	awsHTTPServer := httptest.NewServer(awsServer)
+	t.Cleanup(awsHTTPServer.Close)
+	awsConfig := localaws.Config(awsHTTPServer.URL)
+
+	ctx := context.Background()
+	athletesClient := athletes.NewClient(dynamodb.NewFromConfig(awsConfig), "strava-athletes")
+	for id, key := range map[int64]string{1001: testAPIKey, 1002: otherAPIKey} {
+		_, err := athletesClient.Connect(ctx, id, "", stravaapi.Scopes{stravaapi.ScopeActivityReadAll}, &stravaapi.Tokens{AccessToken: "a1"})
+		require.NoError(t, err)
+		require.NoError(t, athletesClient.PutAPIKeyHash(ctx, id, apikey.Hash(key)))
+	}
+
+	return &lambdaHandler{
+		athletesClient: athletesClient,
+		rules:          defaultRules,
+	}
+}
+
+func request(routeKey string, athleteID string, body string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		RouteKey:       routeKey,
+		Headers:        map[string]string{"authorization": "Bearer " + athleteID + ".ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+		PathParameters: map[string]string{"athleteId": athleteID},
+		Body:           body,
+	}
+}
+
+func Test_handle(t *testing.T) {
+	testcases := []struct {
+		name      string
+		apiKey    string
+		requests  []events.APIGatewayV2HTTPRequest
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:      "default rules",
+			requests:  []events.APIGatewayV2HTTPRequest{request("GET /athletes/{athleteId}/gear-rules", "1001", "")},
+			expStatus: http.StatusOK,
+			expBody:   `{"athleteId":1001,"default":true,"rules":{"Run":{"forbidden":["g1"]}}}`,
+		},
+		{
+			name: "put rules",
+			requests: []events.APIGatewayV2HTTPRequest{
+				request("PUT /athletes/{athleteId}/gear-rules", "1001", `{"Ride": {"allowed": ["b1"]}}`),
+				request("GET /athletes/{athleteId}/gear-rules", "1001", ""),
+			},
+			expStatus: http.StatusOK,
+			expBody:   `{"athleteId":1001,"default":false,"rules":{"Ride":{"allowed":["b1"]}}}`,
+		},
+		{
+			name: "restore default rules",
+			requests: []events.APIGatewayV2HTTPRequest{
+				request("PUT /athletes/{athleteId}/gear-rules", "1001", `{"Ride": {"allowed": ["b1"]}}`),
+				request("PUT /athletes/{athleteId}/gear-rules", "1001", `null`),
+				request("GET /athletes/{athleteId}/gear-rules", "1001", ""),
+			},
+			expStatus: http.StatusOK,
+			expBody:   `{"athleteId":1001,"default":true,"rules":{"Run":{"forbidden":["g1"]}}}`,
+		},
+		{
+			name:      "put invalid rules",
+			requests:  []events.APIGatewayV2HTTPRequest{request("PUT /athletes/{athleteId}/gear-rules", "1001", `{"Ride": {"allowed": ["b1"], "forbidden": ["b1"]}}`)},
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"error":"Ride rule has gear b1 as both allowed and forbidden"}`,
+		},
+		{
+			name:      "valid rules",
+			requests:  []events.APIGatewayV2HTTPRequest{request("POST /athletes/{athleteId}/gear-rules/validate", "1001", `{"Ride": {"allowed": ["b1"], "use": "b1"}}`)},
+			expStatus: http.StatusOK,
+			expBody:   `{"valid":true}`,
+		},
+		{
+			name:      "invalid rules",
+			requests:  []events.APIGatewayV2HTTPRequest{request("POST /athletes/{athleteId}/gear-rules/validate", "1001", `{"Ride": {"allowed": ["b1"], "use": "b2"}}`)},
+			expStatus: http.StatusOK,
+			expBody:   `{"valid":false,"error":"Ride rule uses gear b2 which is not allowed"}`,
+		},
+		{
+			name:      "invalid athlete ID",
+			requests:  []events.APIGatewayV2HTTPRequest{request("GET /athletes/{athleteId}/gear-rules", "jo", "")},
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"error":"Path parameter 'athleteId' must be a Strava athlete ID"}`,
+		},
+		{
+			name:      "no API key",
+			apiKey:    "none",
+			requests:  []events.APIGatewayV2HTTPRequest{request("GET /athletes/{athleteId}/gear-rules", "1001", "")},
+			expStatus: http.StatusUnauthorized,
+			expBody:   `{"error":"A valid API key is required"}`,
+		},
+		{
+			name:      "wrong API key",
+			apiKey:    "1001.ZYXWVUTSRQPONMLKJIHGFEDCBA",
+			requests:  []events.APIGatewayV2HTTPRequest{request("GET /athletes/{athleteId}/gear-rules", "1001", "")},
+			expStatus: http.StatusUnauthorized,
+			expBody:   `{"error":"A valid API key is required"}`,
+		},
+		{
+			name:      "shared API key",
+			apiKey:    "0123456789abcdef0123456789abcdef",
+			requests:  []events.APIGatewayV2HTTPRequest{request("GET /athletes/{athleteId}/gear-rules", "1001", "")},
+			expStatus: http.StatusUnauthorized,
+			expBody:   `{"error":"A valid API key is required"}`,
+		},
+		{
+			name:      "another athlete's API key",
+			apiKey:    otherAPIKey,
+			requests:  []events.APIGatewayV2HTTPRequest{request("PUT /athletes/{athleteId}/gear-rules", "1001", `{"Ride": {"allowed": ["b1"]}}`)},
+			expStatus: http.StatusForbidden,
+			expBody:   `{"error":"The API key is for another athlete"}`,
+		},
+		{
+			name:      "athlete has not authorized the app",
+			requests:  []events.APIGatewayV2HTTPRequest{request("PUT /athletes/{athleteId}/gear-rules", "1003", `{"Ride": {"allowed": ["b1"]}}`)},
+			expStatus: http.StatusUnauthorized,
+			expBody:   `{"error":"A valid API key is required"}`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newTestHandler(t)
+
+			var res events.APIGatewayV2HTTPResponse
+			for _, req := range tc.requests {
+				switch tc.apiKey {
+				case "":
+				case "none":
+					req.Headers = nil
+				default:
+					req.Headers = map[string]string{"authorization": "Bearer " + tc.apiKey}
+				}
+				var err error
+				res, err = h.handle(handler.GetWithSuppressedLogging(context.Background()), req)
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expStatus, res.StatusCode)
+			assert.JSONEq(t, tc.expBody, res.Body)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/bagging"
+	"github.com/ockendenjo/strava-shoes/pkg/hills"
+)
+
+type H = handler.Handler[RebagEvent, RebagResult]
+
+func main() {
+	baggingDb := handler.MustGetEnv("BAGGING_DB")
+	datasetBucket := handler.GetEnv("HILLS_DATASET_BUCKET")
+	datasetKey := handler.GetEnv("HILLS_DATASET_KEY")
+
+	handler.BuildAndStart(func(awsConfig aws.Config) H {
+		dataset, err := hills.Load(context.Background(), s3.NewFromConfig(awsConfig), datasetBucket, datasetKey)
+		if err != nil {
+			panic(err)
+		}
+
+		//Records are not written so the TTL is not used
+		h := &lambdaHandler{
+			baggingClient:  bagging.NewClient(dynamodb.NewFromConfig(awsConfig), baggingDb, 0),
+			ebClient:       eventbridge.NewFromConfig(awsConfig),
+			datasetVersion: dataset.Version,
+		}
+		return h.handle
+	})
+}
+
+type lambdaHandler struct {
+	baggingClient  bagging.Client
+	ebClient       *eventbridge.Client
+	datasetVersion string
+}
+
+// RebagEvent limits the number of activities sent for a bagging check. All stale activities are sent if Limit is zero
+type RebagEvent struct {
+	Limit  int  `json:"limit,omitempty"`
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// RebagResult counts the stale activities. Skipped activities have no athlete ID because they were checked before
+// athletes were recorded, so they cannot be checked again
+type RebagResult struct {
+	DatasetVersion string `json:"datasetVersion"`
+	Stale          int    `json:"stale"`
+	Skipped        int    `json:"skipped"`
+	Sent           int    `json:"sent"`
+}
+
+// handle sends a bagging check event for each activity which was checked against an older hill dataset
+func (h *lambdaHandler) handle(ctx *handler.Context, event RebagEvent) (RebagResult, error) {
+	logger := ctx.GetLogger().AddParam("datasetVersion", h.datasetVersion)
+	result := RebagResult{DatasetVersion: h.datasetVersion}
+
+	records, err := h.baggingClient.ListStale(ctx, h.datasetVersion)
+	if err != nil {
+		return result, err
+	}
+	result.Stale = len(records)
+
+	records = slices.DeleteFunc(records, func(r bagging.Record) bool { return r.AthleteID == 0 })
+	result.Skipped = result.Stale - len(records)
+	if event.Limit > 0 && len(records) > event.Limit {
+		records = records[:event.Limit]
+	}
+
+	byAthlete := map[int64][]int64{}
+	for _, r := range records {
+		byAthlete[r.AthleteID] = append(byAthlete[r.AthleteID], r.ID)
+	}
+	if event.DryRun {
+		logger.Info("Dry run", "stale", result.Stale, "skipped", result.Skipped, "ids", byAthlete)
+		return result, nil
+	}
+
+	var errs []error
+	for athleteID, ids := range byAthlete {
+		published, failed, err := bagging.SendChecks(ctx, h.ebClient, athleteID, ids)
+		result.Sent += len(published)
+		if len(failed) > 0 {
+			logger.Warn("Failed to send bagging checks", "athleteId", athleteID, "failed", failed)
+		}
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return result, err
+	}
+
+	logger.Info("Bagging checks sent", "stale", result.Stale, "skipped", result.Skipped, "sent", result.Sent)
+	return result, nil
+}
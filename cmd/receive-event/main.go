@@ -1,48 +1,166 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/deadletter"
+	"github.com/ockendenjo/strava-shoes/pkg/dedupe"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+	"github.com/ockendenjo/strava-shoes/pkg/webhook"
 )
 
+// dedupeTTL is how long an event is remembered. Strava retries failed deliveries within a few minutes
+const dedupeTTL = 24 * time.Hour
+
 type H = handler.Handler[events.APIGatewayProxyRequest, events.APIGatewayProxyResponse]
 
 func main() {
+	deadLetterBucket := handler.MustGetEnv("DEAD_LETTER_BUCKET")
+	dedupeDb := handler.MustGetEnv("DEDUPE_DB")
+
 	handler.BuildAndStart(func(awsConfig aws.Config) H {
 		ebClient := eventbridge.NewFromConfig(awsConfig)
+		ssmStore := stravaapi.NewSSMStore(ssm.NewFromConfig(awsConfig))
+		deadLetters := deadletter.NewS3Queue(s3.NewFromConfig(awsConfig), deadLetterBucket, deadletter.DefaultPrefix)
+
+		dedupeClient := dedupe.NewClient(dynamodb.NewFromConfig(awsConfig), dedupeDb, dedupeTTL)
 
-		h := &lambdaHandler{ebClient: ebClient}
+		h := &lambdaHandler{ebClient: ebClient, subscriptionGetter: ssmStore, deadLetters: deadLetters, dedupeClient: dedupeClient}
 		return h.handle
 	})
 }
 
+type subscriptionGetter interface {
+	GetSubscription(ctx context.Context) (*stravaapi.StoredSubscription, error)
+}
+
 type lambdaHandler struct {
-	ebClient *eventbridge.Client
+	ebClient           *eventbridge.Client
+	subscriptionGetter subscriptionGetter
+	deadLetters        deadletter.Queue
+	dedupeClient       dedupe.Client
 }
 
 func (h *lambdaHandler) handle(ctx *handler.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	logger := ctx.GetLogger()
 	logger.AddParam("event", event.Body).Info("Received event")
 
-	entry := types.PutEventsRequestEntry{
-		Detail:     aws.String(event.Body),
-		DetailType: aws.String("StravaEvent"),
-		Source:     aws.String("io.ockenden.strava"),
+	subscription, err := h.subscriptionGetter.GetSubscription(ctx)
+	if errors.Is(err, stravaapi.ErrNoSubscription) {
+		logger.AddParam("sourceIp", event.RequestContext.Identity.SourceIP).Warn("Rejected event because there is no subscription")
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: ""}, nil
+	}
+	if err != nil {
+		logger.AddParam("error", err).Error("Failed to get subscription")
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
-	_, err := h.ebClient.PutEvents(ctx, &eventbridge.PutEventsInput{
-		Entries: []types.PutEventsRequestEntry{entry},
-	})
 
+	//Respond with HTTP 200 to every rejected event so that the sender learns nothing
+	if !hasCallbackToken(event, subscription) {
+		logger.AddParam("sourceIp", event.RequestContext.Identity.SourceIP).Warn("Rejected event without the callback token")
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: ""}, nil
+	}
+	webhookEvent, err := webhook.Parse([]byte(event.Body))
+	if err != nil {
+		logger.AddParam("error", err).Warn("Rejected malformed event")
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: ""}, nil
+	}
+	if webhookEvent.SubscriptionID != subscription.ID {
+		logger.AddParam("sourceIp", event.RequestContext.Identity.SourceIP).Warn("Rejected event which did not match the subscription")
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: ""}, nil
+	}
+
+	key := webhookEvent.Key()
+	first, err := h.dedupeClient.Claim(ctx, key)
 	if err != nil {
-		logger.Error("Failed to send event to bus")
-	} else {
+		logger.AddParam("error", err).Error("Failed to claim event")
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+	if !first {
+		logger.AddParam("key", key).Info("Ignored duplicate event")
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: ""}, nil
+	}
+
+	detail, err := json.Marshal(webhookEvent)
+	if err != nil {
+		logger.AddParam("error", err).Error("Error")
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	entry := types.PutEventsRequestEntry{
+		Detail:     aws.String(string(detail)),
+		DetailType: aws.String(webhookEvent.DetailType()),
+		Source:     aws.String(webhook.Source),
+	}
+	err = h.publish(ctx, entry)
+	if err == nil {
 		logger.AddParam("published", entry).Info("Sent event to bus")
+		h.confirm(ctx, key)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: ""}, nil
+	}
+	logger.AddParam("error", err).Error("Failed to send event to bus")
+
+	err = h.deadLetters.Put(ctx, deadletter.Entry{
+		Source:     aws.ToString(entry.Source),
+		DetailType: aws.ToString(entry.DetailType),
+		Detail:     aws.ToString(entry.Detail),
+		FailedAt:   time.Now(),
+		Reason:     err.Error(),
+	})
+	if err != nil {
+		//Strava retries the event if the response is not HTTP 200, so the retry must not be treated as a duplicate
+		logger.AddParam("deadLetterError", err).Error("Failed to store dead letter")
+		releaseErr := h.dedupeClient.Release(ctx, key)
+		if releaseErr != nil {
+			logger.AddParam("releaseError", releaseErr).Error("Failed to release event claim")
+		}
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
 
+	logger.Info("Stored event as dead letter")
+	h.confirm(ctx, key)
 	return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: ""}, nil
 }
+
+// confirm marks the event as sent once it is on the bus or stored as a dead letter. If this fails the claim expires
+// after dynamo.ClaimTimeout, after which a retry from Strava is published again
+func (h *lambdaHandler) confirm(ctx *handler.Context, key string) {
+	err := h.dedupeClient.Confirm(ctx, key)
+	if err != nil {
+		ctx.GetLogger().AddParam("error", err).Warn("Failed to confirm event claim")
+	}
+}
+
+func (h *lambdaHandler) publish(ctx context.Context, entry types.PutEventsRequestEntry) error {
+	res, err := h.ebClient.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{entry},
+	})
+	if err != nil {
+		return err
+	}
+	if res.FailedEntryCount > 0 {
+		return fmt.Errorf("EventBridge rejected event: %s %s", aws.ToString(res.Entries[0].ErrorCode), aws.ToString(res.Entries[0].ErrorMessage))
+	}
+	return nil
+}
+
+// hasCallbackToken checks the token which was added to the callback URL when the subscription was created. It is checked
+// before the body is parsed, so that an unverified sender learns nothing about the expected body
+func hasCallbackToken(event events.APIGatewayProxyRequest, subscription *stravaapi.StoredSubscription) bool {
+	token := event.QueryStringParameters["token"]
+	return subtle.ConstantTimeCompare([]byte(token), []byte(subscription.CallbackToken)) == 1
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava-shoes/pkg/deadletter"
+	"github.com/ockendenjo/strava-shoes/pkg/dedupe"
+	"github.com/ockendenjo/strava-shoes/pkg/localaws"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+	"github.com/ockendenjo/strava-shoes/pkg/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubSubscriptionGetter struct {
+	subscription *stravaapi.StoredSubscription
+}
+
+func (s stubSubscriptionGetter) GetSubscription(_ context.Context) (*stravaapi.StoredSubscription, error) {
+	if s.subscription == nil {
+		return nil, stravaapi.ErrNoSubscription
+	}
+	return s.subscription, nil
+}
+
+// stubQueue keeps dead letters in memory. Put fails if err is set
+type stubQueue struct {
+	deadletter.Queue
+	entries []deadletter.Entry
+	err     error
+}
+
+func (q *stubQueue) Put(_ context.Context, entry deadletter.Entry) error {
+	if q.err != nil {
+		return q.err
+	}
+	q.entries = append(q.entries, entry)
+	return nil
+}
+
+var testSubscription = &stravaapi.StoredSubscription{ID: 120475, CallbackToken: "secret"}
+
+const validBody = `{"aspect_type":"create","event_time":1549560669,"object_id":1360128428,"object_type":"activity","owner_id":134815,"subscription_id":120475,"updates":{}}`
+const validKey = "activity/1360128428/create/1549560669"
+
+func Test_handle_rejected(t *testing.T) {
+	subscription := testSubscription
+
+	testcases := []struct {
+		name         string
+		subscription *stravaapi.StoredSubscription
+		token        string
+		body         string
+	}{
+		{
+			name:  "no subscription",
+			token: "secret",
+			body:  validBody,
+		},
+		{
+			name:         "missing token",
+			subscription: subscription,
+			body:         validBody,
+		},
+		{
+			name:         "wrong token",
+			subscription: subscription,
+			token:        "guess",
+			body:         validBody,
+		},
+		{
+			name:         "wrong token and malformed body",
+			subscription: subscription,
+			token:        "guess",
+			body:         "{",
+		},
+		{
+			name:         "malformed body",
+			subscription: subscription,
+			token:        "secret",
+			body:         `{"object_type":"club"}`,
+		},
+		{
+			name:         "wrong subscription",
+			subscription: subscription,
+			token:        "secret",
+			body:         `{"aspect_type":"create","event_time":1549560669,"object_id":1360128428,"object_type":"activity","owner_id":134815,"subscription_id":1,"updates":{}}`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			//The handler has no EventBridge or dedupe client, so a rejected event must not reach them
+			h := &lambdaHandler{subscriptionGetter: stubSubscriptionGetter{subscription: tc.subscription}}
+			event := events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{}, Body: tc.body}
+			if tc.token != "" {
+				event.QueryStringParameters["token"] = tc.token
+			}
+
+			ctx := handler.GetWithSuppressedLogging(context.Background())
+			res, err := h.handle(ctx, event)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		})
+	}
+}
+
+func Test_handle_publish(t *testing.T) {
+	testcases := []struct {
+		name           string
+		rejectCode     string
+		deadLetterErr  error
+		expStatus      int
+		expEvents      int
+		expDeadLetters int
+		expClaim       string
+	}{
+		{
+			name:      "published",
+			expStatus: http.StatusOK,
+			expEvents: 1,
+			expClaim:  "sent",
+		},
+		{
+			name:           "PutEvents fails",
+			rejectCode:     "ThrottlingException",
+			expStatus:      http.StatusOK,
+			expDeadLetters: 1,
+			expClaim:       "sent",
+		},
+		{
+			name:          "storing the dead letter fails",
+			rejectCode:    "ThrottlingException",
+			deadLetterErr: errors.New("S3 is unavailable"),
+			expStatus:     http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			awsServer := localaws.NewServer()
+			awsServer.CreateTable("strava-webhook-events", "ID", "")
+			awsServer.RejectEvents(tc.rejectCode)
+			awsHTTPServer := httptest.NewServer(awsServer)
+			t.Cleanup(awsHTTPServer.Close)
+			awsConfig := localaws.Config(awsHTTPServer.URL)
+			dbClient := dynamodb.NewFromConfig(awsConfig)
+
+			queue := &stubQueue{err: tc.deadLetterErr}
+			h := &lambdaHandler{
+				ebClient:           eventbridge.NewFromConfig(awsConfig),
+				subscriptionGetter: stubSubscriptionGetter{subscription: testSubscription},
+				deadLetters:        queue,
+				dedupeClient:       dedupe.NewClient(dbClient, "strava-webhook-events", time.Hour),
+			}
+			event := events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"token": "secret"}, Body: validBody}
+
+			ctx := handler.GetWithSuppressedLogging(context.Background())
+			res, err := h.handle(ctx, event)
+			assert.Equal(t, tc.expStatus, res.StatusCode)
+			if tc.expStatus != http.StatusOK {
+				assert.Error(t, err)
+			}
+			assert.Len(t, awsServer.Events(), tc.expEvents)
+			require.Len(t, queue.entries, tc.expDeadLetters)
+			if tc.expDeadLetters > 0 {
+				assert.Equal(t, webhook.Source, queue.entries[0].Source)
+				assert.Equal(t, webhook.DetailTypeActivityCreated, queue.entries[0].DetailType)
+				assert.Contains(t, queue.entries[0].Detail, `"object_id":1360128428`)
+				assert.Contains(t, queue.entries[0].Reason, "ThrottlingException")
+			}
+
+			//A confirmed claim is sent, and a released claim is removed so that Strava's retry is published
+			item, err := dbClient.GetItem(context.Background(), &dynamodb.GetItemInput{
+				TableName: aws.String("strava-webhook-events"),
+				Key:       map[string]dynamoTypes.AttributeValue{"ID": &dynamoTypes.AttributeValueMemberS{Value: validKey}},
+			})
+			require.NoError(t, err)
+			if tc.expClaim == "" {
+				assert.Nil(t, item.Item)
+				return
+			}
+			state, ok := item.Item["State"].(*dynamoTypes.AttributeValueMemberS)
+			require.True(t, ok)
+			assert.Equal(t, tc.expClaim, state.Value)
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"crypto/rand"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -11,6 +14,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/ockendenjo/handler"
 	"github.com/ockendenjo/strava"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
 )
 
 func main() {
@@ -24,10 +28,14 @@ func main() {
 			Transport: xray.RoundTripper(http.DefaultTransport),
 		}
 		stravaClient := strava.NewClient(ssmClient, httpClient)
+		ssmStore := stravaapi.NewSSMStore(ssmClient)
 
 		h := &lambdaHandler{
 			callbackURL:  callbackURL,
 			stravaClient: stravaClient,
+			//Subscription requests use the app credentials, so no athlete tokens are needed
+			stravaAPI: stravaapi.NewClient(httpClient, ssmStore, nil),
+			ssmStore:  ssmStore,
 		}
 		return h.handle
 	})
@@ -36,6 +44,8 @@ func main() {
 
 type lambdaHandler struct {
 	stravaClient strava.Client
+	stravaAPI    stravaapi.Client
+	ssmStore     *stravaapi.SSMStore
 	callbackURL  string
 }
 
@@ -43,12 +53,37 @@ func (h *lambdaHandler) handle(ctx *handler.Context, event any) (any, error) {
 	logger := ctx.GetLogger()
 	verifyToken := strings.ReplaceAll(uuid.NewString(), "-", "")
 
-	err := h.stravaClient.Subscribe(ctx, h.callbackURL, verifyToken)
+	//The callback token stops anyone who finds the API URL from posting events
+	callbackToken := rand.Text()
+	callbackURL := h.callbackURL + "?" + url.Values{"token": {callbackToken}}.Encode()
+
+	err := h.stravaClient.Subscribe(ctx, callbackURL, verifyToken)
 	if err != nil {
 		logger.AddParam("error", err).Error("Error subscribing to events")
 		return nil, err
 	}
 
-	logger.Info("Subscribed to events")
+	subscriptions, err := h.stravaAPI.ListSubscriptions(ctx)
+	if err != nil {
+		logger.AddParam("error", err).Error("Error listing subscriptions")
+		return nil, err
+	}
+	var subscriptionID int64
+	for _, sub := range subscriptions {
+		if sub.CallbackURL == callbackURL {
+			subscriptionID = sub.ID
+		}
+	}
+	if subscriptionID == 0 {
+		return nil, fmt.Errorf("subscription not found for callback URL")
+	}
+
+	err = h.ssmStore.PutSubscription(ctx, &stravaapi.StoredSubscription{ID: subscriptionID, CallbackToken: callbackToken})
+	if err != nil {
+		logger.AddParam("error", err).Error("Error storing subscription")
+		return nil, err
+	}
+
+	logger.AddParam("subscriptionId", subscriptionID).Info("Subscribed to events")
 	return event, nil
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/ockendenjo/handler"
+	"github.com/ockendenjo/strava"
+	"github.com/ockendenjo/strava-shoes/pkg/localaws"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+	"github.com/ockendenjo/strava-shoes/pkg/stravafake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(t *testing.T, stravaServer *stravafake.Server) (*lambdaHandler, *stravaapi.SSMStore) {
+	awsServer := localaws.NewServer()
+	awsServer.PutParameter("/strava/clientId", stravafake.DefaultClientID)
+	awsServer.PutParameter("/strava/clientSecret", stravafake.DefaultClientSecret)
+	awsHTTPServer := httptest.NewServer(awsServer)
+	t.Cleanup(awsHTTPServer.Close)
+
+	ssmClient := ssm.NewFromConfig(localaws.Config(awsHTTPServer.URL))
+	ssmStore := stravaapi.NewSSMStore(ssmClient)
+	h := &lambdaHandler{
+		callbackURL:  "https://api.example.com/event",
+		stravaClient: strava.NewClient(ssmClient, stravaServer.Client()),
+		stravaAPI:    stravaapi.NewClient(stravaServer.Client(), ssmStore, nil),
+		ssmStore:     ssmStore,
+	}
+	return h, ssmStore
+}
+
+func Test_handle(t *testing.T) {
+	stravaServer := stravafake.NewServer(stravafake.Athlete{ID: 1001})
+	defer stravaServer.Close()
+	h, ssmStore := newTestHandler(t, stravaServer)
+
+	ctx := handler.GetWithSuppressedLogging(context.Background())
+	_, err := h.handle(ctx, nil)
+	require.NoError(t, err)
+
+	subscriptions := stravaServer.Subscriptions()
+	require.Len(t, subscriptions, 1)
+
+	stored, err := ssmStore.GetSubscription(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, subscriptions[0].ID, stored.ID)
+
+	callbackURL, err := url.Parse(subscriptions[0].CallbackURL)
+	require.NoError(t, err)
+	assert.Equal(t, "api.example.com", callbackURL.Host)
+	assert.Equal(t, stored.CallbackToken, callbackURL.Query().Get("token"))
+}
+
+func Test_handle_existingSubscription(t *testing.T) {
+	stravaServer := stravafake.NewServer(stravafake.Athlete{ID: 1001})
+	defer stravaServer.Close()
+	h, ssmStore := newTestHandler(t, stravaServer)
+
+	ctx := handler.GetWithSuppressedLogging(context.Background())
+	_, err := h.handle(ctx, nil)
+	require.NoError(t, err)
+	first, err := ssmStore.GetSubscription(ctx)
+	require.NoError(t, err)
+
+	//Strava allows one subscription for each app
+	_, err = h.handle(ctx, nil)
+	assert.Error(t, err)
+
+	stored, err := ssmStore.GetSubscription(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, first, stored)
+}
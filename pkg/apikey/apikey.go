@@ -0,0 +1,80 @@
+// Package apikey checks the API keys which protect the HTTP API routes used by the athletes' own tools. Routes for one
+// athlete's data use that athlete's key. Other routes use the shared key from SSM
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MinLength stops the API being used before a key has been generated, e.g. while the SSM parameter still holds the
+// placeholder value from Terraform
+const MinLength = 32
+
+type Getter interface {
+	GetAPIKey(ctx context.Context) (string, error)
+}
+
+// NewAthleteKey returns a new key for an athlete and its hash. Only the hash is stored, so the key can only be shown
+// when it is issued. The key starts with the athlete ID, e.g. 1001.ABCD..., so that a request with one athlete's key
+// can be rejected for another athlete's data
+func NewAthleteKey(athleteID int64) (string, string) {
+	key := fmt.Sprintf("%d.%s", athleteID, rand.Text())
+	return key, Hash(key)
+}
+
+// Hash returns the SHA-256 hash of a key. The keys are random, so a salt is not needed
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// AthleteKey returns the athlete key sent as an Authorization: Bearer token and the athlete it was issued to. found
+// is false if there is no token or the token is not an athlete key
+func AthleteKey(headers map[string]string) (athleteID int64, key string, found bool) {
+	key, found = strings.CutPrefix(headers["authorization"], "Bearer ")
+	if !found {
+		return 0, "", false
+	}
+	id, _, found := strings.Cut(key, ".")
+	if !found {
+		return 0, "", false
+	}
+	athleteID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || athleteID < 1 {
+		return 0, "", false
+	}
+	return athleteID, key, true
+}
+
+// MatchesHash reports whether a key has the stored hash. An empty hash never matches, e.g. for an athlete who has not
+// been issued a key
+func MatchesHash(key string, hash string) bool {
+	if hash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(Hash(key)), []byte(hash)) == 1
+}
+
+// IsAuthorized reports whether the request headers hold the shared API key as an Authorization: Bearer token. API Gateway
+// sends header names in lower case
+func IsAuthorized(ctx context.Context, getter Getter, headers map[string]string) (bool, error) {
+	key, found := strings.CutPrefix(headers["authorization"], "Bearer ")
+	if !found {
+		return false, nil
+	}
+	apiKey, err := getter.GetAPIKey(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(apiKey) < MinLength {
+		return false, nil
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1, nil
+}
@@ -0,0 +1,363 @@
+// Package athletes stores the athletes who have connected their Strava account, with their tokens and check options
+package athletes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ockendenjo/strava-shoes/pkg/gear"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+)
+
+const pk = "AthleteID"
+const name = "Name"
+const accessToken = "AccessToken"
+const refreshToken = "RefreshToken"
+const expiresAt = "ExpiresAt"
+const connectedAt = "ConnectedAt"
+const gearRules = "GearRules"
+const topicArn = "TopicArn"
+const scopes = "Scopes"
+const apiKeyHash = "APIKeyHash"
+
+var ErrNotFound = errors.New("athlete not found")
+
+// Athlete is an athlete who has authorized the app. GearRules is nil and TopicArn is empty if the athlete uses the
+// default rules and notification topic
+type Athlete struct {
+	ID          int64            `json:"id"`
+	Name        string           `json:"name"`
+	ConnectedAt time.Time        `json:"connectedAt"`
+	Scopes      stravaapi.Scopes `json:"scopes,omitempty"`
+	GearRules   gear.Rules       `json:"gearRules,omitempty"`
+	TopicArn    string           `json:"topicArn,omitempty"`
+	Tokens      stravaapi.Tokens `json:"-"`
+	// APIKeyHash is the hash of the athlete's key for the gear rules API, or empty if no key has been issued
+	APIKeyHash string `json:"-"`
+	// Err is set by ListAthletes if the athlete's options could not be parsed, so that one bad record does not stop
+	// the other athletes being listed
+	Err error `json:"-"`
+}
+
+// HasScope reports whether the athlete granted the scope. Scopes were not recorded for athletes who connected before
+// they were checked, so these athletes are assumed to have granted every scope
+func (a *Athlete) HasScope(scope string) bool {
+	return a.Scopes == nil || a.Scopes.Has(scope)
+}
+
+// RulesOr returns the athlete's gear rules, or the default rules if the athlete has none
+func (a *Athlete) RulesOr(rules gear.Rules) gear.Rules {
+	if a.GearRules != nil {
+		return a.GearRules
+	}
+	return rules
+}
+
+// TopicArnOr returns the athlete's notification topic, or the default topic if the athlete has none
+func (a *Athlete) TopicArnOr(arn string) string {
+	if a.TopicArn != "" {
+		return a.TopicArn
+	}
+	return arn
+}
+
+type Client interface {
+	// GetAthlete returns ErrNotFound if the athlete has not authorized the app
+	GetAthlete(ctx context.Context, id int64) (*Athlete, error)
+	ListAthletes(ctx context.Context) ([]Athlete, error)
+	// Connect stores the name, granted scopes and tokens from an authorization. The options of an athlete who connected
+	// before are kept. It returns true if the athlete had not connected before
+	Connect(ctx context.Context, id int64, name string, scopes stravaapi.Scopes, tokens *stravaapi.Tokens) (bool, error)
+	// PutTokens replaces the tokens of a connected athlete. It returns ErrNotFound if the athlete has been deleted
+	PutTokens(ctx context.Context, id int64, tokens *stravaapi.Tokens) error
+	// PutOptions sets the gear rules and notification topic of a connected athlete. Nil rules and an empty topic
+	// restore the defaults
+	PutOptions(ctx context.Context, id int64, rules gear.Rules, topicArn string) error
+	// PutGearRules sets the gear rules of a connected athlete and leaves the notification topic unchanged. Nil rules
+	// restore the default rules
+	PutGearRules(ctx context.Context, id int64, rules gear.Rules) error
+	// PutAPIKeyHash replaces the hash of a connected athlete's API key. It returns ErrNotFound if the athlete has been
+	// deleted
+	PutAPIKeyHash(ctx context.Context, id int64, hash string) error
+	DeleteAthlete(ctx context.Context, id int64) error
+}
+
+func NewClient(dbClient *dynamodb.Client, tableName string) Client {
+	return &athletesClient{dbClient: dbClient, tableName: tableName}
+}
+
+type athletesClient struct {
+	dbClient  *dynamodb.Client
+	tableName string
+}
+
+func (a athletesClient) GetAthlete(ctx context.Context, id int64) (*Athlete, error) {
+	res, err := a.dbClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(a.tableName),
+		Key:            key(id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.Item == nil {
+		return nil, ErrNotFound
+	}
+	athlete, err := parseItem(res.Item)
+	if err != nil {
+		return nil, err
+	}
+	return athlete, nil
+}
+
+func (a athletesClient) ListAthletes(ctx context.Context) ([]Athlete, error) {
+	var athletes []Athlete
+	paginator := dynamodb.NewScanPaginator(a.dbClient, &dynamodb.ScanInput{
+		TableName: aws.String(a.tableName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			athlete, err := parseItem(item)
+			if athlete == nil {
+				return nil, err
+			}
+			athlete.Err = err
+			athletes = append(athletes, *athlete)
+		}
+	}
+	return athletes, nil
+}
+
+func (a athletesClient) Connect(ctx context.Context, id int64, athleteName string, granted stravaapi.Scopes, tokens *stravaapi.Tokens) (bool, error) {
+	res, err := a.dbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(a.tableName),
+		Key:              key(id),
+		ReturnValues:     dynamoTypes.ReturnValueAllOld,
+		UpdateExpression: aws.String("SET #name = :name, #connectedAt = :connectedAt, #scopes = :scopes, #access = :access, #refresh = :refresh, #expiresAt = :expiresAt"),
+		ExpressionAttributeNames: map[string]string{
+			"#name":        name,
+			"#connectedAt": connectedAt,
+			"#scopes":      scopes,
+			"#access":      accessToken,
+			"#refresh":     refreshToken,
+			"#expiresAt":   expiresAt,
+		},
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{
+			":name":        &dynamoTypes.AttributeValueMemberS{Value: athleteName},
+			":connectedAt": &dynamoTypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":scopes":      &dynamoTypes.AttributeValueMemberS{Value: granted.String()},
+			":access":      &dynamoTypes.AttributeValueMemberS{Value: tokens.AccessToken},
+			":refresh":     &dynamoTypes.AttributeValueMemberS{Value: tokens.RefreshToken},
+			":expiresAt":   &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(tokens.ExpiresAt)},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(res.Attributes) == 0, nil
+}
+
+func (a athletesClient) PutTokens(ctx context.Context, id int64, tokens *stravaapi.Tokens) error {
+	_, err := a.dbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(a.tableName),
+		Key:                 key(id),
+		ConditionExpression: aws.String("attribute_exists(#pk)"),
+		UpdateExpression:    aws.String("SET #access = :access, #refresh = :refresh, #expiresAt = :expiresAt"),
+		ExpressionAttributeNames: map[string]string{
+			"#pk":        pk,
+			"#access":    accessToken,
+			"#refresh":   refreshToken,
+			"#expiresAt": expiresAt,
+		},
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{
+			":access":    &dynamoTypes.AttributeValueMemberS{Value: tokens.AccessToken},
+			":refresh":   &dynamoTypes.AttributeValueMemberS{Value: tokens.RefreshToken},
+			":expiresAt": &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(tokens.ExpiresAt)},
+		},
+	})
+	if _, ok := errors.AsType[*dynamoTypes.ConditionalCheckFailedException](err); ok {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (a athletesClient) PutOptions(ctx context.Context, id int64, rules gear.Rules, arn string) error {
+	u := newOptionsUpdate()
+	err := u.rules(rules)
+	if err != nil {
+		return err
+	}
+	u.topic(arn)
+	return a.updateOptions(ctx, id, u)
+}
+
+func (a athletesClient) PutGearRules(ctx context.Context, id int64, rules gear.Rules) error {
+	u := newOptionsUpdate()
+	err := u.rules(rules)
+	if err != nil {
+		return err
+	}
+	return a.updateOptions(ctx, id, u)
+}
+
+func (a athletesClient) PutAPIKeyHash(ctx context.Context, id int64, hash string) error {
+	_, err := a.dbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(a.tableName),
+		Key:                 key(id),
+		ConditionExpression: aws.String("attribute_exists(#pk)"),
+		UpdateExpression:    aws.String("SET #hash = :hash"),
+		ExpressionAttributeNames: map[string]string{
+			"#pk":   pk,
+			"#hash": apiKeyHash,
+		},
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{
+			":hash": &dynamoTypes.AttributeValueMemberS{Value: hash},
+		},
+	})
+	if _, ok := errors.AsType[*dynamoTypes.ConditionalCheckFailedException](err); ok {
+		return ErrNotFound
+	}
+	return err
+}
+
+// optionsUpdate builds an update expression which sets the options which have a value and removes the others
+type optionsUpdate struct {
+	set    []string
+	remove []string
+	names  map[string]string
+	values map[string]dynamoTypes.AttributeValue
+}
+
+func newOptionsUpdate() *optionsUpdate {
+	return &optionsUpdate{
+		names:  map[string]string{"#pk": pk},
+		values: map[string]dynamoTypes.AttributeValue{},
+	}
+}
+
+func (u *optionsUpdate) rules(rules gear.Rules) error {
+	u.names["#rules"] = gearRules
+	if rules == nil {
+		u.remove = append(u.remove, "#rules")
+		return nil
+	}
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	u.set = append(u.set, "#rules = :rules")
+	u.values[":rules"] = &dynamoTypes.AttributeValueMemberS{Value: string(b)}
+	return nil
+}
+
+func (u *optionsUpdate) topic(arn string) {
+	u.names["#topic"] = topicArn
+	if arn == "" {
+		u.remove = append(u.remove, "#topic")
+		return
+	}
+	u.set = append(u.set, "#topic = :topic")
+	u.values[":topic"] = &dynamoTypes.AttributeValueMemberS{Value: arn}
+}
+
+// updateOptions applies the update to a connected athlete. It returns ErrNotFound if the athlete is not connected
+func (a athletesClient) updateOptions(ctx context.Context, id int64, u *optionsUpdate) error {
+	var clauses []string
+	if len(u.set) > 0 {
+		clauses = append(clauses, "SET "+strings.Join(u.set, ", "))
+	}
+	if len(u.remove) > 0 {
+		clauses = append(clauses, "REMOVE "+strings.Join(u.remove, ", "))
+	}
+	values := u.values
+	if len(values) == 0 {
+		values = nil
+	}
+
+	_, err := a.dbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(a.tableName),
+		Key:                       key(id),
+		ConditionExpression:       aws.String("attribute_exists(#pk)"),
+		UpdateExpression:          aws.String(strings.Join(clauses, " ")),
+		ExpressionAttributeNames:  u.names,
+		ExpressionAttributeValues: values,
+	})
+	if _, ok := errors.AsType[*dynamoTypes.ConditionalCheckFailedException](err); ok {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (a athletesClient) DeleteAthlete(ctx context.Context, id int64) error {
+	_, err := a.dbClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(a.tableName),
+		Key:       key(id),
+	})
+	return err
+}
+
+func key(id int64) map[string]dynamoTypes.AttributeValue {
+	return map[string]dynamoTypes.AttributeValue{
+		pk: &dynamoTypes.AttributeValueMemberS{Value: fmt.Sprint(id)},
+	}
+}
+
+// parseItem returns an error without an athlete if the key is invalid. If the options are invalid it returns the athlete
+// with the other fields set and an error
+func parseItem(item map[string]dynamoTypes.AttributeValue) (*Athlete, error) {
+	v, ok := item[pk].(*dynamoTypes.AttributeValueMemberS)
+	if !ok {
+		return nil, fmt.Errorf("missing %s", pk)
+	}
+	id, err := strconv.ParseInt(v.Value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", pk, err)
+	}
+
+	athlete := &Athlete{
+		ID:         id,
+		Name:       stringValue(item, name),
+		TopicArn:   stringValue(item, topicArn),
+		APIKeyHash: stringValue(item, apiKeyHash),
+		Tokens: stravaapi.Tokens{
+			AccessToken:  stringValue(item, accessToken),
+			RefreshToken: stringValue(item, refreshToken),
+		},
+	}
+	if v, ok := item[expiresAt].(*dynamoTypes.AttributeValueMemberN); ok {
+		athlete.Tokens.ExpiresAt, _ = strconv.ParseInt(v.Value, 10, 64)
+	}
+	if v := stringValue(item, connectedAt); v != "" {
+		athlete.ConnectedAt, _ = time.Parse(time.RFC3339, v)
+	}
+	if v, ok := item[scopes].(*dynamoTypes.AttributeValueMemberS); ok {
+		//An athlete who granted no scopes has an empty, not nil, list
+		athlete.Scopes = append(stravaapi.Scopes{}, stravaapi.ParseScopes(v.Value)...)
+	}
+	if v := stringValue(item, gearRules); v != "" {
+		athlete.GearRules, err = gear.ParseRules([]byte(v))
+		if err != nil {
+			return athlete, fmt.Errorf("invalid gear rules for athlete %d: %w", id, err)
+		}
+	}
+	return athlete, nil
+}
+
+func stringValue(item map[string]dynamoTypes.AttributeValue, attribute string) string {
+	if v, ok := item[attribute].(*dynamoTypes.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
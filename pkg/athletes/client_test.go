@@ -0,0 +1,164 @@
+package athletes
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ockendenjo/strava-shoes/pkg/gear"
+	"github.com/ockendenjo/strava-shoes/pkg/localaws"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) Client {
+	awsServer := localaws.NewServer()
+	awsServer.CreateTable("strava-athletes", pk, "")
+	awsHTTPServer := httptest.NewServer(awsServer)
+	t.Cleanup(awsHTTPServer.Close)
+	return NewClient(dynamodb.NewFromConfig(localaws.Config(awsHTTPServer.URL)), "strava-athletes")
+}
+
+func Test_Connect(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	rules := gear.Rules{"Run": {Forbidden: []string{"g1"}}}
+
+	first, err := client.Connect(ctx, 1001, "Jo Bloggs", stravaapi.Scopes{stravaapi.ScopeActivityReadAll}, &stravaapi.Tokens{AccessToken: "a1", RefreshToken: "r1", ExpiresAt: 100})
+	require.NoError(t, err)
+	assert.True(t, first)
+	err = client.PutOptions(ctx, 1001, rules, "arn:aws:sns:eu-west-1:123:strava-jo")
+	require.NoError(t, err)
+	require.NoError(t, client.PutAPIKeyHash(ctx, 1001, "hash"))
+
+	//Connecting again replaces the tokens and keeps the options
+	first, err = client.Connect(ctx, 1001, "Jo Bloggs", stravaapi.Scopes{stravaapi.ScopeActivityReadAll, stravaapi.ScopeActivityWrite}, &stravaapi.Tokens{AccessToken: "a2", RefreshToken: "r2", ExpiresAt: 200})
+	require.NoError(t, err)
+	assert.False(t, first)
+
+	athlete, err := client.GetAthlete(ctx, 1001)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1001), athlete.ID)
+	assert.Equal(t, "Jo Bloggs", athlete.Name)
+	assert.False(t, athlete.ConnectedAt.IsZero())
+	assert.Equal(t, stravaapi.Scopes{stravaapi.ScopeActivityReadAll, stravaapi.ScopeActivityWrite}, athlete.Scopes)
+	assert.True(t, athlete.HasScope(stravaapi.ScopeActivityWrite))
+	assert.Equal(t, stravaapi.Tokens{AccessToken: "a2", RefreshToken: "r2", ExpiresAt: 200}, athlete.Tokens)
+	assert.Equal(t, rules, athlete.GearRules)
+	assert.Equal(t, "arn:aws:sns:eu-west-1:123:strava-jo", athlete.TopicArn)
+	assert.Equal(t, "hash", athlete.APIKeyHash)
+}
+
+func Test_PutOptions(t *testing.T) {
+	defaults := gear.Rules{"Ride": {Allowed: []string{"b1"}}}
+	testcases := []struct {
+		name     string
+		rules    gear.Rules
+		topicArn string
+		expRules gear.Rules
+		expTopic string
+		connect  bool
+		expErr   error
+	}{
+		{
+			name:     "athlete options",
+			connect:  true,
+			rules:    gear.Rules{"Run": {Forbidden: []string{"g1"}}},
+			topicArn: "arn:aws:sns:eu-west-1:123:strava-jo",
+			expRules: gear.Rules{"Run": {Forbidden: []string{"g1"}}},
+			expTopic: "arn:aws:sns:eu-west-1:123:strava-jo",
+		},
+		{
+			name:     "defaults",
+			connect:  true,
+			expRules: defaults,
+			expTopic: "default-topic",
+		},
+		{
+			name:   "athlete not connected",
+			rules:  gear.Rules{"Run": {Forbidden: []string{"g1"}}},
+			expErr: ErrNotFound,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := newTestClient(t)
+			if tc.connect {
+				_, err := client.Connect(ctx, 1001, "Jo Bloggs", stravaapi.Scopes{stravaapi.ScopeActivityReadAll}, &stravaapi.Tokens{AccessToken: "a1"})
+				require.NoError(t, err)
+				require.NoError(t, client.PutOptions(ctx, 1001, gear.Rules{"Hike": {}}, "arn:aws:sns:eu-west-1:123:strava-old"))
+			}
+
+			err := client.PutOptions(ctx, 1001, tc.rules, tc.topicArn)
+			if tc.expErr != nil {
+				assert.ErrorIs(t, err, tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+
+			athlete, err := client.GetAthlete(ctx, 1001)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expRules, athlete.RulesOr(defaults))
+			assert.Equal(t, tc.expTopic, athlete.TopicArnOr("default-topic"))
+		})
+	}
+}
+
+func Test_PutTokens_deleted(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	_, err := client.Connect(ctx, 1001, "Jo Bloggs", stravaapi.Scopes{stravaapi.ScopeActivityReadAll}, &stravaapi.Tokens{AccessToken: "a1"})
+	require.NoError(t, err)
+	_, err = client.Connect(ctx, 1002, "Sam Smith", stravaapi.Scopes{stravaapi.ScopeActivityReadAll}, &stravaapi.Tokens{AccessToken: "a2"})
+	require.NoError(t, err)
+	require.NoError(t, client.DeleteAthlete(ctx, 1001))
+
+	//A refresh which finishes after the athlete revoked access must not store the athlete again
+	err = client.PutTokens(ctx, 1001, &stravaapi.Tokens{AccessToken: "a3"})
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, client.PutAPIKeyHash(ctx, 1001, "hash"), ErrNotFound)
+	_, err = client.GetAthlete(ctx, 1001)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	connected, err := client.ListAthletes(ctx)
+	require.NoError(t, err)
+	require.Len(t, connected, 1)
+	assert.Equal(t, int64(1002), connected[0].ID)
+}
+
+func Test_ListAthletes_invalidRules(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	for _, id := range []int64{1001, 1002} {
+		_, err := client.Connect(ctx, id, "", stravaapi.Scopes{stravaapi.ScopeActivityReadAll}, &stravaapi.Tokens{AccessToken: "a1"})
+		require.NoError(t, err)
+	}
+	_, err := client.(*athletesClient).dbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("strava-athletes"),
+		Key:                       key(1001),
+		UpdateExpression:          aws.String("SET #rules = :rules"),
+		ExpressionAttributeNames:  map[string]string{"#rules": gearRules},
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{":rules": &dynamoTypes.AttributeValueMemberS{Value: "{"}},
+	})
+	require.NoError(t, err)
+
+	_, err = client.GetAthlete(ctx, 1001)
+	assert.Error(t, err)
+
+	//The athlete with invalid rules is listed with an error, so that the other athletes can still be checked
+	connected, err := client.ListAthletes(ctx)
+	require.NoError(t, err)
+	require.Len(t, connected, 2)
+	errs := map[int64]error{}
+	for _, athlete := range connected {
+		errs[athlete.ID] = athlete.Err
+	}
+	assert.Error(t, errs[1001])
+	assert.NoError(t, errs[1002])
+}
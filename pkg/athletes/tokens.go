@@ -0,0 +1,29 @@
+package athletes
+
+import (
+	"context"
+
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+)
+
+// NewTokenStore returns a store for the tokens of one athlete, for use with stravaapi.NewClient
+func NewTokenStore(client Client, athleteID int64) stravaapi.TokenStore {
+	return &tokenStore{client: client, athleteID: athleteID}
+}
+
+type tokenStore struct {
+	client    Client
+	athleteID int64
+}
+
+func (s *tokenStore) GetTokens(ctx context.Context) (*stravaapi.Tokens, error) {
+	athlete, err := s.client.GetAthlete(ctx, s.athleteID)
+	if err != nil {
+		return nil, err
+	}
+	return &athlete.Tokens, nil
+}
+
+func (s *tokenStore) PutTokens(ctx context.Context, tokens *stravaapi.Tokens) error {
+	return s.client.PutTokens(ctx, s.athleteID, tokens)
+}
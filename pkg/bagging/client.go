@@ -3,59 +3,311 @@ package bagging
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ockendenjo/strava-shoes/pkg/dynamo"
 )
 
 const pk = "ID"
-const expiry = "Expiry"
+const expiry = dynamo.ExpiryAttribute
+const state = dynamo.StateAttribute
+const checkedAt = "CheckedAt"
+const datasetVersion = "DatasetVersion"
+const bagCount = "BagCount"
+const athleteID = "AthleteID"
 
 type Client interface {
-	HasId(ctx context.Context, d int64) (bool, error)
-	PutId(ctx context.Context, id int64) error
+	// HasIds returns the IDs which have been sent for a bagging check
+	HasIds(ctx context.Context, ids []int64) (map[int64]bool, error)
+	// PutIds marks the activities as sent. The record of an activity which has already been checked is not changed, as
+	// the bagging check may finish before the sender marks the activity
+	PutIds(ctx context.Context, ids []int64) error
+	// Claim claims the activities and returns those which have not been sent for a bagging check and are not claimed
+	// by another check
+	Claim(ctx context.Context, ids []int64) ([]int64, error)
+	// Release removes a pending claim so that the activity can be claimed again
+	Release(ctx context.Context, id int64) error
+	// PutRecord stores the result of a bagging check
+	PutRecord(ctx context.Context, record Record) error
+	// ListStale returns the activities which were sent for a bagging check but have not been checked against the
+	// dataset version. AthleteID is zero for activities which have not been checked
+	ListStale(ctx context.Context, datasetVersion string) ([]Record, error)
+	// DeleteAthlete removes the records of the athlete's checked activities and returns the number removed
+	DeleteAthlete(ctx context.Context, athleteID int64) (int, error)
 }
 
-func NewClient(dbClient *dynamodb.Client, tableName string) Client {
-	return &baggingClient{dbClient: dbClient, tableName: tableName}
+// Record is the result of a bagging check for an activity
+type Record struct {
+	ID             int64     `json:"id"`
+	AthleteID      int64     `json:"athleteId"`
+	CheckedAt      time.Time `json:"checkedAt"`
+	DatasetVersion string    `json:"datasetVersion"`
+	BagCount       int       `json:"bagCount"`
+}
+
+// NewClient returns a client for the bagging table. Records expire after ttl, or are kept if ttl is zero
+func NewClient(dbClient *dynamodb.Client, tableName string, ttl time.Duration) Client {
+	return newClient(dbClient, tableName, ttl, time.Now)
+}
+
+func newClient(dbClient *dynamodb.Client, tableName string, ttl time.Duration, now func() time.Time) *baggingClient {
+	return &baggingClient{
+		dbClient:  dbClient,
+		tableName: tableName,
+		ttl:       ttl,
+		now:       now,
+		claims:    dynamo.NewClaims(dbClient, tableName, pk, ttl, now),
+	}
 }
 
 type baggingClient struct {
 	dbClient  *dynamodb.Client
 	tableName string
+	ttl       time.Duration
+	now       func() time.Time
+	claims    *dynamo.Claims
+}
+
+func (b baggingClient) HasIds(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	keys := make([]map[string]dynamoTypes.AttributeValue, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, map[string]dynamoTypes.AttributeValue{
+			pk: &dynamoTypes.AttributeValueMemberS{Value: fmt.Sprint(id)},
+		})
+	}
+	items, err := dynamo.BatchGet(ctx, b.dbClient, b.tableName, dynamoTypes.KeysAndAttributes{
+		Keys:                     keys,
+		ProjectionExpression:     aws.String("#pk, #state, #expiry"),
+		ExpressionAttributeNames: map[string]string{"#pk": pk, "#state": state, "#expiry": expiry},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sent := make(map[int64]bool)
+	for _, item := range items {
+		if !b.isSent(item) {
+			continue
+		}
+		v, ok := item[pk].(*dynamoTypes.AttributeValueMemberS)
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", pk, err)
+		}
+		sent[id] = true
+	}
+	return sent, nil
 }
 
-func (b baggingClient) HasId(ctx context.Context, id int64) (bool, error) {
-	res, err := b.dbClient.GetItem(ctx, &dynamodb.GetItemInput{
+// PutIds marks the activities as sent in transactions of up to 100 activities
+func (b baggingClient) PutIds(ctx context.Context, ids []int64) error {
+	now := b.now()
+	items := make([]dynamoTypes.TransactWriteItem, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, dynamoTypes.TransactWriteItem{Update: b.markSent(id, now)})
+	}
+	//An update whose condition fails is for an activity which has already been sent or checked
+	_, err := dynamo.TransactWrite(ctx, b.dbClient, items)
+	return err
+}
+
+// markSent sets the state of a new, pending or expired item to sent. The fields of a record from a bagging check are
+// never overwritten, but are removed from an expired item so that it matches a new item
+func (b baggingClient) markSent(id int64, now time.Time) *dynamoTypes.Update {
+	update := "SET #state = :sent"
+	values := map[string]dynamoTypes.AttributeValue{
+		":sent":    &dynamoTypes.AttributeValueMemberS{Value: dynamo.StateSent},
+		":pending": &dynamoTypes.AttributeValueMemberS{Value: dynamo.StatePending},
+		":now":     &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(now.Unix())},
+	}
+	remove := " REMOVE #athlete, #checkedAt, #version, #bagCount"
+	if b.ttl > 0 {
+		update += ", #expiry = :expiry"
+		values[":expiry"] = &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(now.Add(b.ttl).Unix())}
+	} else {
+		remove += ", #expiry"
+	}
+
+	return &dynamoTypes.Update{
 		TableName: aws.String(b.tableName),
 		Key: map[string]dynamoTypes.AttributeValue{
 			pk: &dynamoTypes.AttributeValueMemberS{
 				Value: fmt.Sprint(id),
 			},
 		},
-	})
+		UpdateExpression:    aws.String(update + remove),
+		ConditionExpression: aws.String("attribute_not_exists(#pk) OR #state = :pending OR #expiry < :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#pk":        pk,
+			"#state":     state,
+			"#expiry":    expiry,
+			"#athlete":   athleteID,
+			"#checkedAt": checkedAt,
+			"#version":   datasetVersion,
+			"#bagCount":  bagCount,
+		},
+		ExpressionAttributeValues: values,
+	}
+}
+
+// isSent returns false for missing items, pending claims and items which have expired but which DynamoDB has not yet
+// deleted
+func (b baggingClient) isSent(item map[string]dynamoTypes.AttributeValue) bool {
+	if item == nil {
+		return false
+	}
+	if v, ok := item[expiry].(*dynamoTypes.AttributeValueMemberN); ok {
+		expiryTime, err := strconv.ParseInt(v.Value, 10, 64)
+		if err == nil && expiryTime < b.now().Unix() {
+			return false
+		}
+	}
+	v, ok := item[state].(*dynamoTypes.AttributeValueMemberS)
+	return !ok || v.Value != dynamo.StatePending
+}
+
+func (b baggingClient) Claim(ctx context.Context, ids []int64) ([]int64, error) {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, fmt.Sprint(id))
+	}
+	claimedKeys, err := b.claims.ClaimAll(ctx, keys)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return res.Item != nil, nil
+
+	claimed := make([]int64, 0, len(claimedKeys))
+	for _, key := range claimedKeys {
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, id)
+	}
+	return claimed, nil
 }
 
-func (b baggingClient) PutId(ctx context.Context, id int64) error {
+func (b baggingClient) Release(ctx context.Context, id int64) error {
+	return b.claims.Release(ctx, fmt.Sprint(id))
+}
 
-	expiryTime := time.Now().AddDate(0, 2, 0).Unix()
+func (b baggingClient) PutRecord(ctx context.Context, record Record) error {
+	update := "SET #state = :sent, #athlete = :athlete, #checkedAt = :checkedAt, #version = :version, #bagCount = :bagCount"
+	names := map[string]string{
+		"#state":     state,
+		"#athlete":   athleteID,
+		"#checkedAt": checkedAt,
+		"#version":   datasetVersion,
+		"#bagCount":  bagCount,
+		"#expiry":    expiry,
+	}
+	values := map[string]dynamoTypes.AttributeValue{
+		":sent":      &dynamoTypes.AttributeValueMemberS{Value: dynamo.StateSent},
+		":athlete":   &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(record.AthleteID)},
+		":checkedAt": &dynamoTypes.AttributeValueMemberS{Value: record.CheckedAt.UTC().Format(time.RFC3339)},
+		":version":   &dynamoTypes.AttributeValueMemberS{Value: record.DatasetVersion},
+		":bagCount":  &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(record.BagCount)},
+	}
+	if b.ttl > 0 {
+		update += ", #expiry = :expiry"
+		values[":expiry"] = &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(record.CheckedAt.Add(b.ttl).Unix())}
+	} else {
+		update += " REMOVE #expiry"
+	}
 
-	_, err := b.dbClient.PutItem(ctx, &dynamodb.PutItemInput{
+	_, err := b.dbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(b.tableName),
-		Item: map[string]dynamoTypes.AttributeValue{
+		Key: map[string]dynamoTypes.AttributeValue{
 			pk: &dynamoTypes.AttributeValueMemberS{
-				Value: fmt.Sprint(id),
-			},
-			expiry: &dynamoTypes.AttributeValueMemberN{
-				Value: fmt.Sprint(expiryTime),
+				Value: fmt.Sprint(record.ID),
 			},
 		},
+		UpdateExpression:          aws.String(update),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
 	})
 	return err
 }
+
+func (b baggingClient) ListStale(ctx context.Context, version string) ([]Record, error) {
+	var records []Record
+	paginator := dynamodb.NewScanPaginator(b.dbClient, &dynamodb.ScanInput{
+		TableName:            aws.String(b.tableName),
+		ProjectionExpression: aws.String("#pk, #athlete, #version"),
+		FilterExpression:     aws.String("(attribute_not_exists(#state) OR #state <> :pending) AND (attribute_not_exists(#version) OR #version <> :version) AND (attribute_not_exists(#expiry) OR #expiry >= :now)"),
+		ExpressionAttributeNames: map[string]string{
+			"#pk":      pk,
+			"#athlete": athleteID,
+			"#state":   state,
+			"#version": datasetVersion,
+			"#expiry":  expiry,
+		},
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{
+			":pending": &dynamoTypes.AttributeValueMemberS{Value: dynamo.StatePending},
+			":version": &dynamoTypes.AttributeValueMemberS{Value: version},
+			":now":     &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(b.now().Unix())},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			v, ok := item[pk].(*dynamoTypes.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			id, err := strconv.ParseInt(v.Value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", pk, err)
+			}
+			record := Record{ID: id}
+			if v, ok := item[athleteID].(*dynamoTypes.AttributeValueMemberN); ok {
+				record.AthleteID, _ = strconv.ParseInt(v.Value, 10, 64)
+			}
+			if v, ok := item[datasetVersion].(*dynamoTypes.AttributeValueMemberS); ok {
+				record.DatasetVersion = v.Value
+			}
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (b baggingClient) DeleteAthlete(ctx context.Context, athlete int64) (int, error) {
+	deleted := 0
+	paginator := dynamodb.NewScanPaginator(b.dbClient, &dynamodb.ScanInput{
+		TableName:                aws.String(b.tableName),
+		ProjectionExpression:     aws.String("#pk"),
+		FilterExpression:         aws.String("#athlete = :athlete"),
+		ExpressionAttributeNames: map[string]string{"#pk": pk, "#athlete": athleteID},
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{
+			":athlete": &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(athlete)},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return deleted, err
+		}
+
+		keys := make([]map[string]dynamoTypes.AttributeValue, 0, len(page.Items))
+		for _, item := range page.Items {
+			keys = append(keys, map[string]dynamoTypes.AttributeValue{pk: item[pk]})
+		}
+		n, err := dynamo.DeleteItems(ctx, b.dbClient, b.tableName, keys)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
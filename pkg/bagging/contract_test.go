@@ -0,0 +1,280 @@
+package bagging
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ockendenjo/strava-shoes/pkg/dynamo"
+	"github.com/ockendenjo/strava-shoes/pkg/dynamo/dynamotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clientFactory returns an empty client which reads the time from now
+type clientFactory func(t *testing.T, ttl time.Duration, now func() time.Time) Client
+
+func TestMemoryClient(t *testing.T) {
+	runContractTests(t, func(t *testing.T, ttl time.Duration, now func() time.Time) Client {
+		return &memoryClient{items: make(map[int64]memoryItem), ttl: ttl, now: now}
+	})
+}
+
+func TestFileClient(t *testing.T) {
+	runContractTests(t, func(t *testing.T, ttl time.Duration, now func() time.Time) Client {
+		client, err := NewFileClient(filepath.Join(t.TempDir(), "bagging.json"), ttl)
+		require.NoError(t, err)
+		client.(*memoryClient).now = now
+		return client
+	})
+}
+
+func TestFileClient_reload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bagging.json")
+
+	client, err := NewFileClient(path, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, client.PutIds(ctx, []int64{1, 2}))
+	claimed, err := client.Claim(ctx, []int64{3})
+	require.NoError(t, err)
+	require.Equal(t, []int64{3}, claimed)
+
+	reloaded, err := NewFileClient(path, time.Hour)
+	require.NoError(t, err)
+	sent, err := reloaded.HasIds(ctx, []int64{1, 2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]bool{1: true, 2: true}, sent)
+	claimed, err = reloaded.Claim(ctx, []int64{3})
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+}
+
+func TestLocalAWSClient(t *testing.T) {
+	runContractTests(t, func(t *testing.T, ttl time.Duration, now func() time.Time) Client {
+		return newClient(dynamotest.LocalAWSTable(t, "strava-bagging", pk), "strava-bagging", ttl, now)
+	})
+}
+
+// TestDynamoDBClient runs the contract tests against DynamoDB Local
+func TestDynamoDBClient(t *testing.T) {
+	dbClient := dynamotest.DynamoDBLocal(t)
+	runContractTests(t, func(t *testing.T, ttl time.Duration, now func() time.Time) Client {
+		return newClient(dbClient, dynamotest.CreateTable(t, dbClient, "bagging-contract", pk), ttl, now)
+	})
+}
+
+func runContractTests(t *testing.T, newClient clientFactory) {
+	ctx := context.Background()
+	start := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("claim and confirm", func(t *testing.T) {
+		clock := dynamotest.NewClock(start)
+		client := newClient(t, time.Hour, clock.Now)
+
+		claimed, err := client.Claim(ctx, []int64{1, 2})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1, 2}, claimed)
+
+		claimed, err = client.Claim(ctx, []int64{1, 3})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{3}, claimed, "second claim")
+
+		sent, err := client.HasIds(ctx, []int64{1})
+		require.NoError(t, err)
+		assert.Empty(t, sent, "pending claim is not sent")
+
+		require.NoError(t, client.PutIds(ctx, []int64{1}))
+		sent, err = client.HasIds(ctx, []int64{1})
+		require.NoError(t, err)
+		assert.Equal(t, map[int64]bool{1: true}, sent)
+
+		clock.Advance(dynamo.ClaimTimeout * 2)
+		claimed, err = client.Claim(ctx, []int64{1})
+		require.NoError(t, err)
+		assert.Empty(t, claimed, "claim after confirm")
+	})
+
+	t.Run("release", func(t *testing.T) {
+		client := newClient(t, time.Hour, dynamotest.NewClock(start).Now)
+
+		claimed, err := client.Claim(ctx, []int64{1})
+		require.NoError(t, err)
+		require.Equal(t, []int64{1}, claimed)
+		require.NoError(t, client.Release(ctx, 1))
+
+		claimed, err = client.Claim(ctx, []int64{1})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1}, claimed, "claim after release")
+
+		require.NoError(t, client.PutIds(ctx, []int64{1}))
+		require.NoError(t, client.Release(ctx, 1))
+		sent, err := client.HasIds(ctx, []int64{1})
+		require.NoError(t, err)
+		assert.Equal(t, map[int64]bool{1: true}, sent, "release does not remove confirmed claim")
+
+		require.NoError(t, client.Release(ctx, 2), "release unknown ID")
+	})
+
+	t.Run("stale claim", func(t *testing.T) {
+		clock := dynamotest.NewClock(start)
+		client := newClient(t, time.Hour, clock.Now)
+
+		claimed, err := client.Claim(ctx, []int64{1})
+		require.NoError(t, err)
+		require.Equal(t, []int64{1}, claimed)
+
+		clock.Advance(dynamo.ClaimTimeout - time.Minute)
+		claimed, err = client.Claim(ctx, []int64{1})
+		require.NoError(t, err)
+		assert.Empty(t, claimed, "claim within timeout")
+
+		clock.Advance(2 * time.Minute)
+		claimed, err = client.Claim(ctx, []int64{1})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1}, claimed, "claim after timeout")
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		client := newClient(t, time.Hour, dynamotest.NewClock(start).Now)
+
+		var ids, odd, even []int64
+		exp := make(map[int64]bool)
+		for id := int64(1); id <= 120; id++ {
+			ids = append(ids, id)
+			if id%2 == 0 {
+				even = append(even, id)
+				exp[id] = true
+			} else {
+				odd = append(odd, id)
+			}
+		}
+		require.NoError(t, client.PutIds(ctx, even))
+		claimed, err := client.Claim(ctx, []int64{1})
+		require.NoError(t, err)
+		require.Equal(t, []int64{1}, claimed)
+
+		sent, err := client.HasIds(ctx, ids)
+		require.NoError(t, err)
+		assert.Equal(t, exp, sent)
+
+		claimed, err = client.Claim(ctx, ids)
+		require.NoError(t, err)
+		assert.Equal(t, odd[1:], claimed, "claims the odd IDs except the pending claim")
+	})
+
+	t.Run("record before sent", func(t *testing.T) {
+		clock := dynamotest.NewClock(start)
+		client := newClient(t, time.Hour, clock.Now)
+
+		//The bagging check can store its record before the sender marks the activity as sent
+		claimed, err := client.Claim(ctx, []int64{1})
+		require.NoError(t, err)
+		require.Equal(t, []int64{1}, claimed)
+		require.NoError(t, client.PutRecord(ctx, Record{ID: 1, AthleteID: 1001, CheckedAt: clock.Now(), DatasetVersion: "v1", BagCount: 2}))
+		require.NoError(t, client.PutIds(ctx, []int64{1}))
+
+		stale, err := client.ListStale(ctx, "v1")
+		require.NoError(t, err)
+		assert.Empty(t, stale, "record is kept")
+		stale, err = client.ListStale(ctx, "v2")
+		require.NoError(t, err)
+		assert.Equal(t, []Record{{ID: 1, AthleteID: 1001, DatasetVersion: "v1"}}, stale)
+
+		deleted, err := client.DeleteAthlete(ctx, 1001)
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		clock := dynamotest.NewClock(start)
+		client := newClient(t, time.Hour, clock.Now)
+
+		require.NoError(t, client.PutIds(ctx, []int64{1}))
+		require.NoError(t, client.PutRecord(ctx, Record{ID: 2, CheckedAt: clock.Now(), DatasetVersion: "v1"}))
+
+		clock.Advance(59 * time.Minute)
+		sent, err := client.HasIds(ctx, []int64{1, 2})
+		require.NoError(t, err)
+		assert.Equal(t, map[int64]bool{1: true, 2: true}, sent, "before expiry")
+
+		clock.Advance(2 * time.Minute)
+		sent, err = client.HasIds(ctx, []int64{1, 2})
+		require.NoError(t, err)
+		assert.Empty(t, sent, "after expiry")
+		stale, err := client.ListStale(ctx, "v2")
+		require.NoError(t, err)
+		assert.Empty(t, stale, "expired records are not stale")
+
+		claimed, err := client.Claim(ctx, []int64{1})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1}, claimed, "claim after expiry")
+	})
+
+	t.Run("expired record is marked sent", func(t *testing.T) {
+		clock := dynamotest.NewClock(start)
+		client := newClient(t, time.Hour, clock.Now)
+
+		require.NoError(t, client.PutRecord(ctx, Record{ID: 1, AthleteID: 1001, CheckedAt: clock.Now(), DatasetVersion: "v1", BagCount: 2}))
+		clock.Advance(2 * time.Hour)
+		require.NoError(t, client.PutIds(ctx, []int64{1}))
+
+		sent, err := client.HasIds(ctx, []int64{1})
+		require.NoError(t, err)
+		assert.Equal(t, map[int64]bool{1: true}, sent)
+		stale, err := client.ListStale(ctx, "v1")
+		require.NoError(t, err)
+		assert.Equal(t, []Record{{ID: 1}}, stale, "check fields are removed")
+		deleted, err := client.DeleteAthlete(ctx, 1001)
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+	})
+
+	t.Run("no ttl", func(t *testing.T) {
+		clock := dynamotest.NewClock(start)
+		client := newClient(t, 0, clock.Now)
+
+		require.NoError(t, client.PutIds(ctx, []int64{1}))
+		clock.Advance(10 * 365 * 24 * time.Hour)
+		sent, err := client.HasIds(ctx, []int64{1})
+		require.NoError(t, err)
+		assert.Equal(t, map[int64]bool{1: true}, sent)
+	})
+
+	t.Run("stale records", func(t *testing.T) {
+		clock := dynamotest.NewClock(start)
+		client := newClient(t, time.Hour, clock.Now)
+
+		require.NoError(t, client.PutIds(ctx, []int64{1}))
+		require.NoError(t, client.PutRecord(ctx, Record{ID: 2, AthleteID: 1001, CheckedAt: clock.Now(), DatasetVersion: "v1", BagCount: 2}))
+		require.NoError(t, client.PutRecord(ctx, Record{ID: 3, AthleteID: 1001, CheckedAt: clock.Now(), DatasetVersion: "v2"}))
+		claimed, err := client.Claim(ctx, []int64{4})
+		require.NoError(t, err)
+		require.Equal(t, []int64{4}, claimed)
+
+		stale, err := client.ListStale(ctx, "v2")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []Record{{ID: 1}, {ID: 2, AthleteID: 1001, DatasetVersion: "v1"}}, stale)
+
+		sent, err := client.HasIds(ctx, []int64{3})
+		require.NoError(t, err)
+		assert.Equal(t, map[int64]bool{3: true}, sent, "record is sent")
+	})
+
+	t.Run("delete athlete", func(t *testing.T) {
+		clock := dynamotest.NewClock(start)
+		client := newClient(t, time.Hour, clock.Now)
+
+		require.NoError(t, client.PutRecord(ctx, Record{ID: 1, AthleteID: 1001, CheckedAt: clock.Now(), DatasetVersion: "v1"}))
+		require.NoError(t, client.PutRecord(ctx, Record{ID: 2, AthleteID: 1001, CheckedAt: clock.Now(), DatasetVersion: "v1"}))
+		require.NoError(t, client.PutRecord(ctx, Record{ID: 3, AthleteID: 1002, CheckedAt: clock.Now(), DatasetVersion: "v1"}))
+		deleted, err := client.DeleteAthlete(ctx, 1001)
+		require.NoError(t, err)
+		assert.Equal(t, 2, deleted)
+
+		sent, err := client.HasIds(ctx, []int64{1, 2, 3})
+		require.NoError(t, err)
+		assert.Equal(t, map[int64]bool{3: true}, sent)
+	})
+}
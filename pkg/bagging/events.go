@@ -0,0 +1,64 @@
+package bagging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// DetailType is the EventBridge detail type of the event which starts a bagging check for an activity
+const DetailType = "StravaActivityBaggingCheck"
+
+// maxEventEntries is the most entries EventBridge accepts in one PutEvents call
+const maxEventEntries = 10
+
+// CheckEvent is the detail of a bagging check event
+type CheckEvent struct {
+	ID        int64 `json:"id"`
+	AthleteID int64 `json:"athleteId"`
+}
+
+// SendChecks publishes a bagging check event for each of the athlete's activities, in batches of up to 10 entries. It
+// returns the IDs which were published and the IDs which failed
+func SendChecks(ctx context.Context, ebClient *eventbridge.Client, athleteID int64, ids []int64) ([]int64, []int64, error) {
+	var published, failed []int64
+	var errs []error
+	for chunk := range slices.Chunk(ids, maxEventEntries) {
+		entries := make([]types.PutEventsRequestEntry, 0, len(chunk))
+		for _, id := range chunk {
+			detail, _ := json.Marshal(CheckEvent{ID: id, AthleteID: athleteID})
+			entries = append(entries, types.PutEventsRequestEntry{
+				Source:     aws.String("io.ockenden.strava"),
+				DetailType: aws.String(DetailType),
+				Detail:     aws.String(string(detail)),
+			})
+		}
+
+		res, err := ebClient.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries})
+		if err != nil {
+			failed = append(failed, chunk...)
+			errs = append(errs, fmt.Errorf("error sending EventBridge events: %w", err))
+			continue
+		}
+
+		var chunkFailed []int64
+		for i, id := range chunk {
+			if i < len(res.Entries) && res.Entries[i].ErrorCode == nil {
+				published = append(published, id)
+			} else {
+				chunkFailed = append(chunkFailed, id)
+			}
+		}
+		if len(chunkFailed) > 0 {
+			failed = append(failed, chunkFailed...)
+			errs = append(errs, fmt.Errorf("error sending EventBridge events for IDs %v: failed", chunkFailed))
+		}
+	}
+	return published, failed, errors.Join(errs...)
+}
@@ -0,0 +1,52 @@
+package bagging
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// NewFileClient returns a client which keeps records in memory and writes them to a JSON file after every change. The
+// records in the file are loaded if it exists
+func NewFileClient(path string, ttl time.Duration) (Client, error) {
+	items := make(map[int64]memoryItem)
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		err = json.Unmarshal(b, &items)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m := &memoryClient{items: items, ttl: ttl, now: time.Now}
+	m.onChange = func(items map[int64]memoryItem) error {
+		return writeItems(path, items)
+	}
+	return m, nil
+}
+
+// writeItems replaces the file so that a crash does not leave it half written
+func writeItems(path string, items map[int64]memoryItem) error {
+	b, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	closeErr := tmp.Close()
+	if err = errors.Join(err, closeErr); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,170 @@
+package bagging
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ockendenjo/strava-shoes/pkg/dynamo"
+)
+
+// NewMemoryClient returns a client which holds records in memory, for running the lambdas locally and in tests
+func NewMemoryClient(ttl time.Duration) Client {
+	return &memoryClient{items: make(map[int64]memoryItem), ttl: ttl, now: time.Now}
+}
+
+// memoryItem mirrors the attributes of an item in the DynamoDB table. Times are unix seconds, as in DynamoDB
+type memoryItem struct {
+	State          string `json:"state,omitempty"`
+	AthleteID      int64  `json:"athleteId,omitempty"`
+	ClaimedAt      int64  `json:"claimedAt,omitempty"`
+	CheckedAt      int64  `json:"checkedAt,omitempty"`
+	DatasetVersion string `json:"datasetVersion,omitempty"`
+	BagCount       int    `json:"bagCount,omitempty"`
+	Expiry         int64  `json:"expiry,omitempty"`
+}
+
+type memoryClient struct {
+	mu    sync.Mutex
+	items map[int64]memoryItem
+	ttl   time.Duration
+	now   func() time.Time
+	// onChange is called with the lock held after each write
+	onChange func(items map[int64]memoryItem) error
+}
+
+func (m *memoryClient) HasIds(_ context.Context, ids []int64) (map[int64]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sent := make(map[int64]bool)
+	for _, id := range ids {
+		if m.isSent(id) {
+			sent[id] = true
+		}
+	}
+	return sent, nil
+}
+
+func (m *memoryClient) PutIds(_ context.Context, ids []int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		m.markSent(id)
+	}
+	return m.changed()
+}
+
+// markSent sets the state of a new, pending or expired item to sent, leaving the fields of a checked record unchanged
+func (m *memoryClient) markSent(id int64) {
+	item, found := m.items[id]
+	if found && item.State != dynamo.StatePending && !m.expired(item) {
+		return
+	}
+	if !found || m.expired(item) {
+		item = memoryItem{}
+	}
+	item.State = dynamo.StateSent
+	item.Expiry = m.expiry(m.now())
+	m.items[id] = item
+}
+
+func (m *memoryClient) Claim(_ context.Context, ids []int64) ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	var claimed []int64
+	for _, id := range ids {
+		item, found := m.items[id]
+		stale := item.State == dynamo.StatePending && item.ClaimedAt < now.Add(-dynamo.ClaimTimeout).Unix()
+		if found && !m.expired(item) && !stale {
+			continue
+		}
+		m.items[id] = memoryItem{State: dynamo.StatePending, ClaimedAt: now.Unix(), Expiry: m.expiry(now)}
+		claimed = append(claimed, id)
+	}
+	return claimed, m.changed()
+}
+
+func (m *memoryClient) Release(_ context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.items[id].State != dynamo.StatePending {
+		return nil
+	}
+	delete(m.items, id)
+	return m.changed()
+}
+
+func (m *memoryClient) PutRecord(_ context.Context, record Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item := m.items[record.ID]
+	item.State = dynamo.StateSent
+	item.AthleteID = record.AthleteID
+	item.CheckedAt = record.CheckedAt.Unix()
+	item.DatasetVersion = record.DatasetVersion
+	item.BagCount = record.BagCount
+	item.Expiry = m.expiry(record.CheckedAt)
+	m.items[record.ID] = item
+	return m.changed()
+}
+
+func (m *memoryClient) ListStale(_ context.Context, version string) ([]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var records []Record
+	for id, item := range m.items {
+		if item.State != dynamo.StatePending && item.DatasetVersion != version && !m.expired(item) {
+			records = append(records, Record{ID: id, AthleteID: item.AthleteID, DatasetVersion: item.DatasetVersion})
+		}
+	}
+	slices.SortFunc(records, func(a, b Record) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return records, nil
+}
+
+func (m *memoryClient) DeleteAthlete(_ context.Context, athleteID int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	for id, item := range m.items {
+		if item.AthleteID == athleteID {
+			delete(m.items, id)
+			deleted++
+		}
+	}
+	return deleted, m.changed()
+}
+
+func (m *memoryClient) isSent(id int64) bool {
+	item, found := m.items[id]
+	return found && !m.expired(item) && item.State != dynamo.StatePending
+}
+
+func (m *memoryClient) expired(item memoryItem) bool {
+	return item.Expiry != 0 && item.Expiry < m.now().Unix()
+}
+
+func (m *memoryClient) expiry(from time.Time) int64 {
+	if m.ttl <= 0 {
+		return 0
+	}
+	return from.Add(m.ttl).Unix()
+}
+
+func (m *memoryClient) changed() error {
+	if m.onChange == nil {
+		return nil
+	}
+	return m.onChange(m.items)
+}
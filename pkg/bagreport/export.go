@@ -0,0 +1,117 @@
+package bagreport
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	Type       string            `json:"type"`
+	Geometry   pointGeometry     `json:"geometry"`
+	Properties featureProperties `json:"properties"`
+}
+
+type pointGeometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type featureProperties struct {
+	ID              int      `json:"id"`
+	Name            string   `json:"name"`
+	Height          float64  `json:"height"`
+	GridRef         string   `json:"gridRef,omitempty"`
+	Classifications []string `json:"classes,omitempty"`
+	Bagged          bool     `json:"bagged"`
+	Ascents         []Ascent `json:"ascents,omitempty"`
+}
+
+// GeoJSON returns the summits as a GeoJSON feature collection of points
+func (r *Report) GeoJSON() ([]byte, error) {
+	collection := featureCollection{Type: "FeatureCollection", Features: make([]feature, 0, len(r.Summits))}
+	for _, summit := range r.Summits {
+		collection.Features = append(collection.Features, feature{
+			Type: "Feature",
+			Geometry: pointGeometry{
+				Type:        "Point",
+				Coordinates: []float64{summit.Lon, summit.Lat, summit.Height},
+			},
+			Properties: featureProperties{
+				ID:              summit.ID,
+				Name:            summit.Name,
+				Height:          summit.Height,
+				GridRef:         summit.GridRef,
+				Classifications: summit.Classifications,
+				Bagged:          summit.IsBagged(),
+				Ascents:         summit.Ascents,
+			},
+		})
+	}
+	return json.Marshal(collection)
+}
+
+type kmlDocument struct {
+	XMLName  xml.Name `xml:"http://www.opengis.net/kml/2.2 kml"`
+	Document struct {
+		Name    string      `xml:"name"`
+		Folders []kmlFolder `xml:"Folder"`
+	} `xml:"Document"`
+}
+
+type kmlFolder struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+	Point       struct {
+		Coordinates string `xml:"coordinates"`
+	} `xml:"Point"`
+}
+
+// KML returns the summits as a KML document with folders for bagged and unbagged hills
+func (r *Report) KML() ([]byte, error) {
+	doc := kmlDocument{}
+	doc.Document.Name = fmt.Sprintf("Hill bagging (%s)", r.DatasetVersion)
+	bagged := kmlFolder{Name: "Bagged"}
+	unbagged := kmlFolder{Name: "Unbagged"}
+
+	for _, summit := range r.Summits {
+		placemark := kmlPlacemark{
+			Name:        summit.Name,
+			Description: kmlDescription(summit),
+		}
+		placemark.Point.Coordinates = fmt.Sprintf("%g,%g,%g", summit.Lon, summit.Lat, summit.Height)
+
+		if summit.IsBagged() {
+			bagged.Placemarks = append(bagged.Placemarks, placemark)
+		} else {
+			unbagged.Placemarks = append(unbagged.Placemarks, placemark)
+		}
+	}
+	doc.Document.Folders = []kmlFolder{bagged, unbagged}
+
+	b, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func kmlDescription(summit Summit) string {
+	lines := []string{fmt.Sprintf("%gm %s", summit.Height, strings.Join(summit.Classifications, ", "))}
+	for _, ascent := range summit.Ascents {
+		lines = append(lines, fmt.Sprintf("%s %s", ascent.Date.Format(time.DateOnly), ascent.URL))
+	}
+	return strings.Join(lines, "\n")
+}
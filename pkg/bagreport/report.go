@@ -0,0 +1,95 @@
+// Package bagreport summarises an athlete's bags against a hill dataset
+package bagreport
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ockendenjo/strava-shoes/pkg/bags"
+	"github.com/ockendenjo/strava-shoes/pkg/hills"
+)
+
+// ClassProgress is the number of hills bagged in a classification
+type ClassProgress struct {
+	Class  string `json:"class"`
+	Bagged int    `json:"bagged"`
+	Total  int    `json:"total"`
+}
+
+func (p ClassProgress) String() string {
+	return fmt.Sprintf("%ss: %d/%d", p.Class, p.Bagged, p.Total)
+}
+
+// Summit is a hill with the activities on which it was bagged
+type Summit struct {
+	hills.Hill
+	Ascents []Ascent `json:"ascents,omitempty"`
+}
+
+func (s Summit) IsBagged() bool {
+	return len(s.Ascents) > 0
+}
+
+// Ascent links a bag to its Strava activity
+type Ascent struct {
+	ActivityID int64     `json:"activityId"`
+	Date       time.Time `json:"date"`
+	URL        string    `json:"url"`
+}
+
+// Report combines a hill dataset with an athlete's bags
+type Report struct {
+	DatasetVersion string   `json:"datasetVersion"`
+	Summits        []Summit `json:"summits"`
+}
+
+// New builds a report. If class is not empty then only hills in that classification are included
+func New(dataset *hills.Dataset, bagList []bags.Bag, class string) *Report {
+	ascents := make(map[int][]Ascent)
+	for _, bag := range bagList {
+		ascents[bag.HillID] = append(ascents[bag.HillID], Ascent{
+			ActivityID: bag.ActivityID,
+			Date:       bag.Date,
+			URL:        ActivityURL(bag.ActivityID),
+		})
+	}
+
+	report := &Report{DatasetVersion: dataset.Version}
+	for _, hill := range dataset.Hills {
+		if class != "" && !slices.Contains(hill.Classifications, class) {
+			continue
+		}
+		hillAscents := ascents[hill.ID]
+		slices.SortFunc(hillAscents, func(a, b Ascent) int {
+			return a.Date.Compare(b.Date)
+		})
+		report.Summits = append(report.Summits, Summit{Hill: hill, Ascents: hillAscents})
+	}
+	return report
+}
+
+func ActivityURL(activityID int64) string {
+	return fmt.Sprintf("https://www.strava.com/activities/%d", activityID)
+}
+
+// Progress returns the bagged and total hill counts for each classification, in order of first appearance in the dataset
+func (r *Report) Progress() []ClassProgress {
+	var progress []ClassProgress
+	positions := make(map[string]int)
+	for _, summit := range r.Summits {
+		for _, class := range summit.Classifications {
+			i, found := positions[class]
+			if !found {
+				i = len(progress)
+				positions[class] = i
+				progress = append(progress, ClassProgress{Class: class})
+			}
+			progress[i].Total++
+			if summit.IsBagged() {
+				progress[i].Bagged++
+			}
+		}
+	}
+	return progress
+}
@@ -0,0 +1,91 @@
+package bagreport
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ockendenjo/strava-shoes/pkg/bags"
+	"github.com/ockendenjo/strava-shoes/pkg/hills"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDataset = &hills.Dataset{
+	Version: "test-1",
+	Hills: []hills.Hill{
+		{ID: 1, Name: "Ben Nevis", Lat: 56.79685, Lon: -5.0036, Height: 1345, Classifications: []string{"Munro", "Marilyn"}},
+		{ID: 2, Name: "Ben Lomond", Lat: 56.19018, Lon: -4.63281, Height: 974, Classifications: []string{"Munro", "Marilyn"}},
+		{ID: 4, Name: "Arthur's Seat", Lat: 55.94411, Lon: -3.16184, Height: 251, Classifications: []string{"Marilyn"}},
+	},
+}
+
+var testBags = []bags.Bag{
+	{AthleteID: 9, HillID: 4, HillName: "Arthur's Seat", ActivityID: 200, Date: time.Date(2026, 5, 2, 0, 0, 0, 0, time.UTC)},
+	{AthleteID: 9, HillID: 4, HillName: "Arthur's Seat", ActivityID: 100, Date: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+	{AthleteID: 9, HillID: 1, HillName: "Ben Nevis", ActivityID: 300, Date: time.Date(2026, 6, 3, 0, 0, 0, 0, time.UTC)},
+}
+
+func TestProgress(t *testing.T) {
+	testCases := []struct {
+		name  string
+		class string
+		want  []string
+	}{
+		{name: "all classifications", want: []string{"Munros: 1/2", "Marilyns: 2/3"}},
+		{name: "filtered by classification", class: "Munro", want: []string{"Munros: 1/2", "Marilyns: 1/2"}},
+		{name: "unknown classification", class: "Corbett"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, p := range New(testDataset, testBags, tc.class).Progress() {
+				got = append(got, p.String())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestNew_sortsAscents(t *testing.T) {
+	report := New(testDataset, testBags, "")
+
+	require.Len(t, report.Summits, 3)
+	seat := report.Summits[2]
+	require.Len(t, seat.Ascents, 2)
+	assert.Equal(t, int64(100), seat.Ascents[0].ActivityID)
+	assert.Equal(t, "https://www.strava.com/activities/100", seat.Ascents[0].URL)
+	assert.False(t, report.Summits[1].IsBagged())
+}
+
+func TestGeoJSON(t *testing.T) {
+	b, err := New(testDataset, testBags, "").GeoJSON()
+	require.NoError(t, err)
+
+	var collection featureCollection
+	require.NoError(t, json.Unmarshal(b, &collection))
+	assert.Equal(t, "FeatureCollection", collection.Type)
+	require.Len(t, collection.Features, 3)
+
+	nevis := collection.Features[0]
+	assert.Equal(t, []float64{-5.0036, 56.79685, 1345}, nevis.Geometry.Coordinates)
+	assert.True(t, nevis.Properties.Bagged)
+	assert.Equal(t, "https://www.strava.com/activities/300", nevis.Properties.Ascents[0].URL)
+	assert.False(t, collection.Features[1].Properties.Bagged)
+}
+
+func TestKML(t *testing.T) {
+	b, err := New(testDataset, testBags, "").KML()
+	require.NoError(t, err)
+
+	kml := string(b)
+	assert.True(t, strings.HasPrefix(kml, "<?xml"))
+	bagged, unbagged, found := strings.Cut(kml, "<name>Unbagged</name>")
+	require.True(t, found)
+	assert.Contains(t, bagged, "<name>Ben Nevis</name>")
+	assert.Contains(t, bagged, "https://www.strava.com/activities/300")
+	assert.Contains(t, bagged, "<coordinates>-5.0036,56.79685,1345</coordinates>")
+	assert.Contains(t, unbagged, "<name>Ben Lomond</name>")
+}
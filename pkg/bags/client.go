@@ -0,0 +1,160 @@
+package bags
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ockendenjo/strava-shoes/pkg/dynamo"
+)
+
+const pk = "AthleteID"
+const sk = "BagID"
+const hillID = "HillID"
+const hillName = "HillName"
+const activityID = "ActivityID"
+const date = "Date"
+
+// Bag records that an athlete reached a hill summit during an activity
+type Bag struct {
+	AthleteID  int64     `json:"athleteId"`
+	HillID     int       `json:"hillId"`
+	HillName   string    `json:"hillName"`
+	ActivityID int64     `json:"activityId"`
+	Date       time.Time `json:"date"`
+}
+
+type Client interface {
+	PutBag(ctx context.Context, bag Bag) error
+	GetBags(ctx context.Context, athleteID int64) ([]Bag, error)
+	// DeleteAthlete removes the athlete's bags and returns the number removed
+	DeleteAthlete(ctx context.Context, athleteID int64) (int, error)
+}
+
+func NewClient(dbClient *dynamodb.Client, tableName string) Client {
+	return &bagsClient{dbClient: dbClient, tableName: tableName}
+}
+
+type bagsClient struct {
+	dbClient  *dynamodb.Client
+	tableName string
+}
+
+// PutBag stores a bag. Storing the same hill and activity again overwrites the previous record
+func (b bagsClient) PutBag(ctx context.Context, bag Bag) error {
+	_, err := b.dbClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(b.tableName),
+		Item: map[string]dynamoTypes.AttributeValue{
+			pk:         &dynamoTypes.AttributeValueMemberS{Value: fmt.Sprint(bag.AthleteID)},
+			sk:         &dynamoTypes.AttributeValueMemberS{Value: fmt.Sprintf("%d#%d", bag.HillID, bag.ActivityID)},
+			hillID:     &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(bag.HillID)},
+			hillName:   &dynamoTypes.AttributeValueMemberS{Value: bag.HillName},
+			activityID: &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(bag.ActivityID)},
+			date:       &dynamoTypes.AttributeValueMemberS{Value: bag.Date.UTC().Format(time.RFC3339)},
+		},
+	})
+	return err
+}
+
+func (b bagsClient) GetBags(ctx context.Context, athleteID int64) ([]Bag, error) {
+	var bags []Bag
+	paginator := dynamodb.NewQueryPaginator(b.dbClient, &dynamodb.QueryInput{
+		TableName:              aws.String(b.tableName),
+		KeyConditionExpression: aws.String("#pk = :id"),
+		ExpressionAttributeNames: map[string]string{
+			"#pk": pk,
+		},
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{
+			":id": &dynamoTypes.AttributeValueMemberS{Value: fmt.Sprint(athleteID)},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			bag, err := parseBag(athleteID, item)
+			if err != nil {
+				return nil, err
+			}
+			bags = append(bags, *bag)
+		}
+	}
+	return bags, nil
+}
+
+func (b bagsClient) DeleteAthlete(ctx context.Context, athleteID int64) (int, error) {
+	deleted := 0
+	paginator := dynamodb.NewQueryPaginator(b.dbClient, &dynamodb.QueryInput{
+		TableName:              aws.String(b.tableName),
+		KeyConditionExpression: aws.String("#pk = :id"),
+		ProjectionExpression:   aws.String("#pk, #sk"),
+		ExpressionAttributeNames: map[string]string{
+			"#pk": pk,
+			"#sk": sk,
+		},
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{
+			":id": &dynamoTypes.AttributeValueMemberS{Value: fmt.Sprint(athleteID)},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return deleted, err
+		}
+
+		keys := make([]map[string]dynamoTypes.AttributeValue, 0, len(page.Items))
+		for _, item := range page.Items {
+			keys = append(keys, map[string]dynamoTypes.AttributeValue{pk: item[pk], sk: item[sk]})
+		}
+		n, err := dynamo.DeleteItems(ctx, b.dbClient, b.tableName, keys)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+func parseBag(athleteID int64, item map[string]dynamoTypes.AttributeValue) (*Bag, error) {
+	hill, err := strconv.Atoi(getNumber(item, hillID))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", hillID, err)
+	}
+	activity, err := strconv.ParseInt(getNumber(item, activityID), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", activityID, err)
+	}
+	bagDate, err := time.Parse(time.RFC3339, getString(item, date))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", date, err)
+	}
+	return &Bag{
+		AthleteID:  athleteID,
+		HillID:     hill,
+		HillName:   getString(item, hillName),
+		ActivityID: activity,
+		Date:       bagDate,
+	}, nil
+}
+
+func getString(item map[string]dynamoTypes.AttributeValue, key string) string {
+	v, ok := item[key].(*dynamoTypes.AttributeValueMemberS)
+	if !ok {
+		return ""
+	}
+	return v.Value
+}
+
+func getNumber(item map[string]dynamoTypes.AttributeValue, key string) string {
+	v, ok := item[key].(*dynamoTypes.AttributeValueMemberN)
+	if !ok {
+		return ""
+	}
+	return v.Value
+}
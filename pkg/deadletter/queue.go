@@ -0,0 +1,116 @@
+// Package deadletter stores EventBridge events which could not be published so that they can be redriven later
+package deadletter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+// DefaultPrefix is the S3 key prefix used for dead letters
+const DefaultPrefix = "dead-letter/"
+
+// Entry is an event which could not be published
+type Entry struct {
+	Source     string    `json:"source"`
+	DetailType string    `json:"detailType"`
+	Detail     string    `json:"detail"`
+	FailedAt   time.Time `json:"failedAt"`
+	Reason     string    `json:"reason"`
+}
+
+type Queue interface {
+	Put(ctx context.Context, entry Entry) error
+	List(ctx context.Context) ([]string, error)
+	Get(ctx context.Context, key string) (*Entry, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func NewS3Queue(s3Client *s3.Client, bucket string, prefix string) Queue {
+	return &s3Queue{s3Client: s3Client, bucket: bucket, prefix: prefix}
+}
+
+type s3Queue struct {
+	s3Client *s3.Client
+	bucket   string
+	prefix   string
+}
+
+func (q *s3Queue) Put(ctx context.Context, entry Entry) error {
+	key, b, err := q.object(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(q.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(b),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// object returns the key and JSON body of a dead letter. Keys are grouped by the day the event failed, e.g.
+// dead-letter/2026-06-01/<uuid>.json, and the body is read back by Get when an event is redriven
+func (q *s3Queue) object(entry Entry) (string, []byte, error) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return "", nil, err
+	}
+	key := fmt.Sprintf("%s%s/%s.json", q.prefix, entry.FailedAt.UTC().Format(time.DateOnly), uuid.NewString())
+	return key, b, nil
+}
+
+// List returns the keys of all dead letters
+func (q *s3Queue) List(ctx context.Context) ([]string, error) {
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(q.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(q.bucket),
+		Prefix: aws.String(q.prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	return keys, nil
+}
+
+func (q *s3Queue) Get(ctx context.Context, key string) (*Entry, error) {
+	res, err := q.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(q.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	var entry Entry
+	err = json.NewDecoder(res.Body).Decode(&entry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dead letter %s: %w", key, err)
+	}
+	return &entry, nil
+}
+
+func (q *s3Queue) Delete(ctx context.Context, key string) error {
+	_, err := q.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(q.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
@@ -0,0 +1,46 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_object(t *testing.T) {
+	q := &s3Queue{bucket: "dead-letters", prefix: DefaultPrefix}
+	entry := Entry{
+		Source:     "io.ockenden.strava",
+		DetailType: "StravaActivityCreated",
+		Detail:     `{"object_id":1360128428}`,
+		//The key uses the UTC date
+		FailedAt: time.Date(2026, 6, 1, 23, 30, 0, 0, time.FixedZone("-01", -3600)),
+		Reason:   "EventBridge rejected event: ThrottlingException",
+	}
+
+	key, body, err := q.object(entry)
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^dead-letter/2026-06-02/[0-9a-f-]{36}\.json$`), key)
+	assert.JSONEq(t, `{
+		"source": "io.ockenden.strava",
+		"detailType": "StravaActivityCreated",
+		"detail": "{\"object_id\":1360128428}",
+		"failedAt": "2026-06-01T23:30:00-01:00",
+		"reason": "EventBridge rejected event: ThrottlingException"
+	}`, string(body))
+
+	//The redrive script republishes the entry which Get decodes from the body
+	var decoded Entry
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Equal(t, entry.Source, decoded.Source)
+	assert.Equal(t, entry.DetailType, decoded.DetailType)
+	assert.Equal(t, entry.Detail, decoded.Detail)
+	assert.True(t, entry.FailedAt.Equal(decoded.FailedAt))
+
+	otherKey, _, err := q.object(entry)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, otherKey, "each dead letter has its own key")
+}
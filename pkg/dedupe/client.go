@@ -0,0 +1,25 @@
+package dedupe
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/ockendenjo/strava-shoes/pkg/dynamo"
+)
+
+const pk = "ID"
+
+type Client interface {
+	// Claim returns true if the key has not been sent and is not claimed by another request
+	Claim(ctx context.Context, key string) (bool, error)
+	// Confirm marks a claimed key as sent, so that it cannot be claimed again
+	Confirm(ctx context.Context, key string) error
+	// Release removes a pending claim so that the key can be claimed again
+	Release(ctx context.Context, key string) error
+}
+
+// NewClient returns a client for the table of webhook events. Keys can be claimed again once they expire after ttl
+func NewClient(dbClient *dynamodb.Client, tableName string, ttl time.Duration) Client {
+	return dynamo.NewClaims(dbClient, tableName, pk, ttl, time.Now)
+}
@@ -0,0 +1,31 @@
+package dedupe
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ockendenjo/strava-shoes/pkg/dynamo/dynamotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The claims are tested in pkg/dynamo, so this only checks that a redelivered event is not claimed again
+func TestClient_redelivery(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(dynamotest.LocalAWSTable(t, "strava-webhook-events", pk), "strava-webhook-events", time.Hour)
+	key := "activity/1360128428/create/1549560669"
+
+	claimed, err := client.Claim(ctx, key)
+	require.NoError(t, err)
+	require.True(t, claimed)
+	require.NoError(t, client.Confirm(ctx, key))
+
+	claimed, err = client.Claim(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, claimed, "redelivered event")
+
+	claimed, err = client.Claim(ctx, "activity/1360128428/update/1549560670")
+	require.NoError(t, err)
+	assert.True(t, claimed, "later event for the activity")
+}
@@ -0,0 +1,88 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Limits on the number of items in one request
+const (
+	maxBatchWrite = 25
+	maxBatchGet   = 100
+)
+
+const maxBatchAttempts = 5
+
+// BatchGet reads the items with the keys in request, in calls of up to 100 keys. Unprocessed keys are retried
+func BatchGet(ctx context.Context, dbClient *dynamodb.Client, tableName string, request dynamoTypes.KeysAndAttributes) ([]map[string]dynamoTypes.AttributeValue, error) {
+	var items []map[string]dynamoTypes.AttributeValue
+	for chunk := range slices.Chunk(request.Keys, maxBatchGet) {
+		keys := request
+		keys.Keys = chunk
+		for attempt := 0; len(keys.Keys) > 0; attempt++ {
+			if attempt >= maxBatchAttempts {
+				return nil, fmt.Errorf("%d unprocessed keys after %d attempts", len(keys.Keys), attempt)
+			}
+			backoff(attempt)
+
+			res, err := dbClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: map[string]dynamoTypes.KeysAndAttributes{tableName: keys},
+			})
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, res.Responses[tableName]...)
+			keys.Keys = res.UnprocessedKeys[tableName].Keys
+		}
+	}
+	return items, nil
+}
+
+// DeleteItems deletes the items with the given keys, in calls of up to 25 keys, and returns the number deleted.
+// Unprocessed deletes are retried
+func DeleteItems(ctx context.Context, dbClient *dynamodb.Client, tableName string, keys []map[string]dynamoTypes.AttributeValue) (int, error) {
+	deleted := 0
+	for chunk := range slices.Chunk(keys, maxBatchWrite) {
+		requests := make([]dynamoTypes.WriteRequest, 0, len(chunk))
+		for _, key := range chunk {
+			requests = append(requests, dynamoTypes.WriteRequest{DeleteRequest: &dynamoTypes.DeleteRequest{Key: key}})
+		}
+		err := batchWrite(ctx, dbClient, tableName, requests)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += len(chunk)
+	}
+	return deleted, nil
+}
+
+// batchWrite writes up to 25 requests, retrying any unprocessed requests
+func batchWrite(ctx context.Context, dbClient *dynamodb.Client, tableName string, requests []dynamoTypes.WriteRequest) error {
+	for attempt := 0; len(requests) > 0; attempt++ {
+		if attempt >= maxBatchAttempts {
+			return fmt.Errorf("%d unprocessed items after %d attempts", len(requests), attempt)
+		}
+		backoff(attempt)
+
+		res, err := dbClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]dynamoTypes.WriteRequest{tableName: requests},
+		})
+		if err != nil {
+			return err
+		}
+		requests = res.UnprocessedItems[tableName]
+	}
+	return nil
+}
+
+// backoff waits before retrying unprocessed items
+func backoff(attempt int) {
+	if attempt > 0 {
+		time.Sleep(time.Duration(attempt*50) * time.Millisecond)
+	}
+}
@@ -0,0 +1,182 @@
+// Package dynamo holds helpers shared by the clients of the DynamoDB tables
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Attributes written by Claims
+const (
+	StateAttribute     = "State"
+	ClaimedAtAttribute = "ClaimedAt"
+	ExpiryAttribute    = "Expiry"
+)
+
+// ClaimTimeout is how long a pending claim is held. A claim which is not confirmed within this time, for example
+// because the lambda crashed before publishing the event, can be claimed again
+const ClaimTimeout = 5 * time.Minute
+
+// States of a claimed key. Items written before states were added have no state and are treated as StateSent
+const (
+	StatePending = "pending"
+	StateSent    = "sent"
+)
+
+// ErrNotClaimed is returned when confirming a key which has no claim
+var ErrNotClaimed = errors.New("key has not been claimed")
+
+// Claims stops work being repeated by overlapping or retried requests. A key is claimed as pending before the work is
+// done, then confirmed as sent, or released if the work failed
+type Claims struct {
+	dbClient  *dynamodb.Client
+	tableName string
+	keyName   string
+	ttl       time.Duration
+	now       func() time.Time
+}
+
+// NewClaims returns claims on the string partition key keyName of a table. Claims expire after ttl, or are kept if
+// ttl is zero
+func NewClaims(dbClient *dynamodb.Client, tableName string, keyName string, ttl time.Duration, now func() time.Time) *Claims {
+	return &Claims{dbClient: dbClient, tableName: tableName, keyName: keyName, ttl: ttl, now: now}
+}
+
+// Claim returns true if the key has not been sent and is not claimed by another request
+func (c *Claims) Claim(ctx context.Context, key string) (bool, error) {
+	put := c.claimPut(key, c.now())
+	_, err := c.dbClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 put.TableName,
+		Item:                      put.Item,
+		ConditionExpression:       put.ConditionExpression,
+		ExpressionAttributeNames:  put.ExpressionAttributeNames,
+		ExpressionAttributeValues: put.ExpressionAttributeValues,
+	})
+	if _, ok := errors.AsType[*dynamoTypes.ConditionalCheckFailedException](err); ok {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ClaimAll claims the keys in transactions of up to 100 keys, and returns the keys which have not been sent and are
+// not claimed by another request
+func (c *Claims) ClaimAll(ctx context.Context, keys []string) ([]string, error) {
+	now := c.now()
+	seen := make(map[string]bool)
+	var unique []string
+	var items []dynamoTypes.TransactWriteItem
+	for _, key := range keys {
+		//A transaction cannot write an item twice
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, key)
+		items = append(items, dynamoTypes.TransactWriteItem{Put: c.claimPut(key, now)})
+	}
+
+	failed, err := TransactWrite(ctx, c.dbClient, items)
+	if err != nil {
+		return nil, err
+	}
+	claimed := make([]string, 0, len(unique))
+	for i, key := range unique {
+		if !failed[i] {
+			claimed = append(claimed, key)
+		}
+	}
+	return claimed, nil
+}
+
+// claimPut replaces a missing, expired or stale item with a pending claim
+func (c *Claims) claimPut(key string, now time.Time) *dynamoTypes.Put {
+	item := map[string]dynamoTypes.AttributeValue{
+		c.keyName: &dynamoTypes.AttributeValueMemberS{
+			Value: key,
+		},
+		StateAttribute: &dynamoTypes.AttributeValueMemberS{
+			Value: StatePending,
+		},
+		ClaimedAtAttribute: &dynamoTypes.AttributeValueMemberN{
+			Value: fmt.Sprint(now.Unix()),
+		},
+	}
+	if c.ttl > 0 {
+		item[ExpiryAttribute] = &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(now.Add(c.ttl).Unix())}
+	}
+
+	return &dynamoTypes.Put{
+		TableName:           aws.String(c.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#pk) OR #expiry < :now OR (#state = :pending AND #claimedAt < :stale)"),
+		ExpressionAttributeNames: map[string]string{
+			"#pk":        c.keyName,
+			"#state":     StateAttribute,
+			"#claimedAt": ClaimedAtAttribute,
+			"#expiry":    ExpiryAttribute,
+		},
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{
+			":pending": &dynamoTypes.AttributeValueMemberS{Value: StatePending},
+			":stale":   &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(now.Add(-ClaimTimeout).Unix())},
+			":now":     &dynamoTypes.AttributeValueMemberN{Value: fmt.Sprint(now.Unix())},
+		},
+	}
+}
+
+// Confirm marks a claimed key as sent, so that it cannot be claimed again until it expires
+func (c *Claims) Confirm(ctx context.Context, key string) error {
+	_, err := c.dbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName),
+		Key: map[string]dynamoTypes.AttributeValue{
+			c.keyName: &dynamoTypes.AttributeValueMemberS{
+				Value: key,
+			},
+		},
+		UpdateExpression:    aws.String("SET #state = :sent"),
+		ConditionExpression: aws.String("attribute_exists(#pk)"),
+		ExpressionAttributeNames: map[string]string{
+			"#pk":    c.keyName,
+			"#state": StateAttribute,
+		},
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{
+			":sent": &dynamoTypes.AttributeValueMemberS{Value: StateSent},
+		},
+	})
+	if _, ok := errors.AsType[*dynamoTypes.ConditionalCheckFailedException](err); ok {
+		return ErrNotClaimed
+	}
+	return err
+}
+
+// Release removes a pending claim so that the key can be claimed again. A confirmed claim is kept
+func (c *Claims) Release(ctx context.Context, key string) error {
+	_, err := c.dbClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(c.tableName),
+		Key: map[string]dynamoTypes.AttributeValue{
+			c.keyName: &dynamoTypes.AttributeValueMemberS{
+				Value: key,
+			},
+		},
+		ConditionExpression: aws.String("#state = :pending"),
+		ExpressionAttributeNames: map[string]string{
+			"#state": StateAttribute,
+		},
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{
+			":pending": &dynamoTypes.AttributeValueMemberS{Value: StatePending},
+		},
+	})
+	if _, ok := errors.AsType[*dynamoTypes.ConditionalCheckFailedException](err); ok {
+		//The claim has already been confirmed
+		return nil
+	}
+	return err
+}
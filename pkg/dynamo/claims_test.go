@@ -0,0 +1,162 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/ockendenjo/strava-shoes/pkg/dynamo/dynamotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "ID"
+
+// claimsFactory returns claims on an empty table which read the time from now
+type claimsFactory func(t *testing.T, ttl time.Duration, now func() time.Time) *Claims
+
+func TestClaims_localAWS(t *testing.T) {
+	runClaimsTests(t, func(t *testing.T, ttl time.Duration, now func() time.Time) *Claims {
+		return NewClaims(dynamotest.LocalAWSTable(t, "claims", testKey), "claims", testKey, ttl, now)
+	})
+}
+
+func TestClaims_dynamoDBLocal(t *testing.T) {
+	dbClient := dynamotest.DynamoDBLocal(t)
+	runClaimsTests(t, func(t *testing.T, ttl time.Duration, now func() time.Time) *Claims {
+		return newClaims(t, dbClient, ttl, now)
+	})
+}
+
+func newClaims(t *testing.T, dbClient *dynamodb.Client, ttl time.Duration, now func() time.Time) *Claims {
+	return NewClaims(dbClient, dynamotest.CreateTable(t, dbClient, "claims", testKey), testKey, ttl, now)
+}
+
+func runClaimsTests(t *testing.T, newClaims claimsFactory) {
+	ctx := context.Background()
+	start := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("claim and confirm", func(t *testing.T) {
+		clock := dynamotest.NewClock(start)
+		claims := newClaims(t, time.Hour, clock.Now)
+
+		claimed, err := claims.Claim(ctx, "a")
+		require.NoError(t, err)
+		assert.True(t, claimed)
+
+		claimed, err = claims.Claim(ctx, "a")
+		require.NoError(t, err)
+		assert.False(t, claimed, "second claim")
+
+		claimed, err = claims.Claim(ctx, "b")
+		require.NoError(t, err)
+		assert.True(t, claimed, "other key")
+
+		require.NoError(t, claims.Confirm(ctx, "a"))
+		clock.Advance(ClaimTimeout * 2)
+		claimed, err = claims.Claim(ctx, "a")
+		require.NoError(t, err)
+		assert.False(t, claimed, "claim after confirm")
+
+		clock.Advance(time.Hour)
+		claimed, err = claims.Claim(ctx, "a")
+		require.NoError(t, err)
+		assert.True(t, claimed, "claim after expiry")
+	})
+
+	t.Run("confirm without claim", func(t *testing.T) {
+		claims := newClaims(t, time.Hour, dynamotest.NewClock(start).Now)
+		assert.ErrorIs(t, claims.Confirm(ctx, "a"), ErrNotClaimed)
+	})
+
+	t.Run("release", func(t *testing.T) {
+		claims := newClaims(t, time.Hour, dynamotest.NewClock(start).Now)
+
+		claimed, err := claims.Claim(ctx, "a")
+		require.NoError(t, err)
+		require.True(t, claimed)
+		require.NoError(t, claims.Release(ctx, "a"))
+
+		claimed, err = claims.Claim(ctx, "a")
+		require.NoError(t, err)
+		assert.True(t, claimed, "claim after release")
+
+		require.NoError(t, claims.Confirm(ctx, "a"))
+		require.NoError(t, claims.Release(ctx, "a"))
+		claimed, err = claims.Claim(ctx, "a")
+		require.NoError(t, err)
+		assert.False(t, claimed, "release does not remove confirmed claim")
+
+		require.NoError(t, claims.Release(ctx, "b"), "release unknown key")
+	})
+
+	t.Run("stale claim", func(t *testing.T) {
+		clock := dynamotest.NewClock(start)
+		claims := newClaims(t, time.Hour, clock.Now)
+
+		claimed, err := claims.Claim(ctx, "a")
+		require.NoError(t, err)
+		require.True(t, claimed)
+
+		clock.Advance(ClaimTimeout - time.Minute)
+		claimed, err = claims.Claim(ctx, "a")
+		require.NoError(t, err)
+		assert.False(t, claimed, "claim within timeout")
+
+		clock.Advance(2 * time.Minute)
+		claimed, err = claims.Claim(ctx, "a")
+		require.NoError(t, err)
+		assert.True(t, claimed, "claim after timeout")
+	})
+
+	t.Run("claim all", func(t *testing.T) {
+		clock := dynamotest.NewClock(start)
+		claims := newClaims(t, time.Hour, clock.Now)
+
+		claimed, err := claims.Claim(ctx, "sent")
+		require.NoError(t, err)
+		require.True(t, claimed)
+		require.NoError(t, claims.Confirm(ctx, "sent"))
+		claimed, err = claims.Claim(ctx, "pending")
+		require.NoError(t, err)
+		require.True(t, claimed)
+
+		//More keys than fit in one transaction, with duplicates
+		keys := []string{"sent", "pending"}
+		var exp []string
+		for i := range 150 {
+			keys = append(keys, fmt.Sprint(i))
+			exp = append(exp, fmt.Sprint(i))
+		}
+		keys = append(keys, "sent", "0")
+		all, err := claims.ClaimAll(ctx, keys)
+		require.NoError(t, err)
+		assert.Equal(t, exp, all)
+
+		all, err = claims.ClaimAll(ctx, keys)
+		require.NoError(t, err)
+		assert.Empty(t, all, "second claim")
+
+		clock.Advance(ClaimTimeout * 2)
+		all, err = claims.ClaimAll(ctx, []string{"sent", "pending", "new"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"pending", "new"}, all, "after claim timeout")
+	})
+
+	t.Run("no ttl", func(t *testing.T) {
+		clock := dynamotest.NewClock(start)
+		claims := newClaims(t, 0, clock.Now)
+
+		claimed, err := claims.Claim(ctx, "a")
+		require.NoError(t, err)
+		require.True(t, claimed)
+		require.NoError(t, claims.Confirm(ctx, "a"))
+
+		clock.Advance(10 * 365 * 24 * time.Hour)
+		claimed, err = claims.Claim(ctx, "a")
+		require.NoError(t, err)
+		assert.False(t, claimed)
+	})
+}
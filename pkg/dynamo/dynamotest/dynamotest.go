@@ -0,0 +1,82 @@
+// Package dynamotest runs the tests of DynamoDB clients against localaws, or against DynamoDB Local if
+// DYNAMODB_ENDPOINT is set
+package dynamotest
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ockendenjo/strava-shoes/pkg/localaws"
+	"github.com/stretchr/testify/require"
+)
+
+// Clock is a clock for tests which only moves when it is advanced
+type Clock struct {
+	t time.Time
+}
+
+func NewClock(t time.Time) *Clock {
+	return &Clock{t: t}
+}
+
+func (c *Clock) Now() time.Time {
+	return c.t
+}
+
+func (c *Clock) Advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+// LocalAWSTable returns a client for a localaws server holding one empty table with a string partition key
+func LocalAWSTable(t *testing.T, tableName string, hashKey string) *dynamodb.Client {
+	server := localaws.NewServer()
+	server.CreateTable(tableName, hashKey, "")
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return dynamodb.NewFromConfig(localaws.Config(httpServer.URL))
+}
+
+// DynamoDBLocal returns a client for the local DynamoDB, such as DynamoDB Local, at DYNAMODB_ENDPOINT. The test is
+// skipped if DYNAMODB_ENDPOINT is not set
+func DynamoDBLocal(t *testing.T) *dynamodb.Client {
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_ENDPOINT is not set")
+	}
+
+	return dynamodb.New(dynamodb.Options{
+		Region:       "eu-west-1",
+		BaseEndpoint: aws.String(endpoint),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "local", SecretAccessKey: "local"}, nil
+		}),
+	})
+}
+
+// CreateTable creates a table with a string partition key, which is deleted when the test finishes, and returns its
+// name
+func CreateTable(t *testing.T, dbClient *dynamodb.Client, prefix string, hashKey string) string {
+	tableName := fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
+	_, err := dbClient.CreateTable(context.Background(), &dynamodb.CreateTableInput{
+		TableName:   aws.String(tableName),
+		BillingMode: dynamoTypes.BillingModePayPerRequest,
+		AttributeDefinitions: []dynamoTypes.AttributeDefinition{
+			{AttributeName: aws.String(hashKey), AttributeType: dynamoTypes.ScalarAttributeTypeS},
+		},
+		KeySchema: []dynamoTypes.KeySchemaElement{
+			{AttributeName: aws.String(hashKey), KeyType: dynamoTypes.KeyTypeHash},
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = dbClient.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(tableName)})
+	})
+	return tableName
+}
@@ -0,0 +1,64 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxTransactItems is the number of items DynamoDB accepts in a TransactWriteItems call
+const maxTransactItems = 100
+
+// TransactWrite writes the items in transactions of up to 100 items and returns the indexes of the items whose
+// condition failed. As a transaction is cancelled if any condition fails, it is retried without the failed items. The
+// items must be for different table items
+func TransactWrite(ctx context.Context, dbClient *dynamodb.Client, items []dynamoTypes.TransactWriteItem) (map[int]bool, error) {
+	failed := make(map[int]bool)
+	for start := 0; start < len(items); start += maxTransactItems {
+		var indexes []int
+		for i := start; i < min(start+maxTransactItems, len(items)); i++ {
+			indexes = append(indexes, i)
+		}
+		err := transactWrite(ctx, dbClient, items, indexes, failed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return failed, nil
+}
+
+// transactWrite writes the items at indexes in one transaction, adding the indexes of items whose condition failed to
+// failed. Items cancelled because of a conflicting request are retried
+func transactWrite(ctx context.Context, dbClient *dynamodb.Client, items []dynamoTypes.TransactWriteItem, indexes []int, failed map[int]bool) error {
+	for attempt := 0; len(indexes) > 0; attempt++ {
+		if attempt >= maxBatchAttempts {
+			return fmt.Errorf("transaction of %d items cancelled after %d attempts", len(indexes), attempt)
+		}
+		backoff(attempt)
+
+		transactItems := make([]dynamoTypes.TransactWriteItem, 0, len(indexes))
+		for _, i := range indexes {
+			transactItems = append(transactItems, items[i])
+		}
+		_, err := dbClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: transactItems})
+		cancelled, ok := errors.AsType[*dynamoTypes.TransactionCanceledException](err)
+		if !ok || len(cancelled.CancellationReasons) != len(indexes) {
+			return err
+		}
+
+		var retry []int
+		for j, reason := range cancelled.CancellationReasons {
+			if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+				failed[indexes[j]] = true
+			} else {
+				retry = append(retry, indexes[j])
+			}
+		}
+		indexes = retry
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package gear
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/ockendenjo/strava"
+	"github.com/ockendenjo/strava/sports"
+)
+
+// Rules maps a sport type to the gear rule for that sport. Sports without a rule are not checked.
+type Rules map[sports.Sport]Rule
+
+// Rule describes which gear may be used for a sport. An activity for the sport must always have gear set.
+// If Allowed is not empty then the gear must be one of the allowed IDs. The gear must never be one of the Forbidden IDs.
+// Use is the gear which should be assigned to an activity which fails the rule.
+type Rule struct {
+	Allowed   []string `json:"allowed,omitempty"`
+	Forbidden []string `json:"forbidden,omitempty"`
+	Use       string   `json:"use,omitempty"`
+}
+
+// Violation describes why an activity failed a rule
+type Violation struct {
+	Sport  sports.Sport `json:"sport"`
+	GearID string       `json:"gearId"`
+	Reason string       `json:"reason"`
+	Use    string       `json:"use,omitempty"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s rule failed: %s", v.Sport, v.Reason)
+}
+
+// ParseRules loads rules from a JSON document, e.g. {"Run": {"forbidden": ["g123"]}, "Ride": {"allowed": ["b456"]}}
+func ParseRules(b []byte) (Rules, error) {
+	var rules Rules
+	err := json.Unmarshal(b, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse gear rules: %w", err)
+	}
+	err = rules.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (r Rules) Validate() error {
+	for sport, rule := range r {
+		for _, id := range rule.Allowed {
+			if id == "" {
+				return fmt.Errorf("%s rule has an empty allowed gear ID", sport)
+			}
+			if slices.Contains(rule.Forbidden, id) {
+				return fmt.Errorf("%s rule has gear %s as both allowed and forbidden", sport, id)
+			}
+		}
+		if rule.Use == "" {
+			continue
+		}
+		if slices.Contains(rule.Forbidden, rule.Use) {
+			return fmt.Errorf("%s rule uses forbidden gear %s", sport, rule.Use)
+		}
+		if len(rule.Allowed) > 0 && !slices.Contains(rule.Allowed, rule.Use) {
+			return fmt.Errorf("%s rule uses gear %s which is not allowed", sport, rule.Use)
+		}
+	}
+	return nil
+}
+
+// Check returns a Violation if the activity does not satisfy the rule for its sport, or nil if it does
+func (r Rules) Check(a *strava.Activity) *Violation {
+	sport := sports.Sport(a.SportType)
+	rule, found := r[sport]
+	if !found {
+		//Sport type is ignored
+		return nil
+	}
+
+	violation := func(reason string) *Violation {
+		return &Violation{Sport: sport, GearID: a.GearID, Reason: reason, Use: rule.Use}
+	}
+
+	if a.GearID == "" {
+		return violation("no gear set")
+	}
+	if slices.Contains(rule.Forbidden, a.GearID) {
+		return violation(fmt.Sprintf("gear %s is forbidden", a.GearID))
+	}
+	if len(rule.Allowed) > 0 && !slices.Contains(rule.Allowed, a.GearID) {
+		return violation(fmt.Sprintf("gear %s is not allowed", a.GearID))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package gear
+
+import (
+	"testing"
+
+	"github.com/ockendenjo/strava"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseRules(t *testing.T) {
+	testcases := []struct {
+		name   string
+		input  string
+		expErr bool
+	}{
+		{
+			name:  "valid rules",
+			input: `{"Run": {"allowed": ["g1"], "forbidden": ["b1"]}, "Ride": {"forbidden": ["g1"]}}`,
+		},
+		{
+			name:   "invalid JSON",
+			input:  `["g1"]`,
+			expErr: true,
+		},
+		{
+			name:   "gear both allowed and forbidden",
+			input:  `{"Run": {"allowed": ["g1"], "forbidden": ["g1"]}}`,
+			expErr: true,
+		},
+		{
+			name:   "use forbidden gear",
+			input:  `{"Run": {"forbidden": ["g1"], "use": "g1"}}`,
+			expErr: true,
+		},
+		{
+			name:   "use gear which is not allowed",
+			input:  `{"Run": {"allowed": ["g1"], "use": "g2"}}`,
+			expErr: true,
+		},
+		{
+			name:   "empty allowed gear ID",
+			input:  `{"Run": {"allowed": [""]}}`,
+			expErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseRules([]byte(tc.input))
+			if tc.expErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_Check(t *testing.T) {
+	rules, err := ParseRules([]byte(`{
+		"Run": {"forbidden": ["g_old"]},
+		"TrailRun": {"allowed": ["g_trail1", "g_trail2"]},
+		"Ride": {"allowed": ["b_road"], "forbidden": ["g_road"], "use": "b_road"}
+	}`))
+	require.NoError(t, err)
+
+	testcases := []struct {
+		name      string
+		sportType string
+		gearID    string
+		expReason string
+		expUse    string
+	}{
+		{
+			name:      "ignored sport",
+			sportType: "Swim",
+		},
+		{
+			name:      "missing gear",
+			sportType: "Run",
+			expReason: "no gear set",
+		},
+		{
+			name:      "forbidden gear",
+			sportType: "Run",
+			gearID:    "g_old",
+			expReason: "gear g_old is forbidden",
+		},
+		{
+			name:      "any other gear",
+			sportType: "Run",
+			gearID:    "g_trail1",
+		},
+		{
+			name:      "allowed gear",
+			sportType: "TrailRun",
+			gearID:    "g_trail2",
+		},
+		{
+			name:      "gear not in allowed list",
+			sportType: "TrailRun",
+			gearID:    "g_road",
+			expReason: "gear g_road is not allowed",
+		},
+		{
+			name:      "shoe on a ride",
+			sportType: "Ride",
+			gearID:    "g_road",
+			expReason: "gear g_road is forbidden",
+			expUse:    "b_road",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			violation := rules.Check(&strava.Activity{SportType: tc.sportType, GearID: tc.gearID})
+			if tc.expReason == "" {
+				assert.Nil(t, violation)
+				return
+			}
+			require.NotNil(t, violation)
+			assert.Equal(t, tc.expReason, violation.Reason)
+			assert.Equal(t, tc.sportType, string(violation.Sport))
+			assert.Equal(t, tc.expUse, violation.Use)
+		})
+	}
+}
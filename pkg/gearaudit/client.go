@@ -0,0 +1,96 @@
+package gearaudit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const pk = "ActivityID"
+const sk = "ChangedAt"
+const previousGearID = "PreviousGearID"
+const newGearID = "NewGearID"
+const reason = "Reason"
+
+// Change records a gear change made to a Strava activity so that it can be reverted
+type Change struct {
+	ActivityID     int64     `json:"activityId"`
+	ChangedAt      time.Time `json:"changedAt"`
+	PreviousGearID string    `json:"previousGearId"`
+	NewGearID      string    `json:"newGearId"`
+	Reason         string    `json:"reason"`
+}
+
+type Client interface {
+	PutChange(ctx context.Context, change Change) error
+	GetChanges(ctx context.Context, activityID int64) ([]Change, error)
+}
+
+func NewClient(dbClient *dynamodb.Client, tableName string) Client {
+	return &auditClient{dbClient: dbClient, tableName: tableName}
+}
+
+type auditClient struct {
+	dbClient  *dynamodb.Client
+	tableName string
+}
+
+func (a auditClient) PutChange(ctx context.Context, change Change) error {
+	_, err := a.dbClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(a.tableName),
+		Item: map[string]dynamoTypes.AttributeValue{
+			pk:             &dynamoTypes.AttributeValueMemberS{Value: fmt.Sprint(change.ActivityID)},
+			sk:             &dynamoTypes.AttributeValueMemberS{Value: change.ChangedAt.UTC().Format(time.RFC3339Nano)},
+			previousGearID: &dynamoTypes.AttributeValueMemberS{Value: change.PreviousGearID},
+			newGearID:      &dynamoTypes.AttributeValueMemberS{Value: change.NewGearID},
+			reason:         &dynamoTypes.AttributeValueMemberS{Value: change.Reason},
+		},
+	})
+	return err
+}
+
+// GetChanges returns the changes made to an activity, oldest first
+func (a auditClient) GetChanges(ctx context.Context, activityID int64) ([]Change, error) {
+	res, err := a.dbClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(a.tableName),
+		KeyConditionExpression: aws.String("#pk = :id"),
+		ExpressionAttributeNames: map[string]string{
+			"#pk": pk,
+		},
+		ExpressionAttributeValues: map[string]dynamoTypes.AttributeValue{
+			":id": &dynamoTypes.AttributeValueMemberS{Value: fmt.Sprint(activityID)},
+		},
+		ScanIndexForward: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0, len(res.Items))
+	for _, item := range res.Items {
+		changedAt, err := time.Parse(time.RFC3339Nano, getString(item, sk))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s for activity %d: %w", sk, activityID, err)
+		}
+		changes = append(changes, Change{
+			ActivityID:     activityID,
+			ChangedAt:      changedAt,
+			PreviousGearID: getString(item, previousGearID),
+			NewGearID:      getString(item, newGearID),
+			Reason:         getString(item, reason),
+		})
+	}
+	return changes, nil
+}
+
+func getString(item map[string]dynamoTypes.AttributeValue, key string) string {
+	v, ok := item[key].(*dynamoTypes.AttributeValueMemberS)
+	if !ok {
+		return ""
+	}
+	return v.Value
+}
@@ -0,0 +1,48 @@
+package geo
+
+import "math"
+
+// metresPerDegree is the approximate length of one degree of latitude
+const metresPerDegree = earthRadius * math.Pi / 180
+
+// BoundingBox is a latitude and longitude aligned box. It does not support boxes crossing the antimeridian
+type BoundingBox struct {
+	Min Point `json:"min"`
+	Max Point `json:"max"`
+}
+
+// NewBoundingBox returns the smallest box containing all the points. It returns false if there are no points
+func NewBoundingBox(points []Point) (BoundingBox, bool) {
+	if len(points) < 1 {
+		return BoundingBox{}, false
+	}
+
+	box := BoundingBox{Min: points[0], Max: points[0]}
+	for _, p := range points[1:] {
+		box.Min.Lat = math.Min(box.Min.Lat, p.Lat)
+		box.Min.Lon = math.Min(box.Min.Lon, p.Lon)
+		box.Max.Lat = math.Max(box.Max.Lat, p.Lat)
+		box.Max.Lon = math.Max(box.Max.Lon, p.Lon)
+	}
+	return box, true
+}
+
+// Expand returns a box which also contains every point within the given distance in metres of this box
+func (b BoundingBox) Expand(metres float64) BoundingBox {
+	dLat := metres / metresPerDegree
+	maxAbsLat := math.Min(math.Max(math.Abs(b.Min.Lat), math.Abs(b.Max.Lat))+dLat, 89)
+	dLon := metres / (metresPerDegree * math.Cos(toRadians(maxAbsLat)))
+
+	return BoundingBox{
+		Min: Point{Lat: b.Min.Lat - dLat, Lon: b.Min.Lon - dLon},
+		Max: Point{Lat: b.Max.Lat + dLat, Lon: b.Max.Lon + dLon},
+	}
+}
+
+func (b BoundingBox) Contains(p Point) bool {
+	return p.Lat >= b.Min.Lat && p.Lat <= b.Max.Lat && p.Lon >= b.Min.Lon && p.Lon <= b.Max.Lon
+}
+
+func (b BoundingBox) Intersects(o BoundingBox) bool {
+	return b.Min.Lat <= o.Max.Lat && o.Min.Lat <= b.Max.Lat && b.Min.Lon <= o.Max.Lon && o.Min.Lon <= b.Max.Lon
+}
@@ -0,0 +1,68 @@
+// Package geo provides geodesy functions for routes and summits
+package geo
+
+import "math"
+
+// earthRadius is the mean radius of the Earth in metres
+const earthRadius = 6371008.8
+
+// Point is a WGS84 latitude and longitude in degrees
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Distance returns the great-circle distance in metres between two points using the haversine formula
+func Distance(a Point, b Point) float64 {
+	lat1 := toRadians(a.Lat)
+	lat2 := toRadians(b.Lat)
+	dLat := lat2 - lat1
+	dLon := toRadians(b.Lon - a.Lon)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// DistanceToSegment returns the distance in metres from p to the closest point on the segment from a to b.
+// The points are projected onto a plane centred on p, which is accurate for segments up to a few kilometres long.
+func DistanceToSegment(p Point, a Point, b Point) float64 {
+	ax, ay := project(p, a)
+	bx, by := project(p, b)
+
+	dx, dy := bx-ax, by-ay
+	lengthSq := dx*dx + dy*dy
+	if lengthSq == 0 {
+		return Distance(p, a)
+	}
+
+	//Parameter of the closest point on the segment, where p is at the origin
+	t := math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lengthSq))
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+// DistanceToRoute returns the distance in metres from p to the closest point on the route
+func DistanceToRoute(p Point, route []Point) float64 {
+	switch len(route) {
+	case 0:
+		return math.Inf(1)
+	case 1:
+		return Distance(p, route[0])
+	}
+
+	minDistance := math.Inf(1)
+	for i := 1; i < len(route); i++ {
+		minDistance = math.Min(minDistance, DistanceToSegment(p, route[i-1], route[i]))
+	}
+	return minDistance
+}
+
+// project returns the equirectangular x and y offset in metres of q from origin
+func project(origin Point, q Point) (float64, float64) {
+	x := toRadians(q.Lon-origin.Lon) * math.Cos(toRadians(origin.Lat)) * earthRadius
+	y := toRadians(q.Lat-origin.Lat) * earthRadius
+	return x, y
+}
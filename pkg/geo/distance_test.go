@@ -0,0 +1,106 @@
+package geo
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// metresPerDegreeAtEquator is one degree of arc on the sphere used for distances
+const metresPerDegreeAtEquator = 111_195.08
+
+func Test_Distance(t *testing.T) {
+	testcases := []struct {
+		name  string
+		a     Point
+		b     Point
+		exp   float64
+		delta float64
+	}{
+		{
+			name: "same point",
+			a:    Point{Lat: 55.94411, Lon: -3.16184},
+			b:    Point{Lat: 55.94411, Lon: -3.16184},
+			exp:  0,
+		},
+		{
+			name:  "one degree along the equator",
+			a:     Point{Lat: 0, Lon: 0},
+			b:     Point{Lat: 0, Lon: 1},
+			exp:   metresPerDegreeAtEquator,
+			delta: 0.1,
+		},
+		{
+			name:  "Ben Nevis to Ben Lomond",
+			a:     Point{Lat: 56.79685, Lon: -5.0036},
+			b:     Point{Lat: 56.19018, Lon: -4.63281},
+			exp:   71_400,
+			delta: 500,
+		},
+		{
+			name:  "antipodes",
+			a:     Point{Lat: 0, Lon: 0},
+			b:     Point{Lat: 0, Lon: 180},
+			exp:   math.Pi * earthRadius,
+			delta: 0.1,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.exp, Distance(tc.a, tc.b), tc.delta)
+			assert.InDelta(t, tc.exp, Distance(tc.b, tc.a), tc.delta)
+		})
+	}
+}
+
+func Test_DistanceToSegment(t *testing.T) {
+	a := Point{Lat: 0, Lon: 0}
+	b := Point{Lat: 0, Lon: 0.01}
+
+	testcases := []struct {
+		name string
+		p    Point
+		exp  float64
+	}{
+		{
+			name: "on the segment",
+			p:    Point{Lat: 0, Lon: 0.005},
+			exp:  0,
+		},
+		{
+			name: "beside the middle of the segment",
+			p:    Point{Lat: 0.001, Lon: 0.005},
+			exp:  0.001 * metresPerDegreeAtEquator,
+		},
+		{
+			name: "beyond the end of the segment",
+			p:    Point{Lat: 0, Lon: 0.011},
+			exp:  0.001 * metresPerDegreeAtEquator,
+		},
+		{
+			name: "before the start of the segment",
+			p:    Point{Lat: 0.001, Lon: -0.001},
+			exp:  math.Sqrt2 * 0.001 * metresPerDegreeAtEquator,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.exp, DistanceToSegment(tc.p, a, b), 0.1)
+		})
+	}
+
+	t.Run("zero length segment", func(t *testing.T) {
+		p := Point{Lat: 0.001, Lon: 0}
+		assert.InDelta(t, Distance(p, a), DistanceToSegment(p, a, a), 1e-9)
+	})
+}
+
+func Test_DistanceToRoute(t *testing.T) {
+	route := []Point{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 0.01}, {Lat: 0.01, Lon: 0.01}}
+	p := Point{Lat: 0.005, Lon: 0.011}
+
+	assert.InDelta(t, 0.001*metresPerDegreeAtEquator, DistanceToRoute(p, route), 0.1)
+	assert.InDelta(t, Distance(p, route[0]), DistanceToRoute(p, route[:1]), 1e-9)
+	assert.True(t, math.IsInf(DistanceToRoute(p, nil), 1))
+}
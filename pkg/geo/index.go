@@ -0,0 +1,91 @@
+package geo
+
+import (
+	"math"
+	"slices"
+)
+
+// DefaultCellSize is the index grid cell size in degrees, roughly 1km of latitude
+const DefaultCellSize = 0.01
+
+// Index is a grid index of points for finding the points near a route
+type Index struct {
+	points   []Point
+	cellSize float64
+	cells    map[cell][]int
+}
+
+type cell struct {
+	lat int
+	lon int
+}
+
+// NewIndex indexes the points. Results from the index are positions in this slice
+func NewIndex(points []Point, cellSize float64) *Index {
+	idx := &Index{
+		points:   points,
+		cellSize: cellSize,
+		cells:    make(map[cell][]int),
+	}
+	for i, p := range points {
+		c := idx.cellOf(p)
+		idx.cells[c] = append(idx.cells[c], i)
+	}
+	return idx
+}
+
+func (idx *Index) cellOf(p Point) cell {
+	return cell{
+		lat: int(math.Floor(p.Lat / idx.cellSize)),
+		lon: int(math.Floor(p.Lon / idx.cellSize)),
+	}
+}
+
+// WithinBox returns the positions of the indexed points inside the box
+func (idx *Index) WithinBox(box BoundingBox) []int {
+	var found []int
+	idx.visitBox(box, func(i int) {
+		if box.Contains(idx.points[i]) {
+			found = append(found, i)
+		}
+	})
+	slices.Sort(found)
+	return found
+}
+
+// WithinRoute returns the positions of the indexed points within the given distance in metres of any segment of the route, in ascending order
+func (idx *Index) WithinRoute(route []Point, metres float64) []int {
+	if len(route) == 1 {
+		route = []Point{route[0], route[0]}
+	}
+
+	seen := make(map[int]bool)
+	var found []int
+	for i := 1; i < len(route); i++ {
+		a, b := route[i-1], route[i]
+		box, _ := NewBoundingBox([]Point{a, b})
+		idx.visitBox(box.Expand(metres), func(j int) {
+			if seen[j] {
+				return
+			}
+			if DistanceToSegment(idx.points[j], a, b) <= metres {
+				seen[j] = true
+				found = append(found, j)
+			}
+		})
+	}
+	slices.Sort(found)
+	return found
+}
+
+func (idx *Index) visitBox(box BoundingBox, visit func(i int)) {
+	minCell := idx.cellOf(box.Min)
+	maxCell := idx.cellOf(box.Max)
+	for lat := minCell.lat; lat <= maxCell.lat; lat++ {
+		for lon := minCell.lon; lon <= maxCell.lon; lon++ {
+			for _, i := range idx.cells[cell{lat: lat, lon: lon}] {
+				visit(i)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BoundingBox(t *testing.T) {
+	box, ok := NewBoundingBox([]Point{{Lat: 55.95, Lon: -3.2}, {Lat: 55.94, Lon: -3.16}, {Lat: 55.96, Lon: -3.18}})
+	assert.True(t, ok)
+	assert.Equal(t, BoundingBox{Min: Point{Lat: 55.94, Lon: -3.2}, Max: Point{Lat: 55.96, Lon: -3.16}}, box)
+
+	_, ok = NewBoundingBox(nil)
+	assert.False(t, ok)
+
+	testcases := []struct {
+		name     string
+		p        Point
+		expInBox bool
+		expInExp bool
+	}{
+		{
+			name:     "inside",
+			p:        Point{Lat: 55.95, Lon: -3.18},
+			expInBox: true,
+			expInExp: true,
+		},
+		{
+			name:     "50m north",
+			p:        Point{Lat: 55.96045, Lon: -3.18},
+			expInExp: true,
+		},
+		{
+			name:     "50m west",
+			p:        Point{Lat: 55.95, Lon: -3.2008},
+			expInExp: true,
+		},
+		{
+			name: "200m south",
+			p:    Point{Lat: 55.9382, Lon: -3.18},
+		},
+	}
+	expanded := box.Expand(100)
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expInBox, box.Contains(tc.p))
+			assert.Equal(t, tc.expInExp, expanded.Contains(tc.p))
+		})
+	}
+
+	assert.True(t, box.Intersects(expanded))
+	assert.False(t, box.Intersects(BoundingBox{Min: Point{Lat: 56, Lon: -3.2}, Max: Point{Lat: 56.1, Lon: -3.1}}))
+}
+
+func Test_Index(t *testing.T) {
+	summits := []Point{
+		{Lat: 55.94411, Lon: -3.16184}, //Arthur's Seat
+		{Lat: 55.95186, Lon: -3.18190}, //Calton Hill
+		{Lat: 55.90400, Lon: -3.21400}, //Blackford Hill
+		{Lat: 56.79685, Lon: -5.00360}, //Ben Nevis
+	}
+	idx := NewIndex(summits, DefaultCellSize)
+
+	testcases := []struct {
+		name   string
+		route  []Point
+		metres float64
+		exp    []int
+	}{
+		{
+			name:   "no route",
+			route:  nil,
+			metres: 50,
+		},
+		{
+			name:   "single point at summit",
+			route:  []Point{{Lat: 56.79686, Lon: -5.00361}},
+			metres: 50,
+			exp:    []int{3},
+		},
+		{
+			name:   "segment passes between sparse points near summits",
+			route:  []Point{{Lat: 55.9400, Lon: -3.1550}, {Lat: 55.9480, Lon: -3.1690}, {Lat: 55.9560, Lon: -3.1950}},
+			metres: 60,
+			exp:    []int{0, 1},
+		},
+		{
+			name:   "route far from summits",
+			route:  []Point{{Lat: 55.9200, Lon: -3.3000}, {Lat: 55.9250, Lon: -3.3100}},
+			metres: 60,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			found := idx.WithinRoute(tc.route, tc.metres)
+			assert.Equal(t, tc.exp, found)
+			for _, i := range found {
+				assert.LessOrEqual(t, DistanceToRoute(summits[i], tc.route), tc.metres)
+			}
+		})
+	}
+
+	box, _ := NewBoundingBox([]Point{{Lat: 55.94, Lon: -3.19}, {Lat: 55.96, Lon: -3.16}})
+	assert.Equal(t, []int{0, 1}, idx.WithinBox(box))
+}
@@ -0,0 +1,81 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// polylineFactor scales coordinates to the 5 decimal places used by Google encoded polylines
+const polylineFactor = 1e5
+
+var ErrInvalidPolyline = errors.New("invalid encoded polyline")
+
+// DecodePolyline decodes a Google encoded polyline such as the summary_polyline of a Strava activity map
+func DecodePolyline(s string) ([]Point, error) {
+	points := make([]Point, 0, len(s)/4)
+	var lat, lon int64
+	for i := 0; i < len(s); {
+		dLat, n, err := decodeValue(s[i:])
+		if err != nil {
+			return nil, err
+		}
+		i += n
+		dLon, n, err := decodeValue(s[i:])
+		if err != nil {
+			return nil, err
+		}
+		i += n
+
+		lat += dLat
+		lon += dLon
+		points = append(points, Point{Lat: float64(lat) / polylineFactor, Lon: float64(lon) / polylineFactor})
+	}
+	return points, nil
+}
+
+func decodeValue(s string) (int64, int, error) {
+	var result int64
+	var shift uint
+	for i := 0; i < len(s); i++ {
+		b := int64(s[i]) - 63
+		if b < 0 || b > 0x3f || shift > 60 {
+			return 0, 0, ErrInvalidPolyline
+		}
+		result |= (b & 0x1f) << shift
+		shift += 5
+		if b < 0x20 {
+			if result&1 != 0 {
+				return ^(result >> 1), i + 1, nil
+			}
+			return result >> 1, i + 1, nil
+		}
+	}
+	return 0, 0, ErrInvalidPolyline
+}
+
+// EncodePolyline encodes points as a Google encoded polyline
+func EncodePolyline(points []Point) string {
+	var sb strings.Builder
+	var prevLat, prevLon int64
+	for _, p := range points {
+		lat := int64(math.Round(p.Lat * polylineFactor))
+		lon := int64(math.Round(p.Lon * polylineFactor))
+		encodeValue(&sb, lat-prevLat)
+		encodeValue(&sb, lon-prevLon)
+		prevLat, prevLon = lat, lon
+	}
+	return sb.String()
+}
+
+func encodeValue(sb *strings.Builder, v int64) {
+	u := v << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		sb.WriteByte(byte((0x20 | (u & 0x1f)) + 63))
+		u >>= 5
+	}
+	sb.WriteByte(byte(u + 63))
+}
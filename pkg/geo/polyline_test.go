@@ -0,0 +1,91 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DecodePolyline(t *testing.T) {
+	testcases := []struct {
+		name      string
+		polyline  string
+		expPoints []Point
+		expErr    bool
+	}{
+		{
+			name:      "empty polyline",
+			polyline:  "",
+			expPoints: []Point{},
+		},
+		{
+			name:      "Google example",
+			polyline:  "_p~iF~ps|U_ulLnnqC_mqNvxq`@",
+			expPoints: []Point{{Lat: 38.5, Lon: -120.2}, {Lat: 40.7, Lon: -120.95}, {Lat: 43.252, Lon: -126.453}},
+		},
+		{
+			name:     "truncated polyline",
+			polyline: "_p~iF~ps|U_ulLnnqC_mqNvxq",
+			expErr:   true,
+		},
+		{
+			name:     "invalid characters",
+			polyline: "_p~iF ps|U",
+			expErr:   true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			points, err := DecodePolyline(tc.polyline)
+			if tc.expErr {
+				assert.ErrorIs(t, err, ErrInvalidPolyline)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, points, len(tc.expPoints))
+			for i, exp := range tc.expPoints {
+				assert.InDelta(t, exp.Lat, points[i].Lat, 1e-9)
+				assert.InDelta(t, exp.Lon, points[i].Lon, 1e-9)
+			}
+		})
+	}
+}
+
+func Test_EncodePolyline(t *testing.T) {
+	testcases := []struct {
+		name   string
+		points []Point
+		exp    string
+	}{
+		{
+			name:   "no points",
+			points: nil,
+			exp:    "",
+		},
+		{
+			name:   "Google example",
+			points: []Point{{Lat: 38.5, Lon: -120.2}, {Lat: 40.7, Lon: -120.95}, {Lat: 43.252, Lon: -126.453}},
+			exp:    "_p~iF~ps|U_ulLnnqC_mqNvxq`@",
+		},
+		{
+			name:   "Edinburgh route",
+			points: []Point{{Lat: 55.94411, Lon: -3.16184}, {Lat: 55.94862, Lon: -3.19997}, {Lat: 55.95, Lon: -3.2}},
+			exp:    "uqmtInphRe[hmFsGD",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded := EncodePolyline(tc.points)
+			assert.Equal(t, tc.exp, encoded)
+
+			decoded, err := DecodePolyline(encoded)
+			require.NoError(t, err)
+			require.Len(t, decoded, len(tc.points))
+			for i, exp := range tc.points {
+				assert.InDelta(t, exp.Lat, decoded[i].Lat, 1e-9)
+				assert.InDelta(t, exp.Lon, decoded[i].Lon, 1e-9)
+			}
+		})
+	}
+}
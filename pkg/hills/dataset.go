@@ -0,0 +1,83 @@
+// Package hills provides the summit catalogue used for hill bagging
+package hills
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/ockendenjo/strava-shoes/pkg/geo"
+)
+
+//go:embed hills.json
+var bundled []byte
+
+// Hill is a summit which can be bagged
+type Hill struct {
+	ID              int      `json:"id"`
+	Name            string   `json:"name"`
+	GridRef         string   `json:"gridRef,omitempty"`
+	Lat             float64  `json:"lat"`
+	Lon             float64  `json:"lon"`
+	Height          float64  `json:"height"`
+	Classifications []string `json:"classes,omitempty"`
+}
+
+func (h Hill) Point() geo.Point {
+	return geo.Point{Lat: h.Lat, Lon: h.Lon}
+}
+
+// Dataset is a versioned list of hills. The version is recorded against each bagging check
+type Dataset struct {
+	Version string `json:"version"`
+	Hills   []Hill `json:"hills"`
+}
+
+// Bundled returns the dataset embedded in the binary
+func Bundled() (*Dataset, error) {
+	return Parse(bundled)
+}
+
+// Load returns the dataset from S3 if a key is set, otherwise the dataset embedded in the binary
+func Load(ctx context.Context, s3Client *s3.Client, bucket string, key string) (*Dataset, error) {
+	if key == "" {
+		return Bundled()
+	}
+	return LoadS3(ctx, s3Client, bucket, key)
+}
+
+// LoadS3 returns a dataset written by scripts/import-hills and uploaded to S3
+func LoadS3(ctx context.Context, s3Client *s3.Client, bucket string, key string) (*Dataset, error) {
+	res, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+func Parse(b []byte) (*Dataset, error) {
+	var dataset Dataset
+	err := json.Unmarshal(b, &dataset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hill dataset: %w", err)
+	}
+	if dataset.Version == "" {
+		return nil, fmt.Errorf("invalid hill dataset: no version")
+	}
+	return &dataset, nil
+}
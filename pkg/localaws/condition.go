@@ -0,0 +1,178 @@
+package localaws
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var conditionTokenPattern = regexp.MustCompile(`\(|\)|<>|<=|>=|=|<|>|[#:]?\w+|\S`)
+
+// checkCondition supports attribute_exists and attribute_not_exists functions, comparisons of an attribute with a
+// string or number value, and AND, OR, NOT and parentheses, which covers the conditional writes used to claim keys
+func checkCondition(expression string, names map[string]string, values item, existing item) error {
+	ok, err := evalCondition(expression, names, values, existing)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &apiError{Type: "com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException", Message: "The conditional request failed"}
+	}
+	return nil
+}
+
+// evalCondition returns whether an item matches a condition or filter expression. An empty expression matches every
+// item
+func evalCondition(expression string, names map[string]string, values item, existing item) (bool, error) {
+	if expression == "" {
+		return true, nil
+	}
+	p := &conditionParser{tokens: conditionTokenPattern.FindAllString(expression, -1), names: names, values: values, existing: existing}
+	ok, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	if err != nil {
+		return false, &apiError{Type: "ValidationException", Message: fmt.Sprintf("unsupported expression: %s: %s", expression, err)}
+	}
+	return ok, nil
+}
+
+type conditionParser struct {
+	tokens   []string
+	pos      int
+	names    map[string]string
+	values   item
+	existing item
+}
+
+func (p *conditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *conditionParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *conditionParser) expect(token string) error {
+	if got := p.next(); got != token {
+		return fmt.Errorf("expected %s but found %q", token, got)
+	}
+	return nil
+}
+
+func (p *conditionParser) parseOr() (bool, error) {
+	result, err := p.parseAnd()
+	for err == nil && strings.EqualFold(p.peek(), "OR") {
+		p.pos++
+		var right bool
+		right, err = p.parseAnd()
+		result = result || right
+	}
+	return result, err
+}
+
+func (p *conditionParser) parseAnd() (bool, error) {
+	result, err := p.parseUnary()
+	for err == nil && strings.EqualFold(p.peek(), "AND") {
+		p.pos++
+		var right bool
+		right, err = p.parseUnary()
+		result = result && right
+	}
+	return result, err
+}
+
+func (p *conditionParser) parseUnary() (bool, error) {
+	token := p.next()
+	switch {
+	case strings.EqualFold(token, "NOT"):
+		result, err := p.parseUnary()
+		return !result, err
+	case token == "(":
+		result, err := p.parseOr()
+		if err != nil {
+			return false, err
+		}
+		return result, p.expect(")")
+	case token == "attribute_exists" || token == "attribute_not_exists":
+		if err := p.expect("("); err != nil {
+			return false, err
+		}
+		_, exists := p.operand(p.next())
+		return exists == (token == "attribute_exists"), p.expect(")")
+	}
+
+	left, leftFound := p.operand(token)
+	operator := p.next()
+	right, rightFound := p.operand(p.next())
+	if !leftFound || !rightFound {
+		//A comparison with a missing attribute is false
+		return false, nil
+	}
+	return compare(left, operator, right)
+}
+
+// operand returns the value of an attribute name, name placeholder or value placeholder
+func (p *conditionParser) operand(token string) (json.RawMessage, bool) {
+	if strings.HasPrefix(token, ":") {
+		v, found := p.values[token]
+		return v, found
+	}
+	if strings.HasPrefix(token, "#") {
+		token = p.names[token]
+	}
+	v, found := p.existing[token]
+	return v, found
+}
+
+// compare compares two S or N values. Values of different types are never equal
+func compare(left json.RawMessage, operator string, right json.RawMessage) (bool, error) {
+	var l, r map[string]string
+	if json.Unmarshal(left, &l) != nil || json.Unmarshal(right, &r) != nil {
+		return false, fmt.Errorf("only S and N values can be compared")
+	}
+	cmp, sameType := 0, false
+	if ls, ok := l["S"]; ok {
+		rs, found := r["S"]
+		sameType = found
+		cmp = strings.Compare(ls, rs)
+	} else if ln, ok := l["N"]; ok {
+		rn, found := r["N"]
+		sameType = found
+		lf, lErr := strconv.ParseFloat(ln, 64)
+		rf, rErr := strconv.ParseFloat(rn, 64)
+		if found && (lErr != nil || rErr != nil) {
+			return false, fmt.Errorf("invalid number")
+		}
+		switch {
+		case lf < rf:
+			cmp = -1
+		case lf > rf:
+			cmp = 1
+		}
+	}
+
+	switch operator {
+	case "=":
+		return sameType && cmp == 0, nil
+	case "<>":
+		return !sameType || cmp != 0, nil
+	case "<":
+		return sameType && cmp < 0, nil
+	case "<=":
+		return sameType && cmp <= 0, nil
+	case ">":
+		return sameType && cmp > 0, nil
+	case ">=":
+		return sameType && cmp >= 0, nil
+	}
+	return false, fmt.Errorf("unsupported operator %q", operator)
+}
@@ -0,0 +1,440 @@
+package localaws
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// item is a DynamoDB item in the JSON form sent by the SDK, e.g. {"ID": {"S": "123"}}
+type item map[string]json.RawMessage
+
+type table struct {
+	hashKey  string
+	rangeKey string
+	items    map[string]item
+}
+
+// CreateTable adds an empty table. rangeKey is empty for tables with only a partition key
+func (s *Server) CreateTable(name string, hashKey string, rangeKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tables[name] = &table{hashKey: hashKey, rangeKey: rangeKey, items: make(map[string]item)}
+}
+
+// ItemCount returns the number of items in a table
+func (s *Server) ItemCount(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, found := s.tables[name]; found {
+		return len(t.items)
+	}
+	return 0
+}
+
+func (s *Server) dynamoDBOperation(name string) operation {
+	switch name {
+	case "GetItem":
+		return s.dbGetItem
+	case "PutItem":
+		return s.dbPutItem
+	case "UpdateItem":
+		return s.dbUpdateItem
+	case "DeleteItem":
+		return s.dbDeleteItem
+	case "Scan":
+		return s.dbScan
+	case "Query":
+		return s.dbQuery
+	case "BatchGetItem":
+		return s.dbBatchGetItem
+	case "BatchWriteItem":
+		return s.dbBatchWriteItem
+	case "TransactWriteItems":
+		return s.dbTransactWriteItems
+	}
+	return nil
+}
+
+type itemInput struct {
+	TableName                 string
+	Key                       item
+	Item                      item
+	ConditionExpression       string
+	FilterExpression          string
+	KeyConditionExpression    string
+	UpdateExpression          string
+	ReturnValues              string
+	ExpressionAttributeNames  map[string]string
+	ExpressionAttributeValues item
+}
+
+func (s *Server) dbGetItem(body []byte) (any, error) {
+	input, t, err := s.decodeItemInput(body)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.key(input.Key)
+	if err != nil {
+		return nil, err
+	}
+	if existing, found := t.items[key]; found {
+		return map[string]any{"Item": existing}, nil
+	}
+	return map[string]any{}, nil
+}
+
+func (s *Server) dbPutItem(body []byte) (any, error) {
+	input, t, err := s.decodeItemInput(body)
+	if err != nil {
+		return nil, err
+	}
+	return t.putItem(input)
+}
+
+func (t *table) putItem(input *itemInput) (any, error) {
+	key, err := t.key(input.Item)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCondition(input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, t.items[key])
+	if err != nil {
+		return nil, err
+	}
+	t.items[key] = input.Item
+	return map[string]any{}, nil
+}
+
+// dbUpdateItem supports SET actions which assign values and REMOVE actions. ReturnValues may be ALL_OLD
+func (s *Server) dbUpdateItem(body []byte) (any, error) {
+	input, t, err := s.decodeItemInput(body)
+	if err != nil {
+		return nil, err
+	}
+	return t.updateItem(input)
+}
+
+func (t *table) updateItem(input *itemInput) (any, error) {
+	key, err := t.key(input.Key)
+	if err != nil {
+		return nil, err
+	}
+	existing := t.items[key]
+	err = checkCondition(input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := maps.Clone(existing)
+	if updated == nil {
+		updated = maps.Clone(input.Key)
+	}
+	err = applyUpdate(updated, input.UpdateExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	t.items[key] = updated
+
+	if input.ReturnValues == "ALL_OLD" && existing != nil {
+		return map[string]any{"Attributes": existing}, nil
+	}
+	return map[string]any{}, nil
+}
+
+func (s *Server) dbDeleteItem(body []byte) (any, error) {
+	input, t, err := s.decodeItemInput(body)
+	if err != nil {
+		return nil, err
+	}
+	return t.deleteItem(input)
+}
+
+func (t *table) deleteItem(input *itemInput) (any, error) {
+	key, err := t.key(input.Key)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCondition(input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, t.items[key])
+	if err != nil {
+		return nil, err
+	}
+	delete(t.items, key)
+	return map[string]any{}, nil
+}
+
+// dbScan returns every item which matches the filter expression in one page. Projection expressions are not supported
+func (s *Server) dbScan(body []byte) (any, error) {
+	input, t, err := s.decodeItemInput(body)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []item{}
+	for _, key := range slices.Sorted(maps.Keys(t.items)) {
+		match, err := evalCondition(input.FilterExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, t.items[key])
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			items = append(items, t.items[key])
+		}
+	}
+	return map[string]any{"Items": items, "Count": len(items), "ScannedCount": len(t.items)}, nil
+}
+
+var keyConditionPattern = regexp.MustCompile(`^\s*(#?\w+)\s*=\s*(:\w+)\s*$`)
+
+// dbQuery returns every item with a partition key in one page. The key condition must be an equality on the partition
+// key, and filter and projection expressions are not supported
+func (s *Server) dbQuery(body []byte) (any, error) {
+	input, t, err := s.decodeItemInput(body)
+	if err != nil {
+		return nil, err
+	}
+	match := keyConditionPattern.FindStringSubmatch(input.KeyConditionExpression)
+	if match == nil || input.FilterExpression != "" {
+		return nil, &apiError{Type: "ValidationException", Message: fmt.Sprintf("unsupported key condition expression: %s", input.KeyConditionExpression)}
+	}
+	name := match[1]
+	if strings.HasPrefix(name, "#") {
+		name = input.ExpressionAttributeNames[name]
+	}
+	value, found := input.ExpressionAttributeValues[match[2]]
+	if name != t.hashKey || !found {
+		return nil, &apiError{Type: "ValidationException", Message: fmt.Sprintf("unsupported key condition expression: %s", input.KeyConditionExpression)}
+	}
+
+	items := []item{}
+	for _, key := range slices.Sorted(maps.Keys(t.items)) {
+		if string(t.items[key][name]) == string(value) {
+			items = append(items, t.items[key])
+		}
+	}
+	return map[string]any{"Items": items, "Count": len(items), "ScannedCount": len(items)}, nil
+}
+
+type batchGetInput struct {
+	RequestItems map[string]struct{ Keys []item }
+}
+
+// dbBatchGetItem returns every item which exists, so no keys are returned as unprocessed. Projection expressions are
+// not supported
+func (s *Server) dbBatchGetItem(body []byte) (any, error) {
+	input, err := decode[batchGetInput](body)
+	if err != nil {
+		return nil, err
+	}
+	responses := make(map[string][]item)
+	for name, request := range input.RequestItems {
+		t, found := s.tables[name]
+		if !found {
+			return nil, &apiError{Type: "ResourceNotFoundException", Message: fmt.Sprintf("table %s not found", name)}
+		}
+		responses[name] = []item{}
+		for _, k := range request.Keys {
+			key, err := t.key(k)
+			if err != nil {
+				return nil, err
+			}
+			if existing, found := t.items[key]; found {
+				responses[name] = append(responses[name], existing)
+			}
+		}
+	}
+	return map[string]any{"Responses": responses, "UnprocessedKeys": map[string]any{}}, nil
+}
+
+type batchWriteInput struct {
+	RequestItems map[string][]struct {
+		PutRequest    *struct{ Item item }
+		DeleteRequest *struct{ Key item }
+	}
+}
+
+// dbBatchWriteItem applies every put and delete request, so no items are returned as unprocessed
+func (s *Server) dbBatchWriteItem(body []byte) (any, error) {
+	input, err := decode[batchWriteInput](body)
+	if err != nil {
+		return nil, err
+	}
+	for name, requests := range input.RequestItems {
+		t, found := s.tables[name]
+		if !found {
+			return nil, &apiError{Type: "ResourceNotFoundException", Message: fmt.Sprintf("table %s not found", name)}
+		}
+		for _, request := range requests {
+			switch {
+			case request.PutRequest != nil:
+				key, err := t.key(request.PutRequest.Item)
+				if err != nil {
+					return nil, err
+				}
+				t.items[key] = request.PutRequest.Item
+			case request.DeleteRequest != nil:
+				key, err := t.key(request.DeleteRequest.Key)
+				if err != nil {
+					return nil, err
+				}
+				delete(t.items, key)
+			}
+		}
+	}
+	return map[string]any{"UnprocessedItems": map[string]any{}}, nil
+}
+
+type transactWriteInput struct {
+	TransactItems []struct {
+		ConditionCheck *itemInput
+		Put            *itemInput
+		Update         *itemInput
+		Delete         *itemInput
+	}
+}
+
+// dbTransactWriteItems checks the condition of every item before writing any. If a condition fails the transaction is
+// cancelled, with a reason for each item
+func (s *Server) dbTransactWriteItems(body []byte) (any, error) {
+	input, err := decode[transactWriteInput](body)
+	if err != nil {
+		return nil, err
+	}
+
+	//apply is nil for a condition check
+	type write struct {
+		t     *table
+		input *itemInput
+		key   item
+		apply func(t *table, input *itemInput) (any, error)
+	}
+	writes := make([]write, 0, len(input.TransactItems))
+	keys := make(map[string]bool)
+	reasons := make([]cancellationReason, 0, len(input.TransactItems))
+	cancelled := false
+	for _, transactItem := range input.TransactItems {
+		var w write
+		switch {
+		case transactItem.ConditionCheck != nil:
+			w = write{input: transactItem.ConditionCheck, key: transactItem.ConditionCheck.Key}
+		case transactItem.Put != nil:
+			w = write{input: transactItem.Put, key: transactItem.Put.Item, apply: (*table).putItem}
+		case transactItem.Update != nil:
+			w = write{input: transactItem.Update, key: transactItem.Update.Key, apply: (*table).updateItem}
+		case transactItem.Delete != nil:
+			w = write{input: transactItem.Delete, key: transactItem.Delete.Key, apply: (*table).deleteItem}
+		default:
+			return nil, &apiError{Type: "ValidationException", Message: "transaction item has no action"}
+		}
+		t, found := s.tables[w.input.TableName]
+		if !found {
+			return nil, &apiError{Type: "ResourceNotFoundException", Message: fmt.Sprintf("table %s not found", w.input.TableName)}
+		}
+		w.t = t
+		key, err := t.key(w.key)
+		if err != nil {
+			return nil, err
+		}
+		if keys[w.input.TableName+"/"+key] {
+			return nil, &apiError{Type: "ValidationException", Message: "Transaction request cannot include multiple operations on one item"}
+		}
+		keys[w.input.TableName+"/"+key] = true
+
+		ok, err := evalCondition(w.input.ConditionExpression, w.input.ExpressionAttributeNames, w.input.ExpressionAttributeValues, t.items[key])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			reasons = append(reasons, cancellationReason{Code: "None"})
+		} else {
+			cancelled = true
+			reasons = append(reasons, cancellationReason{Code: "ConditionalCheckFailed", Message: "The conditional request failed"})
+		}
+		writes = append(writes, w)
+	}
+	if cancelled {
+		return nil, &apiError{
+			Type:                "com.amazonaws.dynamodb.v20120810#TransactionCanceledException",
+			Message:             "Transaction cancelled, please refer cancellation reasons for specific reasons",
+			CancellationReasons: reasons,
+		}
+	}
+
+	for _, w := range writes {
+		if w.apply == nil {
+			continue
+		}
+		_, err = w.apply(w.t, w.input)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return map[string]any{}, nil
+}
+
+func (s *Server) decodeItemInput(body []byte) (*itemInput, *table, error) {
+	input, err := decode[itemInput](body)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, found := s.tables[input.TableName]
+	if !found {
+		return nil, nil, &apiError{Type: "ResourceNotFoundException", Message: fmt.Sprintf("table %s not found", input.TableName)}
+	}
+	return input, t, nil
+}
+
+// key returns a string which identifies the item from its key attributes
+func (t *table) key(it item) (string, error) {
+	var parts []string
+	for _, name := range []string{t.hashKey, t.rangeKey} {
+		if name == "" {
+			continue
+		}
+		v, found := it[name]
+		if !found {
+			return "", &apiError{Type: "ValidationException", Message: fmt.Sprintf("missing key attribute %s", name)}
+		}
+		parts = append(parts, string(v))
+	}
+	return strings.Join(parts, "|"), nil
+}
+
+var updateClausePattern = regexp.MustCompile(`(?i)\b(SET|REMOVE)\b`)
+
+// applyUpdate applies an update expression such as "SET #a = :a, #b = :b REMOVE #c"
+func applyUpdate(it item, expression string, names map[string]string, values item) error {
+	attributeName := func(name string) string {
+		if strings.HasPrefix(name, "#") {
+			return names[name]
+		}
+		return name
+	}
+
+	clauses := updateClausePattern.FindAllStringSubmatchIndex(expression, -1)
+	if len(clauses) == 0 {
+		return &apiError{Type: "ValidationException", Message: fmt.Sprintf("unsupported update expression: %s", expression)}
+	}
+	for i, clause := range clauses {
+		end := len(expression)
+		if i+1 < len(clauses) {
+			end = clauses[i+1][0]
+		}
+		action := strings.ToUpper(expression[clause[2]:clause[3]])
+		for _, part := range strings.Split(expression[clause[1]:end], ",") {
+			part = strings.TrimSpace(part)
+			if action == "REMOVE" {
+				delete(it, attributeName(part))
+				continue
+			}
+			name, value, found := strings.Cut(part, "=")
+			v, ok := values[strings.TrimSpace(value)]
+			if !found || !ok {
+				return &apiError{Type: "ValidationException", Message: fmt.Sprintf("unsupported update expression: %s", expression)}
+			}
+			it[attributeName(strings.TrimSpace(name))] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package localaws
+
+import (
+	"github.com/google/uuid"
+)
+
+// Event is an event sent with PutEvents
+type Event struct {
+	ID           string `json:"id"`
+	Source       string `json:"source"`
+	DetailType   string `json:"detailType"`
+	Detail       string `json:"detail"`
+	EventBusName string `json:"eventBusName,omitempty"`
+}
+
+// Events returns the events sent so far
+func (s *Server) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+// RejectEvents makes PutEvents fail every entry with the error code, as EventBridge does when it is throttling. An
+// empty code accepts events again
+func (s *Server) RejectEvents(errorCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejectCode = errorCode
+}
+
+// RuleEnabled returns whether a rule was last enabled or disabled. Rules are enabled until DisableRule is called
+func (s *Server) RuleEnabled(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	enabled, found := s.rules[name]
+	return !found || enabled
+}
+
+func (s *Server) eventBridgeOperation(name string) operation {
+	switch name {
+	case "PutEvents":
+		return s.ebPutEvents
+	case "EnableRule":
+		return s.ebSetRule(true)
+	case "DisableRule":
+		return s.ebSetRule(false)
+	}
+	return nil
+}
+
+func (s *Server) ebPutEvents(body []byte) (any, error) {
+	input, err := decode[struct {
+		Entries []struct {
+			Source       string
+			DetailType   string
+			Detail       string
+			EventBusName string
+		}
+	}](body)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]map[string]string, 0, len(input.Entries))
+	if s.rejectCode != "" {
+		for range input.Entries {
+			entries = append(entries, map[string]string{"ErrorCode": s.rejectCode, "ErrorMessage": "Rejected by localaws"})
+		}
+		return map[string]any{"FailedEntryCount": len(entries), "Entries": entries}, nil
+	}
+	for _, entry := range input.Entries {
+		event := Event{
+			ID:           uuid.NewString(),
+			Source:       entry.Source,
+			DetailType:   entry.DetailType,
+			Detail:       entry.Detail,
+			EventBusName: entry.EventBusName,
+		}
+		s.events = append(s.events, event)
+		s.logf("EventBridge event %s %s: %s", event.Source, event.DetailType, event.Detail)
+		entries = append(entries, map[string]string{"EventId": event.ID})
+	}
+	return map[string]any{"FailedEntryCount": 0, "Entries": entries}, nil
+}
+
+func (s *Server) ebSetRule(enabled bool) operation {
+	return func(body []byte) (any, error) {
+		input, err := decode[struct{ Name string }](body)
+		if err != nil {
+			return nil, err
+		}
+		s.rules[input.Name] = enabled
+		s.logf("EventBridge rule %s enabled: %t", input.Name, enabled)
+		return map[string]any{}, nil
+	}
+}
@@ -0,0 +1,143 @@
+// Package localaws is an in-memory stand-in for the AWS services used by the lambdas. Point the AWS SDK at the server
+// with the AWS_ENDPOINT_URL environment variable, or the BaseEndpoint client option, to run the lambdas without AWS.
+//
+// Only the operations used by this repository are implemented.
+package localaws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Server handles SSM, EventBridge and DynamoDB requests (AWS JSON protocol) and SNS requests (AWS query protocol)
+type Server struct {
+	// Log receives a line for each published event and notification. Nothing is logged if it is nil
+	Log *log.Logger
+
+	mu         sync.Mutex
+	parameters map[string]parameter
+	events     []Event
+	rejectCode string
+	rules      map[string]bool
+	tables     map[string]*table
+	messages   []Message
+}
+
+func NewServer() *Server {
+	return &Server{
+		parameters: make(map[string]parameter),
+		rules:      make(map[string]bool),
+		tables:     make(map[string]*table),
+	}
+}
+
+// Config returns an AWS config which sends every request to the server listening at endpoint
+func Config(endpoint string) aws.Config {
+	return aws.Config{
+		Region:       "eu-west-1",
+		BaseEndpoint: aws.String(endpoint),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "local", SecretAccessKey: "local"}, nil
+		}),
+	}
+}
+
+type operation func(body []byte) (any, error)
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, "application/x-amz-json-1.1", &apiError{Type: "InternalFailure", Message: err.Error()})
+		return
+	}
+
+	target := r.Header.Get("X-Amz-Target")
+	if target == "" {
+		s.serveQuery(w, r, body)
+		return
+	}
+
+	service, name, _ := strings.Cut(target, ".")
+	contentType := "application/x-amz-json-1.1"
+	var op operation
+	switch service {
+	case "AmazonSSM":
+		op = s.ssmOperation(name)
+	case "AWSEvents":
+		op = s.eventBridgeOperation(name)
+	case "DynamoDB_20120810":
+		contentType = "application/x-amz-json-1.0"
+		op = s.dynamoDBOperation(name)
+	}
+	if op == nil {
+		writeError(w, contentType, &apiError{Type: "UnknownOperationException", Message: fmt.Sprintf("%s is not implemented", target)})
+		return
+	}
+
+	s.mu.Lock()
+	res, err := op(body)
+	s.mu.Unlock()
+	if err != nil {
+		writeError(w, contentType, err)
+		return
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		writeError(w, contentType, &apiError{Type: "InternalFailure", Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(b)
+}
+
+// apiError is returned to the SDK as a client error
+type apiError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+	// CancellationReasons is set when a DynamoDB transaction is cancelled
+	CancellationReasons []cancellationReason `json:",omitempty"`
+}
+
+type cancellationReason struct {
+	Code    string
+	Message string `json:",omitempty"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+func writeError(w http.ResponseWriter, contentType string, err error) {
+	apiErr, ok := err.(*apiError)
+	if !ok {
+		apiErr = &apiError{Type: "ValidationException", Message: err.Error()}
+	}
+	b, _ := json.Marshal(apiErr)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = w.Write(b)
+}
+
+func decode[T any](body []byte) (*T, error) {
+	var input T
+	err := json.Unmarshal(body, &input)
+	if err != nil {
+		return nil, &apiError{Type: "SerializationException", Message: err.Error()}
+	}
+	return &input, nil
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.Log != nil {
+		s.Log.Printf(format, args...)
+	}
+}
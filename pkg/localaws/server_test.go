@@ -0,0 +1,150 @@
+package localaws
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/ockendenjo/strava-shoes/pkg/bags"
+	"github.com/ockendenjo/strava-shoes/pkg/dedupe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfig(t *testing.T, server *Server) aws.Config {
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return Config(httpServer.URL)
+}
+
+func TestSSM(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	server.PutParameter("/strava/clientId", "123")
+	client := ssm.NewFromConfig(newTestConfig(t, server))
+
+	res, err := client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String("/strava/clientId")})
+	require.NoError(t, err)
+	assert.Equal(t, "123", aws.ToString(res.Parameter.Value))
+
+	_, err = client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String("/strava/missing")})
+	_, notFound := errors.AsType[*ssmTypes.ParameterNotFound](err)
+	assert.True(t, notFound, "missing parameter error: %v", err)
+
+	_, err = client.PutParameter(ctx, &ssm.PutParameterInput{Name: aws.String("/strava/clientId"), Value: aws.String("456")})
+	_, exists := errors.AsType[*ssmTypes.ParameterAlreadyExists](err)
+	assert.True(t, exists, "overwrite error: %v", err)
+
+	_, err = client.PutParameter(ctx, &ssm.PutParameterInput{Name: aws.String("/strava/clientId"), Value: aws.String("456"), Overwrite: aws.Bool(true)})
+	require.NoError(t, err)
+	value, _ := server.Parameter("/strava/clientId")
+	assert.Equal(t, "456", value)
+
+	params, err := client.GetParameters(ctx, &ssm.GetParametersInput{Names: []string{"/strava/clientId", "/strava/missing"}})
+	require.NoError(t, err)
+	assert.Len(t, params.Parameters, 1)
+	assert.Equal(t, []string{"/strava/missing"}, params.InvalidParameters)
+}
+
+func TestEventBridge(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	client := eventbridge.NewFromConfig(newTestConfig(t, server))
+
+	res, err := client.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{
+			{Source: aws.String("io.ockenden.strava"), DetailType: aws.String("StravaActivityCreated"), Detail: aws.String(`{"id": 1}`)},
+			{Source: aws.String("io.ockenden.strava"), DetailType: aws.String("StravaActivityCreated"), Detail: aws.String(`{"id": 2}`)},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), res.FailedEntryCount)
+	require.Len(t, server.Events(), 2)
+	assert.Equal(t, `{"id": 2}`, server.Events()[1].Detail)
+
+	_, err = client.DisableRule(ctx, &eventbridge.DisableRuleInput{Name: aws.String("schedule")})
+	require.NoError(t, err)
+	assert.False(t, server.RuleEnabled("schedule"))
+	_, err = client.EnableRule(ctx, &eventbridge.EnableRuleInput{Name: aws.String("schedule")})
+	require.NoError(t, err)
+	assert.True(t, server.RuleEnabled("schedule"))
+}
+
+func TestDynamoDB(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	server.CreateTable("events", "ID", "")
+	client := dedupe.NewClient(dynamodb.NewFromConfig(newTestConfig(t, server)), "events", time.Hour)
+
+	claimed, err := client.Claim(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, err = client.Claim(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, claimed, "second claim")
+	assert.Equal(t, 1, server.ItemCount("events"))
+
+	require.NoError(t, client.Release(ctx, "a"))
+	assert.Equal(t, 0, server.ItemCount("events"))
+
+	claimed, err = client.Claim(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, claimed, "claim after release")
+}
+
+func TestDynamoDB_queryAndBatchWrite(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	server.CreateTable("bags", "AthleteID", "BagID")
+	client := bags.NewClient(dynamodb.NewFromConfig(newTestConfig(t, server)), "bags")
+
+	for _, bag := range []bags.Bag{
+		{AthleteID: 1001, HillID: 1, ActivityID: 10},
+		{AthleteID: 1001, HillID: 2, ActivityID: 10},
+		{AthleteID: 1002, HillID: 1, ActivityID: 20},
+	} {
+		require.NoError(t, client.PutBag(ctx, bag))
+	}
+
+	bagList, err := client.GetBags(ctx, 1001)
+	require.NoError(t, err)
+	require.Len(t, bagList, 2)
+	assert.Equal(t, 1, bagList[0].HillID)
+	assert.Equal(t, 2, bagList[1].HillID)
+
+	deleted, err := client.DeleteAthlete(ctx, 1001)
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	bagList, err = client.GetBags(ctx, 1001)
+	require.NoError(t, err)
+	assert.Empty(t, bagList)
+	assert.Equal(t, 1, server.ItemCount("bags"))
+}
+
+func TestSNS(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	client := sns.NewFromConfig(newTestConfig(t, server))
+
+	res, err := client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String("arn:aws:sns:eu-west-1:123456789012:strava"),
+		Subject:  aws.String("Subject"),
+		Message:  aws.String("Message"),
+	})
+	require.NoError(t, err)
+
+	messages := server.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, aws.ToString(res.MessageId), messages[0].ID)
+	assert.Equal(t, "Message", messages[0].Message)
+}
@@ -0,0 +1,75 @@
+package localaws
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// Message is a notification sent with Publish
+type Message struct {
+	ID       string `json:"id"`
+	TopicArn string `json:"topicArn"`
+	Subject  string `json:"subject,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Messages returns the notifications sent so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+type queryError struct {
+	XMLName xml.Name `xml:"ErrorResponse"`
+	Error   struct {
+		Type    string `xml:"Type"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+}
+
+type publishResponse struct {
+	XMLName xml.Name `xml:"http://sns.amazonaws.com/doc/2010-03-31/ PublishResponse"`
+	Result  struct {
+		MessageID string `xml:"MessageId"`
+	} `xml:"PublishResult"`
+}
+
+// serveQuery handles SNS requests, which use the AWS query protocol
+func (s *Server) serveQuery(w http.ResponseWriter, r *http.Request, body []byte) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil || values.Get("Action") != "Publish" {
+		res := queryError{}
+		res.Error.Type = "Sender"
+		res.Error.Code = "InvalidAction"
+		res.Error.Message = "only the SNS Publish action is implemented"
+		writeXML(w, http.StatusBadRequest, res)
+		return
+	}
+
+	message := Message{
+		ID:       uuid.NewString(),
+		TopicArn: values.Get("TopicArn"),
+		Subject:  values.Get("Subject"),
+		Message:  values.Get("Message"),
+	}
+	s.mu.Lock()
+	s.messages = append(s.messages, message)
+	s.mu.Unlock()
+	s.logf("SNS message to %s: %s\n%s", message.TopicArn, message.Subject, message.Message)
+
+	res := publishResponse{}
+	res.Result.MessageID = message.ID
+	writeXML(w, http.StatusOK, res)
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	b, _ := xml.Marshal(v)
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,142 @@
+package localaws
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type parameter struct {
+	Name    string `json:"Name"`
+	Type    string `json:"Type"`
+	Value   string `json:"Value"`
+	Version int64  `json:"Version"`
+}
+
+// PutParameter stores an SSM parameter
+func (s *Server) PutParameter(name string, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putParameter(name, value, "String")
+}
+
+// Parameter returns the value of an SSM parameter
+func (s *Server) Parameter(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, found := s.parameters[name]
+	return p.Value, found
+}
+
+func (s *Server) putParameter(name string, value string, paramType string) int64 {
+	p := s.parameters[name]
+	p.Name = name
+	p.Value = value
+	p.Type = paramType
+	p.Version++
+	s.parameters[name] = p
+	return p.Version
+}
+
+func (s *Server) ssmOperation(name string) operation {
+	switch name {
+	case "GetParameter":
+		return s.ssmGetParameter
+	case "GetParameters":
+		return s.ssmGetParameters
+	case "GetParametersByPath":
+		return s.ssmGetParametersByPath
+	case "PutParameter":
+		return s.ssmPutParameter
+	case "DeleteParameter":
+		return s.ssmDeleteParameter
+	}
+	return nil
+}
+
+func (s *Server) ssmGetParameter(body []byte) (any, error) {
+	input, err := decode[struct{ Name string }](body)
+	if err != nil {
+		return nil, err
+	}
+	p, found := s.parameters[input.Name]
+	if !found {
+		return nil, parameterNotFound(input.Name)
+	}
+	return map[string]any{"Parameter": p}, nil
+}
+
+func (s *Server) ssmGetParameters(body []byte) (any, error) {
+	input, err := decode[struct{ Names []string }](body)
+	if err != nil {
+		return nil, err
+	}
+	params := []parameter{}
+	invalid := []string{}
+	for _, name := range input.Names {
+		if p, found := s.parameters[name]; found {
+			params = append(params, p)
+		} else {
+			invalid = append(invalid, name)
+		}
+	}
+	return map[string]any{"Parameters": params, "InvalidParameters": invalid}, nil
+}
+
+func (s *Server) ssmGetParametersByPath(body []byte) (any, error) {
+	input, err := decode[struct {
+		Path      string
+		Recursive bool
+	}](body)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(input.Path, "/") + "/"
+	params := []parameter{}
+	for name, p := range s.parameters {
+		rest, found := strings.CutPrefix(name, prefix)
+		if found && (input.Recursive || !strings.Contains(rest, "/")) {
+			params = append(params, p)
+		}
+	}
+	slices.SortFunc(params, func(a, b parameter) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return map[string]any{"Parameters": params}, nil
+}
+
+func (s *Server) ssmPutParameter(body []byte) (any, error) {
+	input, err := decode[struct {
+		Name      string
+		Value     string
+		Type      string
+		Overwrite bool
+	}](body)
+	if err != nil {
+		return nil, err
+	}
+	if _, found := s.parameters[input.Name]; found && !input.Overwrite {
+		return nil, &apiError{Type: "ParameterAlreadyExists", Message: fmt.Sprintf("parameter %s already exists", input.Name)}
+	}
+	paramType := input.Type
+	if paramType == "" {
+		paramType = s.parameters[input.Name].Type
+	}
+	return map[string]any{"Version": s.putParameter(input.Name, input.Value, paramType)}, nil
+}
+
+func (s *Server) ssmDeleteParameter(body []byte) (any, error) {
+	input, err := decode[struct{ Name string }](body)
+	if err != nil {
+		return nil, err
+	}
+	if _, found := s.parameters[input.Name]; !found {
+		return nil, parameterNotFound(input.Name)
+	}
+	delete(s.parameters, input.Name)
+	return map[string]any{}, nil
+}
+
+func parameterNotFound(name string) error {
+	return &apiError{Type: "ParameterNotFound", Message: fmt.Sprintf("parameter %s not found", name)}
+}
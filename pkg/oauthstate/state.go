@@ -0,0 +1,80 @@
+// Package oauthstate signs and verifies the state parameter sent through an OAuth authorization, so that the callback
+// only accepts authorizations which the app started
+package oauthstate
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalid = errors.New("invalid OAuth state")
+var ErrExpired = errors.New("expired OAuth state")
+
+// Signer creates states which expire after the TTL. Data is carried through the authorization unchanged, e.g. the
+// scopes which were requested. It is signed but not encrypted
+type Signer struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+func NewSigner(key []byte, ttl time.Duration) *Signer {
+	return &Signer{key: key, ttl: ttl, now: time.Now}
+}
+
+type payload struct {
+	Data    string `json:"d,omitempty"`
+	Expires int64  `json:"e"`
+	Nonce   string `json:"n"`
+}
+
+// Sign returns a state of the form <payload>.<signature>, which is safe to use in a URL, and the random nonce in it.
+// The nonce should be stored in the browser, so that the callback can check the authorization was started there
+func (s *Signer) Sign(data string) (string, string, error) {
+	nonce := rand.Text()
+	b, err := json.Marshal(payload{Data: data, Expires: s.now().Add(s.ttl).Unix(), Nonce: nonce})
+	if err != nil {
+		return "", "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(b)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded)), nonce, nil
+}
+
+// Verify returns the data and nonce from a state created by Sign. It returns ErrInvalid if the state was not created
+// with the same key and ErrExpired if the TTL has passed
+func (s *Signer) Verify(state string) (string, string, error) {
+	encoded, signature, found := strings.Cut(state, ".")
+	if !found {
+		return "", "", ErrInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, s.sign(encoded)) {
+		return "", "", ErrInvalid
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", ErrInvalid
+	}
+	var p payload
+	err = json.Unmarshal(b, &p)
+	if err != nil {
+		return "", "", ErrInvalid
+	}
+	if s.now().Unix() > p.Expires {
+		return "", "", ErrExpired
+	}
+	return p.Data, p.Nonce, nil
+}
+
+func (s *Signer) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,99 @@
+package oauthstate
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Verify(t *testing.T) {
+	start := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	testcases := []struct {
+		name    string
+		key     string
+		elapsed time.Duration
+		modify  func(state string) string
+		expData string
+		expErr  error
+	}{
+		{
+			name:    "valid",
+			key:     "secret",
+			elapsed: 9 * time.Minute,
+			expData: "write",
+		},
+		{
+			name:    "expired",
+			key:     "secret",
+			elapsed: 11 * time.Minute,
+			expErr:  ErrExpired,
+		},
+		{
+			name:   "different key",
+			key:    "other",
+			expErr: ErrInvalid,
+		},
+		{
+			name: "modified payload",
+			key:  "secret",
+			modify: func(state string) string {
+				return "x" + state
+			},
+			expErr: ErrInvalid,
+		},
+		{
+			name: "no signature",
+			key:  "secret",
+			modify: func(state string) string {
+				payload, _, _ := strings.Cut(state, ".")
+				return payload
+			},
+			expErr: ErrInvalid,
+		},
+		{
+			name: "empty",
+			key:  "secret",
+			modify: func(state string) string {
+				return ""
+			},
+			expErr: ErrInvalid,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			signer := NewSigner([]byte("secret"), 10*time.Minute)
+			signer.now = func() time.Time { return start }
+			state, nonce, err := signer.Sign("write")
+			require.NoError(t, err)
+			if tc.modify != nil {
+				state = tc.modify(state)
+			}
+
+			verifier := NewSigner([]byte(tc.key), 10*time.Minute)
+			verifier.now = func() time.Time { return start.Add(tc.elapsed) }
+			data, verifiedNonce, err := verifier.Verify(state)
+			if tc.expErr != nil {
+				assert.ErrorIs(t, err, tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expData, data)
+			assert.Equal(t, nonce, verifiedNonce)
+		})
+	}
+}
+
+func Test_Sign_unique(t *testing.T) {
+	signer := NewSigner([]byte("secret"), time.Minute)
+	a, aNonce, err := signer.Sign("read")
+	require.NoError(t, err)
+	b, bNonce, err := signer.Sign("read")
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b)
+	assert.NotEqual(t, aNonce, bNonce)
+}
@@ -0,0 +1,75 @@
+// Package settings stores per-athlete options
+package settings
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const pk = "AthleteID"
+const describeBags = "DescribeBags"
+
+// Settings holds the options for an athlete. The zero value is used for athletes without stored settings
+type Settings struct {
+	AthleteID int64 `json:"athleteId"`
+	// DescribeBags appends the hills bagged on an activity to its description
+	DescribeBags bool `json:"describeBags"`
+}
+
+type Client interface {
+	GetSettings(ctx context.Context, athleteID int64) (*Settings, error)
+	PutSettings(ctx context.Context, settings Settings) error
+	DeleteSettings(ctx context.Context, athleteID int64) error
+}
+
+func NewClient(dbClient *dynamodb.Client, tableName string) Client {
+	return &settingsClient{dbClient: dbClient, tableName: tableName}
+}
+
+type settingsClient struct {
+	dbClient  *dynamodb.Client
+	tableName string
+}
+
+func (s settingsClient) GetSettings(ctx context.Context, athleteID int64) (*Settings, error) {
+	res, err := s.dbClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]dynamoTypes.AttributeValue{
+			pk: &dynamoTypes.AttributeValueMemberS{Value: fmt.Sprint(athleteID)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &Settings{AthleteID: athleteID}
+	if v, ok := res.Item[describeBags].(*dynamoTypes.AttributeValueMemberBOOL); ok {
+		settings.DescribeBags = v.Value
+	}
+	return settings, nil
+}
+
+func (s settingsClient) PutSettings(ctx context.Context, settings Settings) error {
+	_, err := s.dbClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item: map[string]dynamoTypes.AttributeValue{
+			pk:           &dynamoTypes.AttributeValueMemberS{Value: fmt.Sprint(settings.AthleteID)},
+			describeBags: &dynamoTypes.AttributeValueMemberBOOL{Value: settings.DescribeBags},
+		},
+	})
+	return err
+}
+
+func (s settingsClient) DeleteSettings(ctx context.Context, athleteID int64) error {
+	_, err := s.dbClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]dynamoTypes.AttributeValue{
+			pk: &dynamoTypes.AttributeValueMemberS{Value: fmt.Sprint(athleteID)},
+		},
+	})
+	return err
+}
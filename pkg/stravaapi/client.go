@@ -0,0 +1,375 @@
+// Package stravaapi calls Strava API endpoints which are not provided by github.com/ockendenjo/strava
+package stravaapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ockendenjo/strava"
+	"github.com/ockendenjo/strava-shoes/pkg/geo"
+)
+
+const defaultBaseURL = "https://www.strava.com"
+
+// GearNone clears the gear from an activity when used as ActivityUpdate.GearID
+const GearNone = "none"
+
+var ErrUnauthorized = errors.New("strava API returned HTTP 401")
+var ErrNotFound = errors.New("strava API returned HTTP 404")
+
+type Client interface {
+	GetAthlete(ctx context.Context) (*DetailedAthlete, error)
+	GetActivity(ctx context.Context, id int64) (*strava.Activity, error)
+	GetActivities(ctx context.Context, query ActivitiesQuery) ([]strava.Activity, error)
+	GetActivitySummary(ctx context.Context, id int64) (*ActivitySummary, error)
+	GetLatLngStream(ctx context.Context, id int64) ([]geo.Point, error)
+	UpdateActivity(ctx context.Context, id int64, update ActivityUpdate) error
+	ListSubscriptions(ctx context.Context) ([]Subscription, error)
+}
+
+// DetailedAthlete is the authenticated athlete with their gear
+type DetailedAthlete struct {
+	AthleteProfile
+	Bikes []Gear `json:"bikes"`
+	Shoes []Gear `json:"shoes"`
+}
+
+// Gear is a bike or pair of shoes. The primary gear is assigned to new activities by Strava
+type Gear struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Primary bool   `json:"primary"`
+	Retired bool   `json:"retired"`
+}
+
+// Subscription is a push subscription for the app
+type Subscription struct {
+	ID          int64  `json:"id"`
+	CallbackURL string `json:"callback_url"`
+}
+
+// ActivitySummary holds the activity fields used for route features
+type ActivitySummary struct {
+	ID          int64       `json:"id"`
+	Athlete     AthleteRef  `json:"athlete"`
+	StartDate   time.Time   `json:"start_date"`
+	Description string      `json:"description"`
+	Map         ActivityMap `json:"map"`
+}
+
+type AthleteRef struct {
+	ID int64 `json:"id"`
+}
+
+type ActivityMap struct {
+	SummaryPolyline string `json:"summary_polyline"`
+}
+
+// ActivitiesQuery selects a page of the athlete's activities. Zero values are not sent to Strava
+type ActivitiesQuery struct {
+	Page    int
+	PerPage int
+	After   time.Time
+	Before  time.Time
+}
+
+// ActivityUpdate holds the fields to change on an activity. Nil fields are left unchanged
+type ActivityUpdate struct {
+	GearID      *string `json:"gear_id,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+// Tokens is an OAuth token pair for an athlete
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// AppCredentials identifies the Strava app
+type AppCredentials struct {
+	ClientID     string
+	ClientSecret string
+}
+
+type TokenStore interface {
+	GetTokens(ctx context.Context) (*Tokens, error)
+	PutTokens(ctx context.Context, tokens *Tokens) error
+}
+
+type CredentialsGetter interface {
+	GetAppCredentials(ctx context.Context) (*AppCredentials, error)
+}
+
+func NewClient(httpClient *http.Client, credentials CredentialsGetter, tokens TokenStore) Client {
+	return &apiClient{
+		httpClient:  httpClient,
+		credentials: credentials,
+		tokens:      tokens,
+		baseURL:     defaultBaseURL,
+	}
+}
+
+type apiClient struct {
+	httpClient  *http.Client
+	credentials CredentialsGetter
+	tokens      TokenStore
+	baseURL     string
+}
+
+func (c *apiClient) GetAthlete(ctx context.Context) (*DetailedAthlete, error) {
+	var athlete DetailedAthlete
+	err := c.do(ctx, http.MethodGet, "/api/v3/athlete", nil, &athlete)
+	if err != nil {
+		return nil, err
+	}
+	return &athlete, nil
+}
+
+func (c *apiClient) GetActivity(ctx context.Context, id int64) (*strava.Activity, error) {
+	var activity strava.Activity
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v3/activities/%d", id), nil, &activity)
+	if err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
+
+func (c *apiClient) GetActivitySummary(ctx context.Context, id int64) (*ActivitySummary, error) {
+	var activity ActivitySummary
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v3/activities/%d", id), nil, &activity)
+	if err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
+
+// GetLatLngStream returns the GPS points recorded for an activity. Activities without GPS data return no points
+func (c *apiClient) GetLatLngStream(ctx context.Context, id int64) ([]geo.Point, error) {
+	var streams struct {
+		LatLng struct {
+			Data [][2]float64 `json:"data"`
+		} `json:"latlng"`
+	}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v3/activities/%d/streams?keys=latlng&key_by_type=true", id), nil, &streams)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]geo.Point, 0, len(streams.LatLng.Data))
+	for _, p := range streams.LatLng.Data {
+		points = append(points, geo.Point{Lat: p[0], Lon: p[1]})
+	}
+	return points, nil
+}
+
+func (c *apiClient) GetActivities(ctx context.Context, query ActivitiesQuery) ([]strava.Activity, error) {
+	values := url.Values{}
+	if query.Page > 0 {
+		values.Set("page", strconv.Itoa(query.Page))
+	}
+	if query.PerPage > 0 {
+		values.Set("per_page", strconv.Itoa(query.PerPage))
+	}
+	if !query.After.IsZero() {
+		values.Set("after", strconv.FormatInt(query.After.Unix(), 10))
+	}
+	if !query.Before.IsZero() {
+		values.Set("before", strconv.FormatInt(query.Before.Unix(), 10))
+	}
+
+	var activities []strava.Activity
+	err := c.do(ctx, http.MethodGet, "/api/v3/athlete/activities?"+values.Encode(), nil, &activities)
+	if err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+func (c *apiClient) UpdateActivity(ctx context.Context, id int64, update ActivityUpdate) error {
+	b, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/api/v3/activities/%d", id), b, nil)
+}
+
+func (c *apiClient) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	creds, err := c.credentials.GetAppCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{
+		"client_id":     {creds.ClientID},
+		"client_secret": {creds.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v3/push_subscriptions?"+values.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(res.Body)
+
+	var subscriptions []Subscription
+	err = readResponse(res, &subscriptions)
+	if err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// do sends an authorized request, refreshing the access token and retrying once if Strava returns HTTP 401
+func (c *apiClient) do(ctx context.Context, method string, path string, body []byte, out any) error {
+	tokens, err := c.tokens.GetTokens(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get tokens: %w", err)
+	}
+
+	err = c.doWithToken(ctx, tokens.AccessToken, method, path, body, out)
+	if !errors.Is(err, ErrUnauthorized) {
+		return err
+	}
+
+	tokens, err = c.refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		return fmt.Errorf("failed to refresh tokens: %w", err)
+	}
+	return c.doWithToken(ctx, tokens.AccessToken, method, path, body, out)
+}
+
+func (c *apiClient) doWithToken(ctx context.Context, accessToken string, method string, path string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(res.Body)
+
+	return readResponse(res, out)
+}
+
+func (c *apiClient) refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	var tokens Tokens
+	err := postToken(ctx, c.httpClient, c.baseURL, c.credentials, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	}, &tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.tokens.PutTokens(ctx, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store tokens: %w", err)
+	}
+	return &tokens, nil
+}
+
+// Authorization is the response to an authorization code exchange
+type Authorization struct {
+	Tokens
+	Athlete AthleteProfile `json:"athlete"`
+}
+
+// AthleteProfile is the summary of the athlete returned with an authorization
+type AthleteProfile struct {
+	ID        int64  `json:"id"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+}
+
+func (p AthleteProfile) Name() string {
+	return strings.TrimSpace(p.Firstname + " " + p.Lastname)
+}
+
+// ExchangeCode exchanges the code from the authorization callback for the athlete's tokens
+func ExchangeCode(ctx context.Context, httpClient *http.Client, credentials CredentialsGetter, code string) (*Authorization, error) {
+	return exchangeCode(ctx, httpClient, defaultBaseURL, credentials, code)
+}
+
+func exchangeCode(ctx context.Context, httpClient *http.Client, baseURL string, credentials CredentialsGetter, code string) (*Authorization, error) {
+	var authorization Authorization
+	err := postToken(ctx, httpClient, baseURL, credentials, url.Values{
+		"grant_type": {"authorization_code"},
+		"code":       {code},
+	}, &authorization)
+	if err != nil {
+		return nil, err
+	}
+	if authorization.Athlete.ID < 1 {
+		return nil, fmt.Errorf("no athlete in authorization response")
+	}
+	return &authorization, nil
+}
+
+// postToken sends a request to the OAuth token endpoint with the app credentials added to the form
+func postToken(ctx context.Context, httpClient *http.Client, baseURL string, credentials CredentialsGetter, form url.Values, out any) error {
+	creds, err := credentials.GetAppCredentials(ctx)
+	if err != nil {
+		return err
+	}
+	form.Set("client_id", creds.ClientID)
+	form.Set("client_secret", creds.ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(res.Body)
+
+	return readResponse(res, out)
+}
+
+func readResponse(res *http.Response, out any) error {
+	if res.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("strava API returned HTTP %d: %s", res.StatusCode, string(b))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,84 @@
+package stravaapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStore struct {
+	tokens *Tokens
+}
+
+func (s *testStore) GetTokens(ctx context.Context) (*Tokens, error) {
+	return s.tokens, nil
+}
+
+func (s *testStore) PutTokens(ctx context.Context, tokens *Tokens) error {
+	s.tokens = tokens
+	return nil
+}
+
+func (s *testStore) GetAppCredentials(ctx context.Context) (*AppCredentials, error) {
+	return &AppCredentials{ClientID: "123", ClientSecret: "secret"}, nil
+}
+
+func Test_UpdateActivity_refreshesExpiredToken(t *testing.T) {
+	var gotGearID string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "old-refresh", r.FormValue("refresh_token"))
+		assert.Equal(t, "secret", r.FormValue("client_secret"))
+		_ = json.NewEncoder(w).Encode(Tokens{AccessToken: "new-access", RefreshToken: "new-refresh"})
+	})
+	mux.HandleFunc("PUT /api/v3/activities/42", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer new-access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var update map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&update)
+		gotGearID = update["gear_id"]
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	store := &testStore{tokens: &Tokens{AccessToken: "old-access", RefreshToken: "old-refresh"}}
+	client := &apiClient{httpClient: server.Client(), credentials: store, tokens: store, baseURL: server.URL}
+
+	gearID := "g123"
+	err := client.UpdateActivity(context.Background(), 42, ActivityUpdate{GearID: &gearID})
+	require.NoError(t, err)
+	assert.Equal(t, "g123", gotGearID)
+	assert.Equal(t, "new-refresh", store.tokens.RefreshToken)
+}
+
+func Test_exchangeCode(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "authorization_code", r.FormValue("grant_type"))
+		assert.Equal(t, "123", r.FormValue("client_id"))
+		if r.FormValue("code") != "valid" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token": "access", "refresh_token": "refresh", "expires_at": 1780000000, "athlete": {"id": 1001, "firstname": "Hamish", "lastname": "Brown"}}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	store := &testStore{}
+	authorization, err := exchangeCode(context.Background(), server.Client(), server.URL, store, "valid")
+	require.NoError(t, err)
+	assert.Equal(t, Tokens{AccessToken: "access", RefreshToken: "refresh", ExpiresAt: 1780000000}, authorization.Tokens)
+	assert.Equal(t, int64(1001), authorization.Athlete.ID)
+	assert.Equal(t, "Hamish Brown", authorization.Athlete.Name())
+
+	_, err = exchangeCode(context.Background(), server.Client(), server.URL, store, "invalid")
+	assert.ErrorContains(t, err, "HTTP 400")
+}
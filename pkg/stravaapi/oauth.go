@@ -0,0 +1,59 @@
+package stravaapi
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// OAuth scopes which an athlete may grant. Strava lists the granted scopes in the scope parameter of the
+// authorization callback
+const (
+	ScopeRead            = "read"
+	ScopeProfileReadAll  = "profile:read_all"
+	ScopeActivityRead    = "activity:read"
+	ScopeActivityReadAll = "activity:read_all"
+	ScopeActivityWrite   = "activity:write"
+)
+
+// Scopes is a list of OAuth scopes
+type Scopes []string
+
+// ParseScopes parses a comma separated list of scopes, e.g. "read,activity:read_all"
+func ParseScopes(s string) Scopes {
+	var scopes Scopes
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != "" && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+func (s Scopes) Has(scope string) bool {
+	return slices.Contains(s, scope)
+}
+
+// CanReadActivities reports whether the scopes allow the athlete's activities to be listed
+func (s Scopes) CanReadActivities() bool {
+	return s.Has(ScopeActivityRead) || s.Has(ScopeActivityReadAll)
+}
+
+func (s Scopes) String() string {
+	return strings.Join(s, ",")
+}
+
+// AuthorizeURL returns the Strava page which asks the athlete to grant the scopes to the app. Strava redirects to
+// redirectURI with the state and the granted scopes
+func AuthorizeURL(clientID string, redirectURI string, scopes Scopes, state string) string {
+	values := url.Values{
+		"client_id":       {clientID},
+		"response_type":   {"code"},
+		"approval_prompt": {"auto"},
+		"redirect_uri":    {redirectURI},
+		"scope":           {scopes.String()},
+		"state":           {state},
+	}
+	return defaultBaseURL + "/oauth/authorize?" + values.Encode()
+}
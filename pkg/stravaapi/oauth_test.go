@@ -0,0 +1,67 @@
+package stravaapi
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseScopes(t *testing.T) {
+	testcases := []struct {
+		name        string
+		scope       string
+		expScopes   Scopes
+		expReadable bool
+		expWritable bool
+	}{
+		{
+			name:        "read all and write",
+			scope:       "read,activity:read_all,activity:write",
+			expScopes:   Scopes{"read", "activity:read_all", "activity:write"},
+			expReadable: true,
+			expWritable: true,
+		},
+		{
+			name:        "read",
+			scope:       "read,activity:read",
+			expScopes:   Scopes{"read", "activity:read"},
+			expReadable: true,
+		},
+		{
+			name:      "no activity scope",
+			scope:     "read",
+			expScopes: Scopes{"read"},
+		},
+		{
+			name:      "duplicates and spaces",
+			scope:     " read, read ,,",
+			expScopes: Scopes{"read"},
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			scopes := ParseScopes(tc.scope)
+			assert.Equal(t, tc.expScopes, scopes)
+			assert.Equal(t, tc.expReadable, scopes.CanReadActivities())
+			assert.Equal(t, tc.expWritable, scopes.Has(ScopeActivityWrite))
+		})
+	}
+}
+
+func Test_AuthorizeURL(t *testing.T) {
+	u, err := url.Parse(AuthorizeURL("123", "https://api.example.com/auth", Scopes{ScopeActivityReadAll, ScopeActivityWrite}, "abc.def"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "www.strava.com", u.Host)
+	assert.Equal(t, "/oauth/authorize", u.Path)
+	assert.Equal(t, "123", u.Query().Get("client_id"))
+	assert.Equal(t, "https://api.example.com/auth", u.Query().Get("redirect_uri"))
+	assert.Equal(t, "activity:read_all,activity:write", u.Query().Get("scope"))
+	assert.Equal(t, "abc.def", u.Query().Get("state"))
+}
@@ -0,0 +1,105 @@
+package stravaapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+const (
+	paramClientID       = "/strava/clientId"
+	paramClientSecret   = "/strava/clientSecret"
+	paramSubscriptionID = "/strava/subscriptionId"
+	paramCallbackToken  = "/strava/callbackToken"
+	paramAPIKey         = "/strava/apiKey"
+)
+
+var ErrNoSubscription = errors.New("no subscription stored")
+
+// StoredSubscription identifies the push subscription created by the subscribe lambda.
+// CallbackToken is the secret query parameter included in the subscription callback URL.
+type StoredSubscription struct {
+	ID            int64
+	CallbackToken string
+}
+
+// NewSSMStore returns a store for the app credentials, push subscription and API key. It uses the same SSM parameters as
+// github.com/ockendenjo/strava. Athlete tokens are stored by the athletes package
+func NewSSMStore(ssmClient *ssm.Client) *SSMStore {
+	return &SSMStore{ssmClient: ssmClient}
+}
+
+type SSMStore struct {
+	ssmClient *ssm.Client
+}
+
+func (s *SSMStore) GetAppCredentials(ctx context.Context) (*AppCredentials, error) {
+	params, err := s.getParams(ctx, paramClientID, paramClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &AppCredentials{ClientID: params[paramClientID], ClientSecret: params[paramClientSecret]}, nil
+}
+
+// GetSubscription returns an error if the subscribe lambda has not stored a subscription
+func (s *SSMStore) GetSubscription(ctx context.Context) (*StoredSubscription, error) {
+	params, err := s.getParams(ctx, paramSubscriptionID, paramCallbackToken)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseInt(params[paramSubscriptionID], 10, 64)
+	if err != nil {
+		return nil, ErrNoSubscription
+	}
+	return &StoredSubscription{ID: id, CallbackToken: params[paramCallbackToken]}, nil
+}
+
+func (s *SSMStore) PutSubscription(ctx context.Context, sub *StoredSubscription) error {
+	err := s.putParam(ctx, paramCallbackToken, sub.CallbackToken)
+	if err != nil {
+		return err
+	}
+	return s.putParam(ctx, paramSubscriptionID, strconv.FormatInt(sub.ID, 10))
+}
+
+// GetAPIKey returns the key which authenticates requests to the gear rules API
+func (s *SSMStore) GetAPIKey(ctx context.Context) (string, error) {
+	params, err := s.getParams(ctx, paramAPIKey)
+	if err != nil {
+		return "", err
+	}
+	return params[paramAPIKey], nil
+}
+
+func (s *SSMStore) getParams(ctx context.Context, names ...string) (map[string]string, error) {
+	res, err := s.ssmClient.GetParameters(ctx, &ssm.GetParametersInput{
+		Names: names,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.InvalidParameters) > 0 {
+		return nil, fmt.Errorf("SSM parameters not found: %v", res.InvalidParameters)
+	}
+
+	params := make(map[string]string, len(res.Parameters))
+	for _, p := range res.Parameters {
+		params[aws.ToString(p.Name)] = aws.ToString(p.Value)
+	}
+	return params, nil
+}
+
+func (s *SSMStore) putParam(ctx context.Context, name string, value string) error {
+	_, err := s.ssmClient.PutParameter(ctx, &ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(value),
+		Type:      ssmTypes.ParameterTypeString,
+		Overwrite: aws.Bool(true),
+	})
+	return err
+}
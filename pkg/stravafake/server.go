@@ -0,0 +1,577 @@
+// Package stravafake is an in-memory Strava API for tests. Requests to any host made with Server.Client are sent to
+// the fake, so clients with the Strava URL built in can be used unchanged.
+package stravafake
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultClientID     = "12345"
+	DefaultClientSecret = "client-secret"
+	tokenLifetime       = 6 * time.Hour
+	defaultPerPage      = 30
+)
+
+// Athlete is the authenticated athlete
+type Athlete struct {
+	ID        int64  `json:"id"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+	Bikes     []Gear `json:"bikes"`
+	Shoes     []Gear `json:"shoes"`
+}
+
+type Gear struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Primary  bool    `json:"primary"`
+	Distance float64 `json:"distance"`
+	Retired  bool    `json:"retired"`
+}
+
+type Activity struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	SportType   string     `json:"sport_type"`
+	GearID      string     `json:"gear_id"`
+	Description string     `json:"description"`
+	StartDate   time.Time  `json:"start_date"`
+	Athlete     AthleteRef `json:"athlete"`
+}
+
+type AthleteRef struct {
+	ID int64 `json:"id"`
+}
+
+type Subscription struct {
+	ID          int64     `json:"id"`
+	CallbackURL string    `json:"callback_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Tokens is an issued OAuth token pair
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+	Scopes       []string
+}
+
+// Request is a request received by the fake
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Form   url.Values
+}
+
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	// VerifyCallbacks makes subscription requests call the callback URL with a challenge, as Strava does
+	VerifyCallbacks bool
+
+	mu            sync.Mutex
+	athlete       Athlete
+	activities    map[int64]*Activity
+	authCodes     map[string][]string
+	accessTokens  map[string]*Tokens
+	refreshTokens map[string]*Tokens
+	subscriptions []Subscription
+	nextSubID     int64
+	failures      []int
+	requests      []Request
+}
+
+// NewServer starts a fake for the athlete. Call Close when finished
+func NewServer(athlete Athlete) *Server {
+	s := &Server{
+		ClientID:      DefaultClientID,
+		ClientSecret:  DefaultClientSecret,
+		athlete:       athlete,
+		activities:    make(map[int64]*Activity),
+		authCodes:     make(map[string][]string),
+		accessTokens:  make(map[string]*Tokens),
+		refreshTokens: make(map[string]*Tokens),
+		nextSubID:     1,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/token", s.handleToken)
+	mux.HandleFunc("POST /api/v3/oauth/token", s.handleToken)
+	mux.HandleFunc("GET /api/v3/athlete", s.authorized(s.handleGetAthlete))
+	mux.HandleFunc("GET /api/v3/athlete/activities", s.authorized(s.handleListActivities))
+	mux.HandleFunc("GET /api/v3/activities/{id}", s.authorized(s.handleGetActivity))
+	mux.HandleFunc("PUT /api/v3/activities/{id}", s.authorized(s.handleUpdateActivity))
+	mux.HandleFunc("GET /api/v3/activities/{id}/streams", s.authorized(s.handleGetStreams))
+	mux.HandleFunc("GET /api/v3/gear/{id}", s.authorized(s.handleGetGear))
+	mux.HandleFunc("POST /api/v3/push_subscriptions", s.appAuthorized(s.handleCreateSubscription))
+	mux.HandleFunc("GET /api/v3/push_subscriptions", s.appAuthorized(s.handleListSubscriptions))
+	mux.HandleFunc("DELETE /api/v3/push_subscriptions/{id}", s.appAuthorized(s.handleDeleteSubscription))
+
+	s.Server = httptest.NewServer(s.record(mux))
+	return s
+}
+
+// Client returns an HTTP client which sends requests for any host to the fake
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.URL)
+	return &http.Client{Transport: &redirectTransport{target: target, next: s.Server.Client().Transport}}
+}
+
+type redirectTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = t.target.Host
+	return t.next.RoundTrip(req)
+}
+
+// AddAuthCode accepts code in an authorization code exchange. The scopes are recorded on the issued tokens
+func (s *Server) AddAuthCode(code string, scopes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authCodes[code] = scopes
+}
+
+// IssueTokens returns valid tokens without an authorization code exchange
+func (s *Server) IssueTokens(scopes ...string) Tokens {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.issueTokens(scopes)
+}
+
+// ExpireTokens makes every issued access token invalid, so that clients must refresh
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.accessTokens)
+}
+
+// AddActivity adds or replaces an activity of the athlete
+func (s *Server) AddActivity(activity Activity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity.Athlete.ID = s.athlete.ID
+	s.activities[activity.ID] = &activity
+}
+
+// Activity returns the current state of an activity
+func (s *Server) Activity(id int64) (Activity, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity, found := s.activities[id]
+	if !found {
+		return Activity{}, false
+	}
+	return *activity, true
+}
+
+func (s *Server) Subscriptions() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.subscriptions)
+}
+
+// AddSubscription adds a push subscription for the app without verifying the callback URL
+func (s *Server) AddSubscription(callbackURL string) Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	subscription := Subscription{ID: s.nextSubID, CallbackURL: callbackURL, CreatedAt: now, UpdatedAt: now}
+	s.nextSubID++
+	s.subscriptions = append(s.subscriptions, subscription)
+	return subscription
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// RateLimitNext makes the next n requests fail with HTTP 429
+func (s *Server) RateLimitNext(n int) {
+	s.failNext(http.StatusTooManyRequests, n)
+}
+
+// UnauthorizedNext makes the next n requests fail with HTTP 401
+func (s *Server) UnauthorizedNext(n int) {
+	s.failNext(http.StatusUnauthorized, n)
+}
+
+func (s *Server) failNext(status int, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for range n {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// record logs each request and returns any injected failure
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Form: r.PostForm})
+		var status int
+		if len(s.failures) > 0 {
+			status = s.failures[0]
+			s.failures = s.failures[1:]
+		}
+		s.mu.Unlock()
+
+		switch status {
+		case 0:
+			next.ServeHTTP(w, r)
+		case http.StatusTooManyRequests:
+			w.Header().Set("X-RateLimit-Limit", "200,2000")
+			w.Header().Set("X-RateLimit-Usage", "201,250")
+			writeFault(w, status, "Rate Limit Exceeded")
+		default:
+			writeFault(w, status, "Authorization Error")
+		}
+	})
+}
+
+// authorized checks the bearer token of athlete API requests
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		tokens, valid := s.accessTokens[token]
+		s.mu.Unlock()
+		if !found || !valid || time.Now().Unix() > tokens.ExpiresAt {
+			writeFault(w, http.StatusUnauthorized, "Authorization Error")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// appAuthorized checks the client ID and secret of push subscription requests
+func (s *Server) appAuthorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != s.ClientID || r.FormValue("client_secret") != s.ClientSecret {
+			writeFault(w, http.StatusUnauthorized, "Authorization Error")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("client_id") != s.ClientID || r.FormValue("client_secret") != s.ClientSecret {
+		writeFault(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.FormValue("grant_type") {
+	case "authorization_code":
+		scopes, found := s.authCodes[r.FormValue("code")]
+		if !found {
+			writeFault(w, http.StatusBadRequest, "Bad Request")
+			return
+		}
+		delete(s.authCodes, r.FormValue("code"))
+		tokens := s.issueTokens(scopes)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"token_type":    "Bearer",
+			"access_token":  tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"expires_at":    tokens.ExpiresAt,
+			"expires_in":    int(tokenLifetime.Seconds()),
+			"athlete":       s.athlete,
+		})
+	case "refresh_token":
+		previous, found := s.refreshTokens[r.FormValue("refresh_token")]
+		if !found {
+			writeFault(w, http.StatusBadRequest, "Bad Request")
+			return
+		}
+		delete(s.refreshTokens, previous.RefreshToken)
+		delete(s.accessTokens, previous.AccessToken)
+		tokens := s.issueTokens(previous.Scopes)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"token_type":    "Bearer",
+			"access_token":  tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"expires_at":    tokens.ExpiresAt,
+			"expires_in":    int(tokenLifetime.Seconds()),
+		})
+	default:
+		writeFault(w, http.StatusBadRequest, "Bad Request")
+	}
+}
+
+func (s *Server) issueTokens(scopes []string) *Tokens {
+	tokens := &Tokens{
+		AccessToken:  rand.Text(),
+		RefreshToken: rand.Text(),
+		ExpiresAt:    time.Now().Add(tokenLifetime).Unix(),
+		Scopes:       scopes,
+	}
+	s.accessTokens[tokens.AccessToken] = tokens
+	s.refreshTokens[tokens.RefreshToken] = tokens
+	return tokens
+}
+
+// handleGetAthlete returns the athlete. As on Strava, the gear is only included if the token has the profile:read_all
+// scope
+func (s *Server) handleGetAthlete(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	athlete := s.athlete
+	if !slices.Contains(s.accessTokens[token].Scopes, "profile:read_all") {
+		athlete.Bikes = nil
+		athlete.Shoes = nil
+	}
+	writeJSON(w, http.StatusOK, athlete)
+}
+
+// handleListActivities returns the athlete's activities, newest first
+func (s *Server) handleListActivities(w http.ResponseWriter, r *http.Request) {
+	page, err := intParam(r, "page", 1)
+	if err != nil || page < 1 {
+		writeFault(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+	perPage, err := intParam(r, "per_page", defaultPerPage)
+	if err != nil || perPage < 1 {
+		writeFault(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+	after, err := intParam(r, "after", 0)
+	if err != nil {
+		writeFault(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+	before, err := intParam(r, "before", 0)
+	if err != nil {
+		writeFault(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	activities := []Activity{}
+	for _, activity := range s.activities {
+		start := activity.StartDate.Unix()
+		if (after == 0 || start > int64(after)) && (before == 0 || start < int64(before)) {
+			activities = append(activities, *activity)
+		}
+	}
+	slices.SortFunc(activities, func(a, b Activity) int {
+		return cmp.Or(b.StartDate.Compare(a.StartDate), cmp.Compare(b.ID, a.ID))
+	})
+
+	from := min((page-1)*perPage, len(activities))
+	to := min(from+perPage, len(activities))
+	writeJSON(w, http.StatusOK, activities[from:to])
+}
+
+func (s *Server) handleGetActivity(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	activity, found := s.activityFromPath(r)
+	if !found {
+		writeFault(w, http.StatusNotFound, "Record Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, activity)
+}
+
+// handleUpdateActivity accepts JSON or form bodies
+func (s *Server) handleUpdateActivity(w http.ResponseWriter, r *http.Request) {
+	update := map[string]string{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		err := json.NewDecoder(r.Body).Decode(&update)
+		if err != nil {
+			writeFault(w, http.StatusBadRequest, "Bad Request")
+			return
+		}
+	} else {
+		for key := range r.PostForm {
+			update[key] = r.PostForm.Get(key)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	activity, found := s.activityFromPath(r)
+	if !found {
+		writeFault(w, http.StatusNotFound, "Record Not Found")
+		return
+	}
+	if gearID, ok := update["gear_id"]; ok {
+		if gearID == "none" {
+			gearID = ""
+		}
+		activity.GearID = gearID
+	}
+	if description, ok := update["description"]; ok {
+		activity.Description = description
+	}
+	if name, ok := update["name"]; ok {
+		activity.Name = name
+	}
+	writeJSON(w, http.StatusOK, activity)
+}
+
+// handleGetStreams returns no GPS data, like an activity recorded without a GPS device
+func (s *Server) handleGetStreams(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.activityFromPath(r); !found {
+		writeFault(w, http.StatusNotFound, "Record Not Found")
+		return
+	}
+	writeFault(w, http.StatusNotFound, "Record Not Found")
+}
+
+func (s *Server) handleGetGear(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, gear := range slices.Concat(s.athlete.Bikes, s.athlete.Shoes) {
+		if gear.ID == r.PathValue("id") {
+			writeJSON(w, http.StatusOK, gear)
+			return
+		}
+	}
+	writeFault(w, http.StatusNotFound, "Record Not Found")
+}
+
+// handleCreateSubscription allows one subscription, as Strava does for each app
+func (s *Server) handleCreateSubscription(w http.ResponseWriter, r *http.Request) {
+	callbackURL := r.FormValue("callback_url")
+	s.mu.Lock()
+	exists := len(s.subscriptions) > 0
+	s.mu.Unlock()
+	if exists {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"message": "Bad Request",
+			"errors":  []map[string]string{{"resource": "PushSubscription", "field": "", "code": "already exists"}},
+		})
+		return
+	}
+
+	if s.VerifyCallbacks {
+		err := verifyCallback(callbackURL, r.FormValue("verify_token"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"message": "Bad Request",
+				"errors":  []map[string]string{{"resource": "PushSubscription", "field": "callback url", "code": err.Error()}},
+			})
+			return
+		}
+	}
+
+	subscription := s.AddSubscription(callbackURL)
+	writeJSON(w, http.StatusCreated, map[string]int64{"id": subscription.ID})
+}
+
+func verifyCallback(callbackURL string, verifyToken string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return fmt.Errorf("invalid")
+	}
+	challenge := rand.Text()
+	query := u.Query()
+	query.Set("hub.mode", "subscribe")
+	query.Set("hub.challenge", challenge)
+	query.Set("hub.verify_token", verifyToken)
+	u.RawQuery = query.Encode()
+
+	res, err := http.Get(u.String())
+	if err != nil {
+		return fmt.Errorf("GET to callback URL does not return 200")
+	}
+	defer res.Body.Close()
+
+	var body map[string]string
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if res.StatusCode != http.StatusOK || err != nil || body["hub.challenge"] != challenge {
+		return fmt.Errorf("GET to callback URL does not return 200")
+	}
+	return nil
+}
+
+func (s *Server) handleListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, append([]Subscription{}, s.subscriptions...))
+}
+
+func (s *Server) handleDeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeFault(w, http.StatusNotFound, "Record Not Found")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.subscriptions, func(sub Subscription) bool { return sub.ID == id })
+	if i < 0 {
+		writeFault(w, http.StatusNotFound, "Record Not Found")
+		return
+	}
+	s.subscriptions = slices.Delete(s.subscriptions, i, i+1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) activityFromPath(r *http.Request) (*Activity, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	activity, found := s.activities[id]
+	return activity, found
+}
+
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func writeFault(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{"message": message, "errors": []any{}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
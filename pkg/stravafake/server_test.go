@@ -0,0 +1,314 @@
+package stravafake
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStore struct {
+	tokens *stravaapi.Tokens
+}
+
+func (s *testStore) GetTokens(ctx context.Context) (*stravaapi.Tokens, error) {
+	return s.tokens, nil
+}
+
+func (s *testStore) PutTokens(ctx context.Context, tokens *stravaapi.Tokens) error {
+	s.tokens = tokens
+	return nil
+}
+
+func (s *testStore) GetAppCredentials(ctx context.Context) (*stravaapi.AppCredentials, error) {
+	return &stravaapi.AppCredentials{ClientID: DefaultClientID, ClientSecret: DefaultClientSecret}, nil
+}
+
+var testAthlete = Athlete{
+	ID:        1001,
+	Firstname: "Hamish",
+	Bikes:     []Gear{{ID: "b100", Name: "Gravel bike"}},
+	Shoes:     []Gear{{ID: "g200", Name: "Trail shoes", Primary: true}},
+}
+
+func newTestClient(t *testing.T) (*Server, stravaapi.Client, *testStore) {
+	server := NewServer(testAthlete)
+	t.Cleanup(server.Close)
+
+	tokens := server.IssueTokens("activity:read_all")
+	store := &testStore{tokens: &stravaapi.Tokens{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken}}
+	return server, stravaapi.NewClient(server.Client(), store, store), store
+}
+
+func postForm(t *testing.T, server *Server, path string, form url.Values) (*http.Response, map[string]any) {
+	res, err := server.Client().PostForm("https://www.strava.com"+path, form)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	var body map[string]any
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	return res, body
+}
+
+func TestServer_tokenExchange(t *testing.T) {
+	server := NewServer(testAthlete)
+	defer server.Close()
+	server.AddAuthCode("code1", "read", "activity:read_all")
+
+	form := url.Values{
+		"client_id":     {DefaultClientID},
+		"client_secret": {DefaultClientSecret},
+		"grant_type":    {"authorization_code"},
+		"code":          {"code1"},
+	}
+	res, body := postForm(t, server, "/oauth/token", form)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.NotEmpty(t, body["access_token"])
+	assert.NotEmpty(t, body["refresh_token"])
+	assert.Equal(t, float64(testAthlete.ID), body["athlete"].(map[string]any)["id"])
+
+	res, _ = postForm(t, server, "/oauth/token", form)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "codes can only be exchanged once")
+
+	form.Set("code", "unknown")
+	res, _ = postForm(t, server, "/oauth/token", form)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", body["refresh_token"].(string))
+	form.Set("client_secret", "wrong")
+	res, _ = postForm(t, server, "/oauth/token", form)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestServer_activityPaging(t *testing.T) {
+	ctx := context.Background()
+	server, client, _ := newTestClient(t)
+
+	start := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		server.AddActivity(Activity{ID: int64(i + 1), SportType: "Run", StartDate: start.AddDate(0, 0, i)})
+	}
+
+	testcases := []struct {
+		name  string
+		query stravaapi.ActivitiesQuery
+		exp   []int64
+	}{
+		{
+			name:  "first page",
+			query: stravaapi.ActivitiesQuery{Page: 1, PerPage: 2},
+			exp:   []int64{5, 4},
+		},
+		{
+			name:  "last page",
+			query: stravaapi.ActivitiesQuery{Page: 3, PerPage: 2},
+			exp:   []int64{1},
+		},
+		{
+			name:  "past the last page",
+			query: stravaapi.ActivitiesQuery{Page: 4, PerPage: 2},
+			exp:   []int64{},
+		},
+		{
+			name:  "date range",
+			query: stravaapi.ActivitiesQuery{After: start, Before: start.AddDate(0, 0, 3)},
+			exp:   []int64{3, 2},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			activities, err := client.GetActivities(ctx, tc.query)
+			require.NoError(t, err)
+
+			ids := []int64{}
+			for _, a := range activities {
+				ids = append(ids, a.ID)
+			}
+			assert.Equal(t, tc.exp, ids)
+		})
+	}
+}
+
+func TestServer_updateActivity(t *testing.T) {
+	ctx := context.Background()
+	server, client, _ := newTestClient(t)
+	server.AddActivity(Activity{ID: 42, SportType: "Run", GearID: "g1"})
+
+	gearID := "g200"
+	description := "Morning run"
+	err := client.UpdateActivity(ctx, 42, stravaapi.ActivityUpdate{GearID: &gearID, Description: &description})
+	require.NoError(t, err)
+
+	activity, found := server.Activity(42)
+	require.True(t, found)
+	assert.Equal(t, "g200", activity.GearID)
+	assert.Equal(t, "Morning run", activity.Description)
+
+	err = client.UpdateActivity(ctx, 43, stravaapi.ActivityUpdate{GearID: &gearID})
+	assert.ErrorIs(t, err, stravaapi.ErrNotFound)
+}
+
+func TestServer_refreshesExpiredTokens(t *testing.T) {
+	ctx := context.Background()
+	server, client, store := newTestClient(t)
+	server.AddActivity(Activity{ID: 42, SportType: "Run"})
+	previous := *store.tokens
+
+	server.ExpireTokens()
+	activity, err := client.GetActivity(ctx, 42)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), activity.ID)
+	assert.NotEqual(t, previous.AccessToken, store.tokens.AccessToken)
+	assert.NotEqual(t, previous.RefreshToken, store.tokens.RefreshToken)
+}
+
+func TestServer_injectedFailures(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rate limit", func(t *testing.T) {
+		server, client, _ := newTestClient(t)
+		server.AddActivity(Activity{ID: 42, SportType: "Run"})
+		server.RateLimitNext(1)
+
+		_, err := client.GetActivity(ctx, 42)
+		assert.ErrorContains(t, err, "HTTP 429")
+
+		_, err = client.GetActivity(ctx, 42)
+		assert.NoError(t, err)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		server, client, _ := newTestClient(t)
+		server.AddActivity(Activity{ID: 42, SportType: "Run"})
+		server.UnauthorizedNext(1)
+
+		_, err := client.GetActivity(ctx, 42)
+		require.NoError(t, err)
+
+		var paths []string
+		for _, r := range server.Requests() {
+			paths = append(paths, r.Method+" "+r.Path)
+		}
+		assert.Equal(t, []string{"GET /api/v3/activities/42", "POST /oauth/token", "GET /api/v3/activities/42"}, paths)
+	})
+}
+
+func TestServer_gear(t *testing.T) {
+	server, _, _ := newTestClient(t)
+	tokens := server.IssueTokens("read")
+
+	req, err := http.NewRequest(http.MethodGet, "https://www.strava.com/api/v3/gear/b100", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	res, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	var gear Gear
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&gear))
+	assert.Equal(t, "Gravel bike", gear.Name)
+
+	res, err = server.Client().Get("https://www.strava.com/api/v3/athlete")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestServer_athleteGear(t *testing.T) {
+	testcases := []struct {
+		name     string
+		scopes   []string
+		expBikes int
+	}{
+		{name: "profile:read_all", scopes: []string{"read", "profile:read_all"}, expBikes: 1},
+		{name: "read", scopes: []string{"read"}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, _, _ := newTestClient(t)
+			tokens := server.IssueTokens(tc.scopes...)
+
+			req, err := http.NewRequest(http.MethodGet, "https://www.strava.com/api/v3/athlete", nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+			res, err := server.Client().Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			var athlete Athlete
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&athlete))
+			assert.Len(t, athlete.Bikes, tc.expBikes)
+		})
+	}
+}
+
+func TestServer_subscriptions(t *testing.T) {
+	ctx := context.Background()
+	server, client, _ := newTestClient(t)
+
+	form := url.Values{
+		"client_id":     {DefaultClientID},
+		"client_secret": {DefaultClientSecret},
+		"callback_url":  {"https://example.com/event"},
+		"verify_token":  {"verify"},
+	}
+	res, body := postForm(t, server, "/api/v3/push_subscriptions", form)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, float64(1), body["id"])
+
+	res, _ = postForm(t, server, "/api/v3/push_subscriptions", form)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "only one subscription is allowed")
+
+	subscriptions, err := client.ListSubscriptions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []stravaapi.Subscription{{ID: 1, CallbackURL: "https://example.com/event"}}, subscriptions)
+
+	values := url.Values{"client_id": {DefaultClientID}, "client_secret": {DefaultClientSecret}}
+	req, err := http.NewRequest(http.MethodDelete, "https://www.strava.com/api/v3/push_subscriptions/1?"+values.Encode(), nil)
+	require.NoError(t, err)
+	res, err = server.Client().Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Empty(t, server.Subscriptions())
+}
+
+func TestServer_verifyCallbacks(t *testing.T) {
+	server := NewServer(testAthlete)
+	defer server.Close()
+	server.VerifyCallbacks = true
+
+	callback := http.NewServeMux()
+	callback.HandleFunc("GET /event", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("hub.verify_token") != "verify" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"hub.challenge": r.URL.Query().Get("hub.challenge")})
+	})
+	callbackServer := httptest.NewServer(callback)
+	defer callbackServer.Close()
+
+	form := url.Values{
+		"client_id":     {DefaultClientID},
+		"client_secret": {DefaultClientSecret},
+		"callback_url":  {callbackServer.URL + "/event"},
+		"verify_token":  {"wrong"},
+	}
+	res, _ := postForm(t, server, "/api/v3/push_subscriptions", form)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	form.Set("verify_token", "verify")
+	res, _ = postForm(t, server, "/api/v3/push_subscriptions", form)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+}
@@ -0,0 +1,108 @@
+// Package webhook models the events which Strava posts to the push subscription callback URL
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	ObjectTypeActivity = "activity"
+	ObjectTypeAthlete  = "athlete"
+
+	AspectTypeCreate = "create"
+	AspectTypeUpdate = "update"
+	AspectTypeDelete = "delete"
+)
+
+// EventBridge source and detail types used when publishing webhook events
+const (
+	Source = "io.ockenden.strava"
+
+	DetailTypeActivityCreated     = "StravaActivityCreated"
+	DetailTypeActivityUpdated     = "StravaActivityUpdated"
+	DetailTypeActivityDeleted     = "StravaActivityDeleted"
+	DetailTypeAthleteUpdated      = "StravaAthleteUpdated"
+	DetailTypeAthleteDeauthorized = "StravaAthleteDeauthorized"
+)
+
+// Event is a Strava webhook event. See https://developers.strava.com/docs/webhooks/
+type Event struct {
+	ObjectType     string            `json:"object_type"`
+	ObjectID       int64             `json:"object_id"`
+	AspectType     string            `json:"aspect_type"`
+	Updates        map[string]string `json:"updates,omitempty"`
+	OwnerID        int64             `json:"owner_id"`
+	SubscriptionID int64             `json:"subscription_id"`
+	EventTime      int64             `json:"event_time"`
+}
+
+// Parse decodes and validates a webhook event
+func Parse(b []byte) (*Event, error) {
+	var event Event
+	err := json.Unmarshal(b, &event)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook event: %w", err)
+	}
+	err = event.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (e Event) Validate() error {
+	var errs []error
+	if e.ObjectType != ObjectTypeActivity && e.ObjectType != ObjectTypeAthlete {
+		errs = append(errs, fmt.Errorf("invalid object_type '%s'", e.ObjectType))
+	}
+	if e.AspectType != AspectTypeCreate && e.AspectType != AspectTypeUpdate && e.AspectType != AspectTypeDelete {
+		errs = append(errs, fmt.Errorf("invalid aspect_type '%s'", e.AspectType))
+	}
+	if e.ObjectID < 1 {
+		errs = append(errs, errors.New("object_id not set"))
+	}
+	if e.OwnerID < 1 {
+		errs = append(errs, errors.New("owner_id not set"))
+	}
+	if e.SubscriptionID < 1 {
+		errs = append(errs, errors.New("subscription_id not set"))
+	}
+	if e.EventTime < 1 {
+		errs = append(errs, errors.New("event_time not set"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid webhook event: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Key identifies the event so that retried deliveries of the same event can be detected
+func (e Event) Key() string {
+	return fmt.Sprintf("%s/%d/%s/%d", e.ObjectType, e.ObjectID, e.AspectType, e.EventTime)
+}
+
+// IsDeauthorization returns true if the athlete revoked access for the app
+func (e Event) IsDeauthorization() bool {
+	return e.ObjectType == ObjectTypeAthlete && e.Updates["authorized"] == "false"
+}
+
+// DetailType returns the EventBridge detail type for the event so that rules can route each kind of event
+func (e Event) DetailType() string {
+	if e.ObjectType == ObjectTypeAthlete {
+		if e.IsDeauthorization() {
+			return DetailTypeAthleteDeauthorized
+		}
+		return DetailTypeAthleteUpdated
+	}
+
+	switch e.AspectType {
+	case AspectTypeCreate:
+		return DetailTypeActivityCreated
+	case AspectTypeDelete:
+		return DetailTypeActivityDeleted
+	default:
+		return DetailTypeActivityUpdated
+	}
+}
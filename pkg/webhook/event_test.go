@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Parse(t *testing.T) {
+	testcases := []struct {
+		name          string
+		body          string
+		expErr        bool
+		expDetailType string
+	}{
+		{
+			name:          "activity created",
+			body:          `{"aspect_type": "create", "event_time": 1516126040, "object_id": 1360128428, "object_type": "activity", "owner_id": 134815, "subscription_id": 120475, "updates": {}}`,
+			expDetailType: DetailTypeActivityCreated,
+		},
+		{
+			name:          "activity updated",
+			body:          `{"aspect_type": "update", "event_time": 1516126040, "object_id": 1360128428, "object_type": "activity", "owner_id": 134815, "subscription_id": 120475, "updates": {"title": "Messy"}}`,
+			expDetailType: DetailTypeActivityUpdated,
+		},
+		{
+			name:          "activity deleted",
+			body:          `{"aspect_type": "delete", "event_time": 1516126040, "object_id": 1360128428, "object_type": "activity", "owner_id": 134815, "subscription_id": 120475}`,
+			expDetailType: DetailTypeActivityDeleted,
+		},
+		{
+			name:          "athlete deauthorized",
+			body:          `{"aspect_type": "update", "event_time": 1516126040, "object_id": 134815, "object_type": "athlete", "owner_id": 134815, "subscription_id": 120475, "updates": {"authorized": "false"}}`,
+			expDetailType: DetailTypeAthleteDeauthorized,
+		},
+		{
+			name:   "not JSON",
+			body:   `hello`,
+			expErr: true,
+		},
+		{
+			name:   "unknown object type",
+			body:   `{"aspect_type": "create", "event_time": 1516126040, "object_id": 1, "object_type": "route", "owner_id": 134815, "subscription_id": 120475}`,
+			expErr: true,
+		},
+		{
+			name:   "missing IDs",
+			body:   `{"aspect_type": "create", "event_time": 1516126040, "object_type": "activity"}`,
+			expErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			event, err := Parse([]byte(tc.body))
+			if tc.expErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expDetailType, event.DetailType())
+		})
+	}
+}
+
+func Test_Key(t *testing.T) {
+	event := Event{ObjectType: ObjectTypeActivity, ObjectID: 1360128428, AspectType: AspectTypeUpdate, EventTime: 1516126040, Updates: map[string]string{"title": "Messy"}}
+	retry := event
+	retry.Updates = map[string]string{"title": "Messy"}
+	assert.Equal(t, "activity/1360128428/update/1516126040", event.Key())
+	assert.Equal(t, event.Key(), retry.Key())
+
+	later := event
+	later.EventTime++
+	assert.NotEqual(t, event.Key(), later.Key())
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/ockendenjo/strava-shoes/pkg/athletes"
+	"github.com/ockendenjo/strava-shoes/pkg/gear"
+)
+
+const usage = `usage: athletes <command> [flags]
+
+commands:
+  list     print the connected athletes
+  options  show or change an athlete's gear rules and notification topic`
+
+// Lists the athletes who have connected their Strava account and sets their check options
+func main() {
+	logger := log.New(os.Stderr, "", 0)
+	if len(os.Args) < 2 {
+		logger.Println(usage)
+		os.Exit(2)
+	}
+
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	var tableName string
+	flags.StringVar(&tableName, "table", "strava-athletes", "athletes DynamoDB table")
+
+	var athleteID int64
+	var rulesFile, topic string
+	switch command {
+	case "list":
+	case "options":
+		flags.Int64Var(&athleteID, "athlete", 0, "Strava athlete ID")
+		flags.StringVar(&rulesFile, "rules", "", "JSON file of gear rules, or default to use the default rules")
+		flags.StringVar(&topic, "topic", "", "SNS topic ARN for notifications, or default to use the default topic")
+	default:
+		logger.Println(usage)
+		os.Exit(2)
+	}
+	_ = flags.Parse(os.Args[2:])
+
+	ctx := context.Background()
+	awsConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+	client := athletes.NewClient(dynamodb.NewFromConfig(awsConfig), tableName)
+
+	if command == "list" {
+		connected, err := client.ListAthletes(ctx)
+		if err != nil {
+			panic(err)
+		}
+		for _, a := range connected {
+			fmt.Printf("%d\t%s\tconnected %s\n", a.ID, a.Name, a.ConnectedAt.Format("2006-01-02"))
+		}
+		return
+	}
+
+	if athleteID == 0 {
+		logger.Println("-athlete must be set")
+		os.Exit(1)
+	}
+	err = updateOptions(ctx, client, athleteID, rulesFile, topic)
+	if err != nil {
+		logger.Println(err)
+		os.Exit(1)
+	}
+}
+
+// updateOptions changes the options which are set, then prints the athlete's options
+func updateOptions(ctx context.Context, client athletes.Client, athleteID int64, rulesFile string, topic string) error {
+	athlete, err := client.GetAthlete(ctx, athleteID)
+	if err != nil {
+		return err
+	}
+
+	if rulesFile != "" || topic != "" {
+		switch rulesFile {
+		case "":
+		case "default":
+			athlete.GearRules = nil
+		default:
+			b, err := os.ReadFile(rulesFile)
+			if err != nil {
+				return err
+			}
+			athlete.GearRules, err = gear.ParseRules(b)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch topic {
+		case "":
+		case "default":
+			athlete.TopicArn = ""
+		default:
+			athlete.TopicArn = topic
+		}
+
+		err = client.PutOptions(ctx, athleteID, athlete.GearRules, athlete.TopicArn)
+		if err != nil {
+			return err
+		}
+	}
+
+	if athlete.GearRules == nil {
+		fmt.Println("Gear rules: default")
+	} else {
+		fmt.Printf("Gear rules: %d sports\n", len(athlete.GearRules))
+	}
+	fmt.Printf("Notification topic: %s\n", athlete.TopicArnOr("default"))
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/ockendenjo/strava-shoes/pkg/bagreport"
+	"github.com/ockendenjo/strava-shoes/pkg/bags"
+	"github.com/ockendenjo/strava-shoes/pkg/hills"
+	"github.com/ockendenjo/strava-shoes/pkg/settings"
+)
+
+const usage = `usage: bagging <command> [flags]
+
+commands:
+  progress  print bagged/total counts for each classification
+  export    write bagged and unbagged summits as GeoJSON or KML
+  settings  show or change the athlete's bagging settings`
+
+// Reports an athlete's hill bagging progress from the bags table
+func main() {
+	logger := log.New(os.Stderr, "", 0)
+	if len(os.Args) < 2 {
+		logger.Println(usage)
+		os.Exit(2)
+	}
+
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	var athleteID int64
+	var tableName, class, datasetBucket, datasetKey string
+	flags.Int64Var(&athleteID, "athlete", 0, "Strava athlete ID")
+	flags.StringVar(&tableName, "table", "strava-bags", "bags DynamoDB table")
+	flags.StringVar(&class, "class", "", "only include hills in this classification")
+	flags.StringVar(&datasetBucket, "dataset-bucket", "", "S3 bucket holding the hills dataset")
+	flags.StringVar(&datasetKey, "dataset-key", "", "S3 key of the hills dataset (defaults to the bundled dataset)")
+
+	var format, out, settingsTable, describe string
+	switch command {
+	case "progress":
+	case "export":
+		flags.StringVar(&format, "format", "geojson", "geojson or kml")
+		flags.StringVar(&out, "out", "", "output file (defaults to stdout)")
+	case "settings":
+		flags.StringVar(&settingsTable, "settings-table", "strava-athlete-settings", "athlete settings DynamoDB table")
+		flags.StringVar(&describe, "describe", "", "on or off to add bagged hills to activity descriptions")
+	default:
+		logger.Println(usage)
+		os.Exit(2)
+	}
+	_ = flags.Parse(os.Args[2:])
+
+	if athleteID == 0 {
+		logger.Println("-athlete must be set")
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	awsConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	if command == "settings" {
+		err = updateSettings(ctx, settings.NewClient(dynamodb.NewFromConfig(awsConfig), settingsTable), athleteID, describe)
+		if err != nil {
+			logger.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	dataset, err := hills.Load(ctx, s3.NewFromConfig(awsConfig), datasetBucket, datasetKey)
+	if err != nil {
+		panic(err)
+	}
+	bagList, err := bags.NewClient(dynamodb.NewFromConfig(awsConfig), tableName).GetBags(ctx, athleteID)
+	if err != nil {
+		panic(err)
+	}
+	report := bagreport.New(dataset, bagList, class)
+
+	if command == "progress" {
+		for _, p := range report.Progress() {
+			fmt.Println(p)
+		}
+		return
+	}
+
+	var b []byte
+	switch format {
+	case "geojson":
+		b, err = report.GeoJSON()
+	case "kml":
+		b, err = report.KML()
+	default:
+		logger.Println("-format must be geojson or kml")
+		os.Exit(1)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	if out == "" {
+		_, err = os.Stdout.Write(b)
+	} else {
+		err = os.WriteFile(out, b, 0o644)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// updateSettings changes the describe setting if it is set, then prints the athlete's settings
+func updateSettings(ctx context.Context, client settings.Client, athleteID int64, describe string) error {
+	athleteSettings, err := client.GetSettings(ctx, athleteID)
+	if err != nil {
+		return err
+	}
+
+	switch describe {
+	case "":
+	case "on", "off":
+		athleteSettings.DescribeBags = describe == "on"
+		err = client.PutSettings(ctx, *athleteSettings)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("-describe must be on or off")
+	}
+
+	fmt.Printf("Describe bagged hills: %t\n", athleteSettings.DescribeBags)
+	return nil
+}
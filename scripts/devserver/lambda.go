@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+)
+
+// localLambda is a lambda binary running in the local mode of github.com/ockendenjo/handler, which accepts events with
+// POST /endpoint on LAMBDA_DEBUG_PORT
+type localLambda struct {
+	name     string
+	endpoint string
+}
+
+// startLambda builds ./cmd/<name> and runs it with the environment variables
+func startLambda(ctx context.Context, name string, buildDir string, env map[string]string) (*localLambda, error) {
+	binary := filepath.Join(buildDir, name)
+	build := exec.CommandContext(ctx, "go", "build", "-o", binary, "./cmd/"+name)
+	build.Stdout = os.Stdout
+	build.Stderr = os.Stderr
+	err := build.Run()
+	if err != nil {
+		return nil, fmt.Errorf("error building %s: %w", name, err)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, binary)
+	cmd.Env = append(lambdaEnviron(), "LAMBDA_DEBUG_PORT="+port)
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdout = &prefixWriter{prefix: name + ": ", w: os.Stdout}
+	cmd.Stderr = &prefixWriter{prefix: name + ": ", w: os.Stderr}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("error starting %s: %w", name, err)
+	}
+
+	l := &localLambda{name: name, endpoint: fmt.Sprintf("http://localhost:%s/endpoint", port)}
+	return l, l.waitReady(ctx, fmt.Sprintf("http://localhost:%s/", port))
+}
+
+// lambdaEnviron removes the variables which would make the handler library run as a deployed lambda or ask for a
+// function name
+func lambdaEnviron() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		switch key {
+		case "LAMBDA_TASK_ROOT", "LAMBDA_FUNCTION_NAME", "LAMBDA_DEBUG_PORT":
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+func (l *localLambda) waitReady(ctx context.Context, url string) error {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		res, err := http.Get(url)
+		if err == nil {
+			_ = res.Body.Close()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return fmt.Errorf("%s did not start", l.name)
+}
+
+// invoke sends an event to the lambda and returns the JSON response
+func (l *localLambda) invoke(ctx context.Context, event any) ([]byte, error) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned an error: %s", l.name, body)
+	}
+	return body, nil
+}
+
+// route serves an API Gateway route by invoking the lambda with a payload format 2.0 event
+func (l *localLambda) route(routeKey string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		event, err := toAPIGatewayRequest(r, routeKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		b, err := l.invoke(r.Context(), event)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		err = writeAPIGatewayResponse(w, b)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// toAPIGatewayRequest converts a request into the event which API Gateway sends to a lambda integration
+func toAPIGatewayRequest(r *http.Request, routeKey string) (*events.APIGatewayV2HTTPRequest, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string)
+	for name, values := range r.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	var query map[string]string
+	if len(r.URL.Query()) > 0 {
+		query = make(map[string]string)
+		for name, values := range r.URL.Query() {
+			query[name] = strings.Join(values, ",")
+		}
+	}
+	var cookies []string
+	for _, cookie := range r.Cookies() {
+		cookies = append(cookies, cookie.String())
+	}
+	var pathParams map[string]string
+	for _, name := range routePathParams(routeKey) {
+		if pathParams == nil {
+			pathParams = make(map[string]string)
+		}
+		pathParams[name] = r.PathValue(name)
+	}
+	sourceIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+
+	event := &events.APIGatewayV2HTTPRequest{
+		Version:               "2.0",
+		RouteKey:              routeKey,
+		RawPath:               r.URL.Path,
+		RawQueryString:        r.URL.RawQuery,
+		Cookies:               cookies,
+		Headers:               headers,
+		QueryStringParameters: query,
+		PathParameters:        pathParams,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RouteKey:   routeKey,
+			Stage:      "$default",
+			RequestID:  uuid.NewString(),
+			DomainName: r.Host,
+			TimeEpoch:  time.Now().UnixMilli(),
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Protocol:  r.Proto,
+				SourceIP:  sourceIP,
+				UserAgent: r.UserAgent(),
+			},
+		},
+	}
+	if utf8.Valid(body) {
+		event.Body = string(body)
+	} else {
+		event.Body = base64.StdEncoding.EncodeToString(body)
+		event.IsBase64Encoded = true
+	}
+	return event, nil
+}
+
+// routePathParams returns the names of the path parameters in a route key, e.g. athleteId for
+// "GET /athletes/{athleteId}". API Gateway and http.ServeMux use the same syntax
+func routePathParams(routeKey string) []string {
+	var names []string
+	for _, segment := range strings.Split(routeKey, "/") {
+		if name, found := strings.CutPrefix(segment, "{"); found {
+			names = append(names, strings.TrimSuffix(name, "}"))
+		}
+	}
+	return names
+}
+
+// apiGatewayResponse holds the fields of both the REST API and HTTP API lambda response types
+type apiGatewayResponse struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders"`
+	Cookies           []string            `json:"cookies"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+func writeAPIGatewayResponse(w http.ResponseWriter, b []byte) error {
+	var res apiGatewayResponse
+	err := json.Unmarshal(b, &res)
+	if err != nil {
+		return fmt.Errorf("invalid lambda response: %w", err)
+	}
+
+	body := []byte(res.Body)
+	if res.IsBase64Encoded {
+		body, err = base64.StdEncoding.DecodeString(res.Body)
+		if err != nil {
+			return fmt.Errorf("invalid lambda response body: %w", err)
+		}
+	}
+
+	for name, values := range res.MultiValueHeaders {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	for name, v := range res.Headers {
+		w.Header().Set(name, v)
+	}
+	for _, cookie := range res.Cookies {
+		w.Header().Add("Set-Cookie", cookie)
+	}
+	if res.StatusCode == 0 {
+		res.StatusCode = http.StatusOK
+	}
+	w.WriteHeader(res.StatusCode)
+	_, err = w.Write(body)
+	return err
+}
+
+func freePort() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	return port, err
+}
+
+// prefixWriter labels each line of a lambda's output with its name
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	lines := strings.SplitAfter(string(b), "\n")
+	var buf strings.Builder
+	for _, line := range lines {
+		if line != "" {
+			buf.WriteString(p.prefix + line)
+		}
+	}
+	_, err := io.WriteString(p.w, buf.String())
+	return len(b), err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_toAPIGatewayRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/event?token=abc&a=1&a=2", strings.NewReader(`{"object_id": 1}`))
+	r.Header.Set("Content-Type", "application/json")
+
+	event, err := toAPIGatewayRequest(r, "POST /event")
+	require.NoError(t, err)
+
+	assert.Equal(t, "2.0", event.Version)
+	assert.Equal(t, "POST /event", event.RouteKey)
+	assert.Equal(t, "/event", event.RawPath)
+	assert.Equal(t, map[string]string{"token": "abc", "a": "1,2"}, event.QueryStringParameters)
+	assert.Equal(t, "application/json", event.Headers["content-type"])
+	assert.Equal(t, http.MethodPost, event.RequestContext.HTTP.Method)
+	assert.Equal(t, `{"object_id": 1}`, event.Body)
+	assert.False(t, event.IsBase64Encoded)
+}
+
+func Test_toAPIGatewayRequest_pathParams(t *testing.T) {
+	mux := http.NewServeMux()
+	var event *events.APIGatewayV2HTTPRequest
+	mux.HandleFunc("GET /athletes/{athleteId}/gear-rules", func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		event, err = toAPIGatewayRequest(r, "GET /athletes/{athleteId}/gear-rules")
+		require.NoError(t, err)
+	})
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/athletes/1001/gear-rules", nil))
+
+	require.NotNil(t, event)
+	assert.Equal(t, map[string]string{"athleteId": "1001"}, event.PathParameters)
+}
+
+func Test_writeAPIGatewayResponse(t *testing.T) {
+	testcases := []struct {
+		name       string
+		response   string
+		expStatus  int
+		expBody    string
+		expHeaders map[string]string
+	}{
+		{
+			name:       "HTTP API response",
+			response:   `{"statusCode": 401, "headers": {"Content-Type": "text/plain"}, "body": "No code"}`,
+			expStatus:  http.StatusUnauthorized,
+			expBody:    "No code",
+			expHeaders: map[string]string{"Content-Type": "text/plain"},
+		},
+		{
+			name:      "base64 body",
+			response:  `{"statusCode": 200, "body": "aGVsbG8=", "isBase64Encoded": true}`,
+			expStatus: http.StatusOK,
+			expBody:   "hello",
+		},
+		{
+			name:       "REST API response with multi value headers",
+			response:   `{"statusCode": 200, "multiValueHeaders": {"X-Test": ["a", "b"]}, "body": "{}"}`,
+			expStatus:  http.StatusOK,
+			expBody:    "{}",
+			expHeaders: map[string]string{"X-Test": "a"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			err := writeAPIGatewayResponse(w, []byte(tc.response))
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expStatus, w.Code)
+			assert.Equal(t, tc.expBody, w.Body.String())
+			for k, v := range tc.expHeaders {
+				assert.Equal(t, v, w.Header().Get(k))
+			}
+		})
+	}
+}
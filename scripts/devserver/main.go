@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ockendenjo/strava-shoes/pkg/localaws"
+)
+
+const dedupeTable = "strava-webhook-events"
+const athletesTable = "strava-athletes"
+
+// Runs the API Gateway lambdas on their routes in a local HTTP server, with in-memory stand-ins for the AWS services
+func main() {
+	var addr, paramsFile string
+	flag.StringVar(&addr, "addr", "localhost:8080", "address to listen on")
+	flag.StringVar(&paramsFile, "params", "", "JSON file of SSM parameter names and values, e.g. {\"/strava/clientId\": \"123\"}")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "", 0)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	awsServer := localaws.NewServer()
+	awsServer.Log = log.New(os.Stderr, "aws: ", 0)
+	awsServer.CreateTable(dedupeTable, "ID", "")
+	awsServer.CreateTable(athletesTable, "AthleteID", "")
+	if paramsFile != "" {
+		err := loadParams(awsServer, paramsFile)
+		if err != nil {
+			logger.Fatalf("error loading parameters: %v", err)
+		}
+	}
+
+	awsListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	go func() {
+		_ = http.Serve(awsListener, awsServer)
+	}()
+
+	buildDir, err := os.MkdirTemp("", "devserver")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer os.RemoveAll(buildDir)
+
+	awsEnv := map[string]string{
+		"AWS_ENDPOINT_URL":         "http://" + awsListener.Addr().String(),
+		"AWS_REGION":               "eu-west-1",
+		"AWS_ACCESS_KEY_ID":        "local",
+		"AWS_SECRET_ACCESS_KEY":    "local",
+		"AWS_SESSION_TOKEN":        "",
+		"AWS_XRAY_SDK_DISABLED":    "true",
+		"AWS_XRAY_CONTEXT_MISSING": "IGNORE_ERROR",
+	}
+	withEnv := func(env map[string]string) map[string]string {
+		for k, v := range awsEnv {
+			env[k] = v
+		}
+		return env
+	}
+
+	mux := http.NewServeMux()
+	routes := []struct {
+		name      string
+		routeKeys []string
+		env       map[string]string
+	}{
+		{
+			name:      "auth",
+			routeKeys: []string{"GET /auth", "GET /connect"},
+			env: map[string]string{
+				"SCHEDULE_RULE": "strava-gear-check-schedule",
+				"ATHLETES_DB":   athletesTable,
+				"CALLBACK_URL":  "http://" + addr + "/auth",
+				"TOPIC_ARN":     "arn:aws:sns:eu-west-1:000000000000:strava",
+			},
+		},
+		{name: "confirm-sub", routeKeys: []string{"GET /event"}, env: map[string]string{}},
+		{
+			name: "gear-rules",
+			routeKeys: []string{
+				"GET /athletes/{athleteId}/gear-rules",
+				"PUT /athletes/{athleteId}/gear-rules",
+				"POST /athletes/{athleteId}/gear-rules/validate",
+			},
+			env: map[string]string{"ATHLETES_DB": athletesTable, "GEAR_RULES": "{}"},
+		},
+		{name: "receive-event", routeKeys: []string{"POST /event"}, env: map[string]string{"DEAD_LETTER_BUCKET": "local-dead-letter", "DEDUPE_DB": dedupeTable}},
+	}
+	for _, route := range routes {
+		lambda, err := startLambda(ctx, route.name, buildDir, withEnv(route.env))
+		if err != nil {
+			logger.Fatal(err)
+		}
+		for _, routeKey := range route.routeKeys {
+			mux.Handle(routeKey, lambda.route(routeKey))
+			logger.Printf("%s -> %s", routeKey, route.name)
+		}
+	}
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 3 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	logger.Printf("Listening on http://%s", addr)
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatal(err)
+	}
+}
+
+func loadParams(server *localaws.Server, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var params map[string]string
+	err = json.Unmarshal(b, &params)
+	if err != nil {
+		return err
+	}
+	for name, value := range params {
+		server.PutParameter(name, value)
+	}
+	return nil
+}
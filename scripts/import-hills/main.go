@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ockendenjo/strava-shoes/pkg/hills"
+)
+
+// Imports a Database of British and Irish Hills CSV file (https://www.hills-database.co.uk/downloads.html) as a hill dataset
+func main() {
+	var inPath, outPath, version, classFilter string
+	var strict bool
+	flag.StringVar(&inPath, "in", "", "DoBIH CSV file")
+	flag.StringVar(&outPath, "out", "pkg/hills/hills.json", "output dataset file")
+	flag.StringVar(&version, "version", "dobih-"+time.Now().UTC().Format("20060102"), "dataset version")
+	flag.StringVar(&classFilter, "classes", "M,C,G,D,W,Hew,N,Ma", "comma separated classification codes to import, or empty for all hills")
+	flag.BoolVar(&strict, "strict", false, "fail if any rows are invalid or duplicated")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "", 0)
+	if inPath == "" {
+		logger.Println("-in must be set")
+		os.Exit(1)
+	}
+
+	file, err := os.Open(inPath) // #nosec G304 -- Script needs to load file from variable
+	if err != nil {
+		panic(err)
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	var classes []string
+	if classFilter != "" {
+		classes = strings.Split(classFilter, ",")
+	}
+
+	result, err := parseHills(file, classes)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, problem := range result.problems {
+		logger.Println(problem)
+	}
+	if len(result.problems) > 0 {
+		logger.Printf("%d rows skipped\n", len(result.problems))
+		if strict {
+			os.Exit(1)
+		}
+	}
+
+	b, err := json.Marshal(hills.Dataset{Version: version, Hills: result.hills})
+	if err != nil {
+		panic(err)
+	}
+	err = os.WriteFile(outPath, b, 0600)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Wrote %d hills to %s (version %s)\n", len(result.hills), outPath, version)
+}
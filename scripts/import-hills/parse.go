@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ockendenjo/strava-shoes/pkg/hills"
+)
+
+// Column names in the Database of British and Irish Hills CSV
+const (
+	colNumber         = "Number"
+	colName           = "Name"
+	colClassification = "Classification"
+	colMetres         = "Metres"
+	colGridRef        = "Grid ref"
+	colLatitude       = "Latitude"
+	colLongitude      = "Longitude"
+)
+
+var requiredColumns = []string{colNumber, colName, colClassification, colMetres, colGridRef, colLatitude, colLongitude}
+
+// classificationNames maps DoBIH classification codes to the names stored in the dataset
+var classificationNames = map[string]string{
+	"Ma":  "Marilyn",
+	"Hu":  "HuMP",
+	"Tu":  "TuMP",
+	"Sim": "Simm",
+	"M":   "Munro",
+	"MT":  "Munro Top",
+	"F":   "Furth",
+	"C":   "Corbett",
+	"G":   "Graham",
+	"D":   "Donald",
+	"DT":  "Donald Top",
+	"Hew": "Hewitt",
+	"N":   "Nuttall",
+	"W":   "Wainwright",
+	"WO":  "Wainwright Outlying Fell",
+	"B":   "Birkett",
+	"Dew": "Dewey",
+	"E":   "Ethel",
+}
+
+var gridRefPattern = regexp.MustCompile(`^([A-Z]{1,2})(\d{2,10})$`)
+var whitespacePattern = regexp.MustCompile(`\s+`)
+
+type importResult struct {
+	hills    []hills.Hill
+	problems []string
+}
+
+// parseHills reads DoBIH CSV rows. Rows which are invalid or duplicated are reported as problems and skipped.
+// If classes is not empty then only hills with one of those classification codes are kept.
+func parseHills(r io.Reader, classes []string) (*importResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, name := range requiredColumns {
+		if _, found := columns[name]; !found {
+			return nil, fmt.Errorf("missing column '%s'", name)
+		}
+	}
+
+	result := &importResult{}
+	seen := make(map[int]int)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			result.problems = append(result.problems, fmt.Sprintf("line %d: %s", line, err.Error()))
+			continue
+		}
+
+		get := func(name string) string {
+			i := columns[name]
+			if i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		hill, err := parseHill(get)
+		if err != nil {
+			result.problems = append(result.problems, fmt.Sprintf("line %d: %s", line, err.Error()))
+			continue
+		}
+		if prev, found := seen[hill.ID]; found {
+			result.problems = append(result.problems, fmt.Sprintf("line %d: duplicate hill number %d (first seen on line %d)", line, hill.ID, prev))
+			continue
+		}
+		seen[hill.ID] = line
+
+		if !hasClass(get(colClassification), classes) {
+			continue
+		}
+		result.hills = append(result.hills, *hill)
+	}
+	return result, nil
+}
+
+func parseHill(get func(name string) string) (*hills.Hill, error) {
+	id, err := strconv.Atoi(get(colNumber))
+	if err != nil || id < 1 {
+		return nil, fmt.Errorf("invalid hill number '%s'", get(colNumber))
+	}
+
+	name := normaliseName(get(colName))
+	if name == "" {
+		return nil, fmt.Errorf("hill %d has no name", id)
+	}
+
+	gridRef, err := normaliseGridRef(get(colGridRef))
+	if err != nil {
+		return nil, fmt.Errorf("hill %d: %w", id, err)
+	}
+
+	lat, err := strconv.ParseFloat(get(colLatitude), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("hill %d has invalid latitude '%s'", id, get(colLatitude))
+	}
+	lon, err := strconv.ParseFloat(get(colLongitude), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return nil, fmt.Errorf("hill %d has invalid longitude '%s'", id, get(colLongitude))
+	}
+
+	height, err := strconv.ParseFloat(get(colMetres), 64)
+	if err != nil {
+		return nil, fmt.Errorf("hill %d has invalid height '%s'", id, get(colMetres))
+	}
+
+	return &hills.Hill{
+		ID:              id,
+		Name:            name,
+		GridRef:         gridRef,
+		Lat:             round(lat, 5),
+		Lon:             round(lon, 5),
+		Height:          round(height, 1),
+		Classifications: classificationList(get(colClassification)),
+	}, nil
+}
+
+func normaliseName(name string) string {
+	return whitespacePattern.ReplaceAllString(strings.TrimSpace(name), " ")
+}
+
+// normaliseGridRef removes spaces, e.g. "NN 16671 71259" becomes "NN1667171259"
+func normaliseGridRef(gridRef string) (string, error) {
+	normalised := strings.ToUpper(whitespacePattern.ReplaceAllString(gridRef, ""))
+	matches := gridRefPattern.FindStringSubmatch(normalised)
+	if matches == nil || len(matches[2])%2 != 0 {
+		return "", fmt.Errorf("invalid grid reference '%s'", gridRef)
+	}
+	return normalised, nil
+}
+
+func classificationCodes(classification string) []string {
+	var codes []string
+	for code := range strings.SplitSeq(classification, ",") {
+		code = strings.TrimSpace(code)
+		if code != "" {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// classificationList returns the names of the known classifications
+func classificationList(classification string) []string {
+	var names []string
+	for _, code := range classificationCodes(classification) {
+		if name, found := classificationNames[code]; found {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func hasClass(classification string, classes []string) bool {
+	if len(classes) < 1 {
+		return true
+	}
+	for _, code := range classificationCodes(classification) {
+		for _, class := range classes {
+			if code == class {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func round(v float64, places int) float64 {
+	factor := math.Pow10(places)
+	return math.Round(v*factor) / factor
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCSV = `Number,Name,Section,Classification,Metres,Feet,Grid ref,Latitude,Longitude
+1,Ben Nevis,04A,"Ma,Hu,Tu,Sim,M,sMa",1345,4413,NN 16671 71259,56.796849,-5.003603
+2, Ben  Lomond ,01C,"Ma,Hu,Tu,Sim,M",974,3195,nn 36728 02852,56.190181,-4.632812
+3,Arthur's Seat,28B,"Ma,Hu,Tu,Sim",250.5,822,NT 27536 72933,55.944112,-3.161837
+2,Ben Lomond,01C,"Ma,Hu,Tu,Sim,M",974,3195,NN 36728 02852,56.190181,-4.632812
+4,No Grid Ref,01C,"Ma",500,1640,,56.1,-4.1
+5,Bad Latitude,01C,"Ma",500,1640,NN 1 2,north,-4.1
+x,Bad Number,01C,"Ma",500,1640,NN 100 200,56.1,-4.1
+`
+
+func Test_parseHills(t *testing.T) {
+	result, err := parseHills(strings.NewReader(testCSV), nil)
+	require.NoError(t, err)
+
+	require.Len(t, result.hills, 3)
+	assert.Equal(t, "Ben Nevis", result.hills[0].Name)
+	assert.Equal(t, "NN1667171259", result.hills[0].GridRef)
+	assert.Equal(t, 56.79685, result.hills[0].Lat)
+	assert.Equal(t, -5.0036, result.hills[0].Lon)
+	assert.Equal(t, []string{"Marilyn", "HuMP", "TuMP", "Simm", "Munro"}, result.hills[0].Classifications)
+	assert.Equal(t, "Ben Lomond", result.hills[1].Name)
+	assert.Equal(t, "NN3672802852", result.hills[1].GridRef)
+	assert.Equal(t, 250.5, result.hills[2].Height)
+
+	assert.Equal(t, []string{
+		"line 5: duplicate hill number 2 (first seen on line 3)",
+		"line 6: hill 4: invalid grid reference ''",
+		"line 7: hill 5 has invalid latitude 'north'",
+		"line 8: invalid hill number 'x'",
+	}, result.problems)
+}
+
+func Test_parseHills_classFilter(t *testing.T) {
+	result, err := parseHills(strings.NewReader(testCSV), []string{"M"})
+	require.NoError(t, err)
+
+	var names []string
+	for _, h := range result.hills {
+		names = append(names, h.Name)
+	}
+	assert.Equal(t, []string{"Ben Nevis", "Ben Lomond"}, names)
+}
+
+func Test_parseHills_missingColumn(t *testing.T) {
+	_, err := parseHills(strings.NewReader("Number,Name\n1,Ben Nevis\n"), nil)
+	assert.Error(t, err)
+}
+
+func Test_normaliseGridRef(t *testing.T) {
+	testcases := []struct {
+		name    string
+		gridRef string
+		exp     string
+		expErr  bool
+	}{
+		{name: "ten figure", gridRef: "NN 16671 71259", exp: "NN1667171259"},
+		{name: "six figure lower case", gridRef: "nt275729", exp: "NT275729"},
+		{name: "Irish grid", gridRef: "V 8035 8442", exp: "V80358442"},
+		{name: "odd number of digits", gridRef: "NN 1667 71259", expErr: true},
+		{name: "no letters", gridRef: "16671 71259", expErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			gridRef, err := normaliseGridRef(tc.gridRef)
+			if tc.expErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, gridRef)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/ockendenjo/strava-shoes/pkg/deadletter"
+)
+
+// Republishes events which receive-event failed to send to EventBridge
+func main() {
+	var bucket string
+	var dryRun bool
+	flag.StringVar(&bucket, "bucket", os.Getenv("DEAD_LETTER_BUCKET"), "dead letter S3 bucket")
+	flag.BoolVar(&dryRun, "dry-run", false, "list the events without republishing them")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "", 0)
+	if bucket == "" {
+		logger.Println("-bucket or DEAD_LETTER_BUCKET must be set")
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	awsConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	queue := deadletter.NewS3Queue(s3.NewFromConfig(awsConfig), bucket, deadletter.DefaultPrefix)
+	ebClient := eventbridge.NewFromConfig(awsConfig)
+
+	keys, err := queue.List(ctx)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Found %d dead letters\n", len(keys))
+
+	failed := 0
+	for _, key := range keys {
+		err = redrive(ctx, queue, ebClient, key, dryRun)
+		if err != nil {
+			logger.Printf("failed to redrive %s: %s\n", key, err.Error())
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func redrive(ctx context.Context, queue deadletter.Queue, ebClient *eventbridge.Client, key string, dryRun bool) error {
+	entry, err := queue.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s %s %s\n", key, entry.DetailType, entry.Detail)
+	if dryRun {
+		return nil
+	}
+
+	res, err := ebClient.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{{
+			Source:     aws.String(entry.Source),
+			DetailType: aws.String(entry.DetailType),
+			Detail:     aws.String(entry.Detail),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if res.FailedEntryCount > 0 {
+		return fmt.Errorf("EventBridge rejected event: %s", aws.ToString(res.Entries[0].ErrorMessage))
+	}
+
+	return queue.Delete(ctx, key)
+}
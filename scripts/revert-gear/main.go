@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/ockendenjo/strava-shoes/pkg/athletes"
+	"github.com/ockendenjo/strava-shoes/pkg/gearaudit"
+	"github.com/ockendenjo/strava-shoes/pkg/stravaapi"
+)
+
+// Reverts the gear on an activity to the gear it had before the check lambda first changed it
+func main() {
+	var activityID int64
+	var athleteID int64
+	var tableName string
+	var athletesTable string
+	var dryRun bool
+	flag.Int64Var(&activityID, "activity", 0, "Strava activity ID")
+	flag.Int64Var(&athleteID, "athlete", 0, "Strava athlete ID of the activity owner")
+	flag.StringVar(&tableName, "table", "strava-gear-changes", "gear changes DynamoDB table")
+	flag.StringVar(&athletesTable, "athletes-table", "strava-athletes", "athletes DynamoDB table")
+	flag.BoolVar(&dryRun, "dry-run", false, "print the change without making it")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "", 0)
+	if activityID == 0 || athleteID == 0 {
+		logger.Println("-activity and -athlete must be set")
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	awsConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient := dynamodb.NewFromConfig(awsConfig)
+	auditClient := gearaudit.NewClient(dbClient, tableName)
+	changes, err := auditClient.GetChanges(ctx, activityID)
+	if err != nil {
+		panic(err)
+	}
+	if len(changes) < 1 {
+		logger.Printf("No gear changes recorded for activity %d\n", activityID)
+		os.Exit(1)
+	}
+
+	original := changes[0]
+	current := changes[len(changes)-1].NewGearID
+	gearID := original.PreviousGearID
+	if gearID == "" {
+		gearID = stravaapi.GearNone
+	}
+
+	fmt.Printf("Activity %d: changing gear from %s back to %s\n", activityID, current, gearID)
+	if dryRun {
+		return
+	}
+
+	err = auditClient.PutChange(ctx, gearaudit.Change{
+		ActivityID:     activityID,
+		ChangedAt:      time.Now(),
+		PreviousGearID: current,
+		NewGearID:      original.PreviousGearID,
+		Reason:         "revert",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	ssmStore := stravaapi.NewSSMStore(ssm.NewFromConfig(awsConfig))
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	tokenStore := athletes.NewTokenStore(athletes.NewClient(dbClient, athletesTable), athleteID)
+	stravaAPI := stravaapi.NewClient(httpClient, ssmStore, tokenStore)
+	err = stravaAPI.UpdateActivity(ctx, activityID, stravaapi.ActivityUpdate{GearID: &gearID})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("Gear reverted")
+}
@@ -17,8 +17,10 @@ resource "aws_apigatewayv2_integration" "auth" {
 }
 
 resource "aws_apigatewayv2_route" "auth" {
+  for_each = toset(["GET /auth", "GET /connect"])
+
   api_id    = aws_apigatewayv2_api.http_api.id
-  route_key = "GET /auth"
+  route_key = each.value
   target    = "integrations/${aws_apigatewayv2_integration.auth.id}"
 }
 
@@ -15,3 +15,85 @@ resource "aws_dynamodb_table" "bagging_db" {
     enabled        = true
   }
 }
+
+resource "aws_dynamodb_table" "gear_changes_db" {
+  name                        = "strava-gear-changes"
+  billing_mode                = "PAY_PER_REQUEST"
+  hash_key                    = "ActivityID"
+  range_key                   = "ChangedAt"
+  table_class                 = "STANDARD"
+  deletion_protection_enabled = false
+
+  attribute {
+    name = "ActivityID"
+    type = "S"
+  }
+
+  attribute {
+    name = "ChangedAt"
+    type = "S"
+  }
+}
+
+resource "aws_dynamodb_table" "dedupe_db" {
+  name                        = "strava-webhook-events"
+  billing_mode                = "PAY_PER_REQUEST"
+  hash_key                    = "ID"
+  table_class                 = "STANDARD"
+  deletion_protection_enabled = false
+
+  attribute {
+    name = "ID"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "Expiry"
+    enabled        = true
+  }
+}
+
+resource "aws_dynamodb_table" "bags_db" {
+  name                        = "strava-bags"
+  billing_mode                = "PAY_PER_REQUEST"
+  hash_key                    = "AthleteID"
+  range_key                   = "BagID"
+  table_class                 = "STANDARD"
+  deletion_protection_enabled = false
+
+  attribute {
+    name = "AthleteID"
+    type = "S"
+  }
+
+  attribute {
+    name = "BagID"
+    type = "S"
+  }
+}
+
+resource "aws_dynamodb_table" "athletes_db" {
+  name                        = "strava-athletes"
+  billing_mode                = "PAY_PER_REQUEST"
+  hash_key                    = "AthleteID"
+  table_class                 = "STANDARD"
+  deletion_protection_enabled = false
+
+  attribute {
+    name = "AthleteID"
+    type = "S"
+  }
+}
+
+resource "aws_dynamodb_table" "athlete_settings_db" {
+  name                        = "strava-athlete-settings"
+  billing_mode                = "PAY_PER_REQUEST"
+  hash_key                    = "AthleteID"
+  table_class                 = "STANDARD"
+  deletion_protection_enabled = false
+
+  attribute {
+    name = "AthleteID"
+    type = "S"
+  }
+}
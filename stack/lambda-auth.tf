@@ -8,12 +8,53 @@ module "lambda_auth" {
   s3_bucket                = var.lambda_binaries_bucket
   s3_object_key            = local.manifest["auth"]
 
-  environment = {}
+  environment = {
+    SCHEDULE_RULE = aws_cloudwatch_event_rule.gear_check_schedule.name
+    ATHLETES_DB   = aws_dynamodb_table.athletes_db.name
+    CALLBACK_URL  = "${aws_apigatewayv2_stage.default.invoke_url}/auth"
+    TOPIC_ARN     = aws_sns_topic.topic.arn
+  }
+}
+
+module "iam_dynamodb_lambda_auth" {
+  source = "github.com/ockendenjo/tfmods//iam-dynamodb"
+  dynamo_table_arns = [
+    aws_dynamodb_table.athletes_db.arn,
+  ]
+  role_id = module.lambda_auth.role_id
 }
 
 module "iam_ssm_lambda_auth" {
-  source      = "github.com/ockendenjo/tfmods//iam-ssm"
-  role_id     = module.lambda_auth.role_id
-  ssm_arn     = "arn:aws:ssm:${var.aws_region}:${data.aws_caller_identity.current.account_id}:parameter/strava*"
-  allow_write = true
+  source  = "github.com/ockendenjo/tfmods//iam-ssm"
+  role_id = module.lambda_auth.role_id
+  ssm_arn = "arn:aws:ssm:${var.aws_region}:${data.aws_caller_identity.current.account_id}:parameter/strava*"
+}
+
+module "iam_sns_lambda_auth" {
+  source  = "github.com/ockendenjo/tfmods//iam-sns"
+  role_id = module.lambda_auth.role_id
+  sns_arns = [
+    aws_sns_topic.topic.arn,
+  ]
+}
+
+module "iam_eventbridge_lambda_auth" {
+  source  = "github.com/ockendenjo/tfmods//iam-eventbridge"
+  role_id = module.lambda_auth.role_id
+  bus_arns = [
+    "arn:aws:events:${var.aws_region}:${var.aws_account_id}:event-bus/default"
+  ]
+}
+
+resource "aws_iam_role_policy" "auth_schedule" {
+  name = "schedule-rule"
+  role = module.lambda_auth.role_id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["events:EnableRule"]
+      Resource = [aws_cloudwatch_event_rule.gear_check_schedule.arn]
+    }]
+  })
 }
@@ -0,0 +1,81 @@
+module "lambda_bagging_check" {
+  source = "github.com/ockendenjo/tfmods//lambda"
+
+  aws_env                  = var.env
+  name                     = "bagging-check"
+  permissions_boundary_arn = var.permissions_boundary_arn
+  project_name             = "strava"
+  s3_bucket                = var.lambda_binaries_bucket
+  s3_object_key            = local.manifest["bagging-check"]
+
+  environment = {
+    BAGS_DB              = aws_dynamodb_table.bags_db.name
+    ATHLETES_DB          = aws_dynamodb_table.athletes_db.name
+    SETTINGS_DB          = aws_dynamodb_table.athlete_settings_db.name
+    BAGGING_DB           = aws_dynamodb_table.bagging_db.name
+    BAGGING_TTL_DAYS     = var.bagging_ttl_days
+    BAG_RADIUS_METRES    = var.bag_radius_metres
+    HILLS_DATASET_BUCKET = var.lambda_binaries_bucket
+    HILLS_DATASET_KEY    = var.hills_dataset_key
+  }
+}
+
+resource "aws_iam_role_policy" "bagging_check_hills_dataset" {
+  count = var.hills_dataset_key == "" ? 0 : 1
+
+  name = "hills-dataset"
+  role = module.lambda_bagging_check.role_id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["s3:GetObject"]
+      Resource = ["${data.aws_s3_bucket.lambda_binaries.arn}/${var.hills_dataset_key}"]
+    }]
+  })
+}
+
+module "iam_ssm_lambda_bagging_check" {
+  source  = "github.com/ockendenjo/tfmods//iam-ssm"
+  role_id = module.lambda_bagging_check.role_id
+  ssm_arn = "arn:aws:ssm:${var.aws_region}:${data.aws_caller_identity.current.account_id}:parameter/strava*"
+}
+
+module "iam_dynamodb_lambda_bagging_check" {
+  source = "github.com/ockendenjo/tfmods//iam-dynamodb"
+  dynamo_table_arns = [
+    aws_dynamodb_table.bags_db.arn,
+    aws_dynamodb_table.athletes_db.arn,
+    aws_dynamodb_table.athlete_settings_db.arn,
+    aws_dynamodb_table.bagging_db.arn,
+  ]
+  role_id = module.lambda_bagging_check.role_id
+}
+
+resource "aws_cloudwatch_event_rule" "bagging_check" {
+  name        = "strava-bagging-check"
+  description = "Find the hills bagged on a new activity"
+  event_pattern = jsonencode({
+    source      = ["io.ockenden.strava"]
+    detail-type = ["StravaActivityBaggingCheck"]
+  })
+}
+
+resource "aws_cloudwatch_event_target" "bagging_check_lambda" {
+  rule      = aws_cloudwatch_event_rule.bagging_check.name
+  target_id = "BaggingCheckLambda"
+  arn       = module.lambda_bagging_check.arn
+
+  retry_policy {
+    maximum_event_age_in_seconds = 3600
+    maximum_retry_attempts       = 2
+  }
+}
+
+resource "aws_lambda_permission" "bagging_check_eventbridge" {
+  statement_id  = "AllowExecutionFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = module.lambda_bagging_check.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.bagging_check.arn
+}
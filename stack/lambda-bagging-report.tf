@@ -0,0 +1,66 @@
+module "lambda_bagging_report" {
+  source = "github.com/ockendenjo/tfmods//lambda"
+
+  aws_env                  = var.env
+  name                     = "bagging-report"
+  permissions_boundary_arn = var.permissions_boundary_arn
+  project_name             = "strava"
+  s3_bucket                = var.lambda_binaries_bucket
+  s3_object_key            = local.manifest["bagging-report"]
+
+  environment = {
+    BAGS_DB              = aws_dynamodb_table.bags_db.name
+    HILLS_DATASET_BUCKET = var.lambda_binaries_bucket
+    HILLS_DATASET_KEY    = var.hills_dataset_key
+  }
+}
+
+resource "aws_iam_role_policy" "bagging_report_hills_dataset" {
+  count = var.hills_dataset_key == "" ? 0 : 1
+
+  name = "hills-dataset"
+  role = module.lambda_bagging_report.role_id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["s3:GetObject"]
+      Resource = ["${data.aws_s3_bucket.lambda_binaries.arn}/${var.hills_dataset_key}"]
+    }]
+  })
+}
+
+module "iam_ssm_lambda_bagging_report" {
+  source  = "github.com/ockendenjo/tfmods//iam-ssm"
+  role_id = module.lambda_bagging_report.role_id
+  ssm_arn = "arn:aws:ssm:${var.aws_region}:${data.aws_caller_identity.current.account_id}:parameter/strava*"
+}
+
+module "iam_dynamodb_lambda_bagging_report" {
+  source = "github.com/ockendenjo/tfmods//iam-dynamodb"
+  dynamo_table_arns = [
+    aws_dynamodb_table.bags_db.arn,
+  ]
+  role_id = module.lambda_bagging_report.role_id
+}
+
+resource "aws_apigatewayv2_integration" "bagging_report" {
+  api_id                 = aws_apigatewayv2_api.http_api.id
+  integration_type       = "AWS_PROXY"
+  integration_uri        = module.lambda_bagging_report.invoke_arn
+  payload_format_version = "2.0"
+}
+
+resource "aws_apigatewayv2_route" "bagging_report" {
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = "GET /bagging"
+  target    = "integrations/${aws_apigatewayv2_integration.bagging_report.id}"
+}
+
+resource "aws_lambda_permission" "bagging_report" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.lambda_bagging_report.function_name
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "${aws_apigatewayv2_api.http_api.execution_arn}/*/*"
+}
@@ -0,0 +1,67 @@
+module "lambda_check_activity" {
+  source = "github.com/ockendenjo/tfmods//lambda"
+
+  aws_env                  = var.env
+  name                     = "check-activity"
+  permissions_boundary_arn = var.permissions_boundary_arn
+  project_name             = "strava"
+  s3_bucket                = var.lambda_binaries_bucket
+  s3_object_key            = local.manifest["check-activity"]
+
+  environment = {
+    GEAR_RULES  = jsonencode(var.gear_rules)
+    TOPIC_ARN   = aws_sns_topic.topic.arn
+    ATHLETES_DB = aws_dynamodb_table.athletes_db.name
+  }
+}
+
+module "iam_ssm_lambda_check_activity" {
+  source  = "github.com/ockendenjo/tfmods//iam-ssm"
+  role_id = module.lambda_check_activity.role_id
+  ssm_arn = "arn:aws:ssm:${var.aws_region}:${data.aws_caller_identity.current.account_id}:parameter/strava*"
+}
+
+module "iam_dynamodb_lambda_check_activity" {
+  source = "github.com/ockendenjo/tfmods//iam-dynamodb"
+  dynamo_table_arns = [
+    aws_dynamodb_table.athletes_db.arn,
+  ]
+  role_id = module.lambda_check_activity.role_id
+}
+
+module "iam_sns_lambda_check_activity" {
+  source  = "github.com/ockendenjo/tfmods//iam-sns"
+  role_id = module.lambda_check_activity.role_id
+  sns_arns = [
+    aws_sns_topic.topic.arn,
+    local.athlete_topics_arn,
+  ]
+}
+
+resource "aws_cloudwatch_event_rule" "check_activity" {
+  name        = "strava-check-activity"
+  description = "Check gear when an activity is created or updated"
+  event_pattern = jsonencode({
+    source      = ["io.ockenden.strava"]
+    detail-type = ["StravaActivityCreated", "StravaActivityUpdated"]
+  })
+}
+
+resource "aws_cloudwatch_event_target" "check_activity_lambda" {
+  rule      = aws_cloudwatch_event_rule.check_activity.name
+  target_id = "CheckActivityLambda"
+  arn       = module.lambda_check_activity.arn
+
+  retry_policy {
+    maximum_event_age_in_seconds = 3600
+    maximum_retry_attempts       = 2
+  }
+}
+
+resource "aws_lambda_permission" "check_activity_eventbridge" {
+  statement_id  = "AllowExecutionFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = module.lambda_check_activity.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.check_activity.arn
+}
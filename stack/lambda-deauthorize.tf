@@ -0,0 +1,80 @@
+module "lambda_deauthorize" {
+  source = "github.com/ockendenjo/tfmods//lambda"
+
+  aws_env                  = var.env
+  name                     = "deauthorize"
+  permissions_boundary_arn = var.permissions_boundary_arn
+  project_name             = "strava"
+  s3_bucket                = var.lambda_binaries_bucket
+  s3_object_key            = local.manifest["deauthorize"]
+
+  environment = {
+    TOPIC_ARN     = aws_sns_topic.topic.arn
+    ATHLETES_DB   = aws_dynamodb_table.athletes_db.name
+    BAGGING_DB    = aws_dynamodb_table.bagging_db.name
+    BAGS_DB       = aws_dynamodb_table.bags_db.name
+    SETTINGS_DB   = aws_dynamodb_table.athlete_settings_db.name
+    SCHEDULE_RULE = aws_cloudwatch_event_rule.gear_check_schedule.name
+  }
+}
+
+module "iam_dynamodb_lambda_deauthorize" {
+  source = "github.com/ockendenjo/tfmods//iam-dynamodb"
+  dynamo_table_arns = [
+    aws_dynamodb_table.athletes_db.arn,
+    aws_dynamodb_table.bagging_db.arn,
+    aws_dynamodb_table.bags_db.arn,
+    aws_dynamodb_table.athlete_settings_db.arn,
+  ]
+  role_id = module.lambda_deauthorize.role_id
+}
+
+module "iam_sns_lambda_deauthorize" {
+  source  = "github.com/ockendenjo/tfmods//iam-sns"
+  role_id = module.lambda_deauthorize.role_id
+  sns_arns = [
+    aws_sns_topic.topic.arn,
+    local.athlete_topics_arn,
+  ]
+}
+
+resource "aws_iam_role_policy" "deauthorize_schedule" {
+  name = "schedule-rule"
+  role = module.lambda_deauthorize.role_id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["events:DisableRule"]
+      Resource = [aws_cloudwatch_event_rule.gear_check_schedule.arn]
+    }]
+  })
+}
+
+resource "aws_cloudwatch_event_rule" "deauthorize" {
+  name        = "strava-deauthorize"
+  description = "Remove athlete data when access is revoked"
+  event_pattern = jsonencode({
+    source      = ["io.ockenden.strava"]
+    detail-type = ["StravaAthleteDeauthorized"]
+  })
+}
+
+resource "aws_cloudwatch_event_target" "deauthorize_lambda" {
+  rule      = aws_cloudwatch_event_rule.deauthorize.name
+  target_id = "DeauthorizeLambda"
+  arn       = module.lambda_deauthorize.arn
+
+  retry_policy {
+    maximum_event_age_in_seconds = 3600
+    maximum_retry_attempts       = 2
+  }
+}
+
+resource "aws_lambda_permission" "deauthorize_eventbridge" {
+  statement_id  = "AllowExecutionFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = module.lambda_deauthorize.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.deauthorize.arn
+}
@@ -9,23 +9,28 @@ module "lambda_gear_check" {
   s3_object_key            = local.manifest["check"]
 
   environment = {
-    GEAR_IDS   = var.gear_ids
-    TOPIC_ARN  = aws_sns_topic.topic.arn
-    BAGGING_DB = aws_dynamodb_table.bagging_db.name
+    GEAR_RULES       = jsonencode(var.gear_rules)
+    TOPIC_ARN        = aws_sns_topic.topic.arn
+    ATHLETES_DB      = aws_dynamodb_table.athletes_db.name
+    BAGGING_DB       = aws_dynamodb_table.bagging_db.name
+    BAGGING_TTL_DAYS = var.bagging_ttl_days
+    GEAR_CHANGES_DB  = aws_dynamodb_table.gear_changes_db.name
+    FIX_MODE         = var.fix_mode
   }
 }
 
 module "iam_ssm_lambda_check" {
-  source      = "github.com/ockendenjo/tfmods//iam-ssm"
-  role_id     = module.lambda_gear_check.role_id
-  ssm_arn     = "arn:aws:ssm:${var.aws_region}:${data.aws_caller_identity.current.account_id}:parameter/strava*"
-  allow_write = true
+  source  = "github.com/ockendenjo/tfmods//iam-ssm"
+  role_id = module.lambda_gear_check.role_id
+  ssm_arn = "arn:aws:ssm:${var.aws_region}:${data.aws_caller_identity.current.account_id}:parameter/strava*"
 }
 
 module "iam_dynamodb_lambda_check" {
   source = "github.com/ockendenjo/tfmods//iam-dynamodb"
   dynamo_table_arns = [
+    aws_dynamodb_table.athletes_db.arn,
     aws_dynamodb_table.bagging_db.arn,
+    aws_dynamodb_table.gear_changes_db.arn,
   ]
   role_id = module.lambda_gear_check.role_id
 }
@@ -35,6 +40,7 @@ module "iam_sns_lambda_check" {
   role_id = module.lambda_gear_check.role_id
   sns_arns = [
     aws_sns_topic.topic.arn,
+    local.athlete_topics_arn,
   ]
 }
 
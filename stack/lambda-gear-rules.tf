@@ -0,0 +1,50 @@
+module "lambda_gear_rules" {
+  source = "github.com/ockendenjo/tfmods//lambda"
+
+  aws_env                  = var.env
+  name                     = "gear-rules"
+  permissions_boundary_arn = var.permissions_boundary_arn
+  project_name             = "strava"
+  s3_bucket                = var.lambda_binaries_bucket
+  s3_object_key            = local.manifest["gear-rules"]
+
+  environment = {
+    GEAR_RULES  = jsonencode(var.gear_rules)
+    ATHLETES_DB = aws_dynamodb_table.athletes_db.name
+  }
+}
+
+module "iam_dynamodb_lambda_gear_rules" {
+  source = "github.com/ockendenjo/tfmods//iam-dynamodb"
+  dynamo_table_arns = [
+    aws_dynamodb_table.athletes_db.arn,
+  ]
+  role_id = module.lambda_gear_rules.role_id
+}
+
+resource "aws_apigatewayv2_integration" "gear_rules" {
+  api_id                 = aws_apigatewayv2_api.http_api.id
+  integration_type       = "AWS_PROXY"
+  integration_uri        = module.lambda_gear_rules.invoke_arn
+  payload_format_version = "2.0"
+}
+
+resource "aws_apigatewayv2_route" "gear_rules" {
+  for_each = toset([
+    "GET /athletes/{athleteId}/gear-rules",
+    "PUT /athletes/{athleteId}/gear-rules",
+    "POST /athletes/{athleteId}/gear-rules/validate",
+  ])
+
+  api_id    = aws_apigatewayv2_api.http_api.id
+  route_key = each.value
+  target    = "integrations/${aws_apigatewayv2_integration.gear_rules.id}"
+}
+
+resource "aws_lambda_permission" "gear_rules" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = module.lambda_gear_rules.function_name
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "${aws_apigatewayv2_api.http_api.execution_arn}/*/*"
+}
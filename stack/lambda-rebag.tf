@@ -0,0 +1,47 @@
+module "lambda_rebag" {
+  source = "github.com/ockendenjo/tfmods//lambda"
+
+  aws_env                  = var.env
+  name                     = "rebag"
+  permissions_boundary_arn = var.permissions_boundary_arn
+  project_name             = "strava"
+  s3_bucket                = var.lambda_binaries_bucket
+  s3_object_key            = local.manifest["rebag"]
+
+  environment = {
+    BAGGING_DB           = aws_dynamodb_table.bagging_db.name
+    HILLS_DATASET_BUCKET = var.lambda_binaries_bucket
+    HILLS_DATASET_KEY    = var.hills_dataset_key
+  }
+}
+
+resource "aws_iam_role_policy" "rebag_hills_dataset" {
+  count = var.hills_dataset_key == "" ? 0 : 1
+
+  name = "hills-dataset"
+  role = module.lambda_rebag.role_id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["s3:GetObject"]
+      Resource = ["${data.aws_s3_bucket.lambda_binaries.arn}/${var.hills_dataset_key}"]
+    }]
+  })
+}
+
+module "iam_dynamodb_lambda_rebag" {
+  source = "github.com/ockendenjo/tfmods//iam-dynamodb"
+  dynamo_table_arns = [
+    aws_dynamodb_table.bagging_db.arn,
+  ]
+  role_id = module.lambda_rebag.role_id
+}
+
+module "iam_eventbridge_lambda_rebag" {
+  source  = "github.com/ockendenjo/tfmods//iam-eventbridge"
+  role_id = module.lambda_rebag.role_id
+  bus_arns = [
+    "arn:aws:events:${var.aws_region}:${var.aws_account_id}:event-bus/default"
+  ]
+}
@@ -8,7 +8,10 @@ module "lambda_receive_event" {
   s3_bucket                = var.lambda_binaries_bucket
   s3_object_key            = local.manifest["receive-event"]
 
-  environment = {}
+  environment = {
+    DEAD_LETTER_BUCKET = aws_s3_bucket.dead_letter.bucket
+    DEDUPE_DB          = aws_dynamodb_table.dedupe_db.name
+  }
 }
 
 module "iam_eventbridge_lambda_receive_event" {
@@ -18,3 +21,30 @@ module "iam_eventbridge_lambda_receive_event" {
     "arn:aws:events:${var.aws_region}:${var.aws_account_id}:event-bus/default"
   ]
 }
+
+module "iam_dynamodb_lambda_receive_event" {
+  source = "github.com/ockendenjo/tfmods//iam-dynamodb"
+  dynamo_table_arns = [
+    aws_dynamodb_table.dedupe_db.arn,
+  ]
+  role_id = module.lambda_receive_event.role_id
+}
+
+module "iam_ssm_lambda_receive_event" {
+  source  = "github.com/ockendenjo/tfmods//iam-ssm"
+  role_id = module.lambda_receive_event.role_id
+  ssm_arn = "arn:aws:ssm:${var.aws_region}:${data.aws_caller_identity.current.account_id}:parameter/strava*"
+}
+
+resource "aws_iam_role_policy" "receive_event_dead_letter" {
+  name = "dead-letter"
+  role = module.lambda_receive_event.role_id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["s3:PutObject"]
+      Resource = ["${aws_s3_bucket.dead_letter.arn}/dead-letter/*"]
+    }]
+  })
+}
@@ -19,3 +19,31 @@ module "iam_ssm_lambda_subscribe" {
   ssm_arn     = "arn:aws:ssm:${var.aws_region}:${data.aws_caller_identity.current.account_id}:parameter/strava*"
   allow_write = true
 }
+
+resource "aws_cloudwatch_event_rule" "subscribe" {
+  name        = "strava-subscribe"
+  description = "Create the webhook subscription when an athlete authorizes the app and none exists"
+  event_pattern = jsonencode({
+    source      = ["io.ockenden.strava"]
+    detail-type = ["StravaSubscriptionRequested"]
+  })
+}
+
+resource "aws_cloudwatch_event_target" "subscribe_lambda" {
+  rule      = aws_cloudwatch_event_rule.subscribe.name
+  target_id = "SubscribeLambda"
+  arn       = module.lambda_subscribe.arn
+
+  retry_policy {
+    maximum_event_age_in_seconds = 3600
+    maximum_retry_attempts       = 2
+  }
+}
+
+resource "aws_lambda_permission" "subscribe_eventbridge" {
+  statement_id  = "AllowExecutionFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = module.lambda_subscribe.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.subscribe.arn
+}
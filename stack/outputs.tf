@@ -4,11 +4,16 @@ output "auth_callback_domain" {
 }
 
 output "auth_url_read" {
-  description = "Strava authentication URL"
-  value       = "https://www.strava.com/oauth/authorize?client_id=${var.client_id}&response_type=code&scope=activity:read&redirect_uri=${aws_apigatewayv2_stage.default.invoke_url}/auth"
+  description = "URL which starts a Strava authorization with read access"
+  value       = "${aws_apigatewayv2_stage.default.invoke_url}/connect"
 }
 
 output "auth_url_write" {
-  description = "Strava authentication URL"
-  value       = "https://www.strava.com/oauth/authorize?client_id=${var.client_id}&response_type=code&scope=activity:read,activity:write,activity:read_all&redirect_uri=${aws_apigatewayv2_stage.default.invoke_url}/auth"
+  description = "URL which starts a Strava authorization with read and write access"
+  value       = "${aws_apigatewayv2_stage.default.invoke_url}/connect?access=write"
+}
+
+output "dead_letter_bucket" {
+  description = "Bucket for webhook events which could not be published"
+  value       = aws_s3_bucket.dead_letter.bucket
 }
@@ -1,3 +1,8 @@
 resource "aws_sns_topic" "topic" {
   name = "strava-shoes-topic"
 }
+
+locals {
+  # Athletes may send notifications to their own topic. Topic names must start with strava-
+  athlete_topics_arn = "arn:aws:sns:${var.aws_region}:${data.aws_caller_identity.current.account_id}:strava-*"
+}
@@ -20,8 +20,8 @@ resource "aws_ssm_parameter" "client_secret" {
   }
 }
 
-resource "aws_ssm_parameter" "access_token" {
-  name  = "/strava/accessToken"
+resource "aws_ssm_parameter" "subscription_id" {
+  name  = "/strava/subscriptionId"
   type  = "String"
   value = "placeholder"
   tier  = "Standard"
@@ -31,8 +31,19 @@ resource "aws_ssm_parameter" "access_token" {
   }
 }
 
-resource "aws_ssm_parameter" "refresh_token" {
-  name  = "/strava/refreshToken"
+resource "aws_ssm_parameter" "callback_token" {
+  name  = "/strava/callbackToken"
+  type  = "String"
+  value = "placeholder"
+  tier  = "Standard"
+
+  lifecycle {
+    ignore_changes = [value, type]
+  }
+}
+
+resource "aws_ssm_parameter" "api_key" {
+  name  = "/strava/apiKey"
   type  = "String"
   value = "placeholder"
   tier  = "Standard"
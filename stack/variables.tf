@@ -9,10 +9,16 @@ variable "aws_region" {
   default     = "eu-west-1"
 }
 
-variable "client_id" {
+variable "bag_radius_metres" {
+  description = "Distance from a summit within which a route bags the hill"
   type        = number
-  description = "Strava app client ID"
-  default     = 0
+  default     = 50
+}
+
+variable "bagging_ttl_days" {
+  description = "Days to keep the record that an activity was checked for bagged hills. Records are kept forever if 0"
+  type        = number
+  default     = 60
 }
 
 variable "env" {
@@ -25,10 +31,36 @@ variable "env" {
   }
 }
 
-variable "gear_ids" {
+variable "fix_mode" {
+  description = "Whether the gear check assigns the gear from a failed rule (off, dryRun or apply)"
+  type        = string
+  default     = "off"
+
+  validation {
+    condition     = contains(["off", "dryRun", "apply"], var.fix_mode)
+    error_message = "Fix mode must be one of 'off', 'dryRun' or 'apply'."
+  }
+}
+
+variable "gear_rules" {
+  description = "Gear rules keyed by Strava sport type. Allowed gear IDs (if any), forbidden gear IDs and the gear ID to use for each sport"
+  type = map(object({
+    allowed   = optional(list(string), [])
+    forbidden = optional(list(string), [])
+    use       = optional(string, "")
+  }))
+  default = {
+    Run  = { forbidden = ["g9558316"] }
+    Hike = { forbidden = ["g9558316"] }
+    Walk = { forbidden = ["g9558316"] }
+    Ride = { forbidden = ["g9558316"] }
+  }
+}
+
+variable "hills_dataset_key" {
+  description = "S3 key of a hill dataset in the lambda binaries bucket. The dataset embedded in the bagging lambda is used if empty"
   type        = string
-  description = "Stringified JSON of gear IDs to warn about"
-  default     = "[\"g9558316\", \"\"]"
+  default     = ""
 }
 
 variable "lambda_binaries_bucket" {